@@ -0,0 +1,213 @@
+// Reads and writes Anki packages (.apkg), the zip files Anki imports and
+// exports decks as. Only the legacy format is supported, in which the
+// collection is an uncompressed SQLite database; newer versions of Anki
+// write it when "Support older Anki versions" is checked in the export
+// dialog.
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Separates the fields of a note in the collection
+const fieldSeparator = "\x1f"
+
+// Separates the levels of hierarchical tags in Anki
+const TagSeparator = "::"
+
+type Note struct {
+	GUID string
+	// The name of the note type
+	Model string
+	// The names of the fields in the order of the note type
+	FieldNames []string
+	// The fields as Anki stores them, which is as HTML
+	Fields []string
+	Tags   []string
+}
+
+type Package struct {
+	Notes []*Note
+	zip   *zip.ReadCloser
+	// The zip entries of media files by their names
+	media map[string]*zip.File
+}
+
+// The parts of a note type that are read
+type model struct {
+	ID     int64        `json:"id"`
+	Name   string       `json:"name"`
+	Fields []modelField `json:"flds"`
+}
+
+type modelField struct {
+	Name string `json:"name"`
+	Ord  int    `json:"ord"`
+}
+
+// Open reads the notes of the package and keeps it open for its media to
+// be read. The package needs to be closed after use.
+func Open(filename string) (*Package, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &Package{
+		zip:   r,
+		media: map[string]*zip.File{},
+	}
+	err = pkg.read()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return pkg, nil
+}
+
+func (pkg *Package) Close() error {
+	return pkg.zip.Close()
+}
+
+func (pkg *Package) read() error {
+	entries := map[string]*zip.File{}
+	for _, f := range pkg.zip.File {
+		entries[f.Name] = f
+	}
+	if entries["collection.anki21b"] != nil {
+		return fmt.Errorf("%w: the package is in the format of newer versions of Anki; export it again with \"Support older Anki versions\" checked", core.ErrInvalid)
+	}
+	// Packages of Anki 2.1 have a collection.anki2 as well, for older
+	// versions
+	collection := entries["collection.anki21"]
+	if collection == nil {
+		collection = entries["collection.anki2"]
+	}
+	if collection == nil {
+		return fmt.Errorf("%w: the package has no collection", core.ErrInvalid)
+	}
+	err := pkg.readCollection(collection)
+	if err != nil {
+		return fmt.Errorf("Error reading the collection: %w", err)
+	}
+
+	if entries["media"] == nil {
+		return nil
+	}
+	// Maps the numbered entries of the zip file to media file names
+	mediaNames := map[string]string{}
+	err = readJSON(entries["media"], &mediaNames)
+	if err != nil {
+		return fmt.Errorf("Error reading the list of media: %w", err)
+	}
+	for entry, name := range mediaNames {
+		if entries[entry] != nil {
+			pkg.media[name] = entries[entry]
+		}
+	}
+	return nil
+}
+
+func readJSON(f *zip.File, v interface{}) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
+// readCollection reads the notes of the collection, which needs to be
+// copied to a file to be opened with SQLite.
+func (pkg *Package) readCollection(f *zip.File) error {
+	tmp, err := ioutil.TempFile("", "kartoteka-anki-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	r, err := f.Open()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	r.Close()
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+tmp.Name()+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var modelsJSON string
+	err = db.QueryRow("select models from col;").Scan(&modelsJSON)
+	if err != nil {
+		return err
+	}
+	models := map[string]*model{}
+	err = json.Unmarshal([]byte(modelsJSON), &models)
+	if err != nil {
+		return fmt.Errorf("Error reading the note types: %w", err)
+	}
+	fieldNames := map[int64][]string{}
+	modelNames := map[int64]string{}
+	for _, m := range models {
+		sort.Slice(m.Fields, func(i, j int) bool {
+			return m.Fields[i].Ord < m.Fields[j].Ord
+		})
+		names := make([]string, len(m.Fields))
+		for i, field := range m.Fields {
+			names[i] = field.Name
+		}
+		fieldNames[m.ID] = names
+		modelNames[m.ID] = m.Name
+	}
+
+	rows, err := db.Query("select guid, mid, tags, flds from notes order by id;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mid int64
+		var tags, fields string
+		note := &Note{}
+		err = rows.Scan(&note.GUID, &mid, &tags, &fields)
+		if err != nil {
+			return err
+		}
+		note.Model = modelNames[mid]
+		note.FieldNames = fieldNames[mid]
+		note.Fields = strings.Split(fields, fieldSeparator)
+		note.Tags = strings.Fields(tags)
+		pkg.Notes = append(pkg.Notes, note)
+	}
+	return rows.Err()
+}
+
+// OpenMedia opens the media file with the name, as referred to in fields.
+// Returns core.ErrNotFound if the package does not have it.
+func (pkg *Package) OpenMedia(name string) (io.ReadCloser, error) {
+	f := pkg.media[name]
+	if f == nil {
+		return nil, core.ErrNotFound
+	}
+	return f.Open()
+}
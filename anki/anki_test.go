@@ -0,0 +1,201 @@
+package anki
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/ivartj/kartoteka/blobstore"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/repository/repositorytest"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/wordfile"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testContext struct {
+	db            *sql.DB
+	wordStore     core.WordStore
+	languageStore core.LanguageStore
+	imageStore    core.ImageStore
+	blobStore     core.BlobStore
+	imageService  *service.ImageService
+	user          *entity.User
+}
+
+func newTestContext(t *testing.T, directory string) *testContext {
+	db := repositorytest.Open(t, "pl", "en")
+	blobStore, err := blobstore.NewFileStore(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &testContext{
+		db:            db,
+		wordStore:     repository.NewWordStore(db),
+		languageStore: repository.NewLanguageStore(db),
+		imageStore:    repository.NewImageStore(db),
+		blobStore:     blobStore,
+		user:          repositorytest.AddUser(t, db, "anki"),
+	}
+	ctx.imageService = service.NewImageService(ctx.imageStore, ctx.wordStore, blobStore, 1<<20)
+	return ctx
+}
+
+func testImage(t *testing.T) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.NRGBA{R: 255, A: 255})
+	var b bytes.Buffer
+	err := png.Encode(&b, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExportImport(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kartoteka-anki-")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(directory)
+
+	source := newTestContext(t, filepath.Join(directory, "source"))
+	translation := func(languageCode, text string) *entity.WordTranslation {
+		return &entity.WordTranslation{LanguageCode: languageCode, Translation: text}
+	}
+	words := []*entity.Word{
+		{Word: "jabłko", LanguageCode: "pl",
+			Tags:         []string{"a1", "food/fruit"},
+			Translations: []*entity.WordTranslation{translation("en", "an apple")}},
+		{Word: "zamek", LanguageCode: "pl",
+			Notes:        "Two meanings.\nThe <b> is not bold & stays.",
+			Translations: []*entity.WordTranslation{translation("en", "a lock"), translation("en", "a castle")}},
+	}
+	for _, word := range words {
+		word.ID = entity.WordID(entity.NewID())
+		word.UserID = source.user.ID
+		err = source.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+	_, err = source.imageService.Attach(words[0], &entity.Image{}, bytes.NewReader(testImage(t)))
+	if err != nil {
+		t.Fatalf("Failed to attach an image: %s", err)
+	}
+
+	exporter := NewExporter(source.imageStore, source.blobStore)
+	exporter.TranslationLanguage = "en"
+	filename := filepath.Join(directory, "words.apkg")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exporter.Export(f, words)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatalf("Failed to export: %s", err)
+	}
+
+	pkg, err := Open(filename)
+	if err != nil {
+		t.Fatalf("Failed to open the package: %s", err)
+	}
+	defer pkg.Close()
+	assert.Len(t, pkg.Notes, 2)
+	assert.Equal(t, exportFields, pkg.Notes[0].FieldNames)
+	assert.Equal(t, []string{"a1", "food::fruit"}, pkg.Notes[0].Tags)
+
+	target := newTestContext(t, filepath.Join(directory, "target"))
+	importer := NewImporter(target.wordStore, target.languageStore, target.imageService, target.user)
+	importer.Lang = "pl"
+	importer.Tags = []string{"deck"}
+	importer.Mapping = Mapping{}
+	for _, m := range []string{"Word=word", "Translation=tr:en", "Notes=notes", "Image=image"} {
+		err = importer.Mapping.Set(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum, err := importer.Import(pkg)
+	if err != nil {
+		t.Fatalf("Failed to import: %s", err)
+	}
+	assert.Equal(t, 2, sum.Added)
+	assert.Equal(t, 1, sum.Images)
+
+	imported, err := target.wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, imported, 2)
+	for _, word := range imported {
+		switch word.Word {
+		case "jabłko":
+			assert.ElementsMatch(t, []string{"deck", "a1", "food/fruit"}, word.Tags)
+			assert.True(t, word.ImageID.Valid)
+			assert.Len(t, word.Translations, 1)
+		case "zamek":
+			assert.Equal(t, words[1].Notes, word.Notes)
+			assert.Equal(t, []string{"deck"}, word.Tags)
+			assert.False(t, word.ImageID.Valid)
+			texts := []string{}
+			for _, translation := range word.Translations {
+				texts = append(texts, translation.Translation)
+			}
+			assert.ElementsMatch(t, []string{"a lock", "a castle"}, texts)
+		default:
+			t.Errorf("Unexpected word %s", word.Word)
+		}
+	}
+
+	// Importing it again changes nothing, and keeps the images
+	sum, err = importer.Import(pkg)
+	if err != nil {
+		t.Fatalf("Failed to import again: %s", err)
+	}
+	assert.Equal(t, &Summary{Summary: wordfile.Summary{Unchanged: 2}}, sum)
+
+	// Importing the export where it came from matches the words it was made
+	// from, but only for their own user
+	mapping := importer.Mapping
+	for _, username := range []string{"", "alice"} {
+		user := source.user
+		if username != "" {
+			user = repositorytest.AddUser(t, source.db, username)
+		}
+		importer := NewImporter(source.wordStore, source.languageStore, source.imageService, user)
+		importer.Lang = "pl"
+		importer.Mapping = mapping
+		sum, err = importer.Import(pkg)
+		if err != nil {
+			t.Fatalf("Failed to import into the source: %s", err)
+		}
+		if username == "" {
+			assert.Equal(t, &Summary{Summary: wordfile.Summary{Unchanged: 2}}, sum)
+		} else {
+			assert.Equal(t, 2, sum.Added)
+		}
+	}
+	ids, err := source.wordStore.ListIDs(&core.WordQuery{Spec: core.UserWordSpec(source.user.Username)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, []entity.WordID{words[0].ID, words[1].ID}, ids)
+}
+
+func TestFieldText(t *testing.T) {
+	field := "<div>kot&nbsp;[sound:kot.mp3]</div><div><b>cat</b>\n<img src=\"a &amp; b.jpg\"></div>"
+	assert.Equal(t, "kot\ncat", fieldText(field))
+	assert.Equal(t, []string{"a & b.jpg"}, fieldImages(field))
+	assert.Equal(t, "a\n\nb", fieldText("a<br><br><br>b"))
+}
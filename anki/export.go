@@ -0,0 +1,378 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fields of the note type words are exported as
+var exportFields = []string{"Word", "Translation", "Notes", "Image"}
+
+// The schema of collections of version 11, which every version of Anki 2
+// can import
+const collectionSchema = `
+create table col (
+	id integer primary key,
+	crt integer not null,
+	mod integer not null,
+	scm integer not null,
+	ver integer not null,
+	dty integer not null,
+	usn integer not null,
+	ls integer not null,
+	conf text not null,
+	models text not null,
+	decks text not null,
+	dconf text not null,
+	tags text not null
+);
+create table notes (
+	id integer primary key,
+	guid text not null,
+	mid integer not null,
+	mod integer not null,
+	usn integer not null,
+	tags text not null,
+	flds text not null,
+	sfld integer not null,
+	csum integer not null,
+	flags integer not null,
+	data text not null
+);
+create table cards (
+	id integer primary key,
+	nid integer not null,
+	did integer not null,
+	ord integer not null,
+	mod integer not null,
+	usn integer not null,
+	type integer not null,
+	queue integer not null,
+	due integer not null,
+	ivl integer not null,
+	factor integer not null,
+	reps integer not null,
+	lapses integer not null,
+	left integer not null,
+	odue integer not null,
+	odid integer not null,
+	flags integer not null,
+	data text not null
+);
+create table revlog (
+	id integer primary key,
+	cid integer not null,
+	usn integer not null,
+	ease integer not null,
+	ivl integer not null,
+	lastIvl integer not null,
+	factor integer not null,
+	time integer not null,
+	type integer not null
+);
+create table graves (
+	usn integer not null,
+	oid integer not null,
+	type integer not null
+);
+create index ix_notes_usn on notes (usn);
+create index ix_cards_usn on cards (usn);
+create index ix_revlog_usn on revlog (usn);
+create index ix_cards_nid on cards (nid);
+create index ix_cards_sched on cards (did, queue, due);
+create index ix_revlog_cid on revlog (cid);
+create index ix_notes_csum on notes (csum);
+`
+
+// Exports words as an Anki package with a card for each word, showing the
+// word on the front and its translations, image and notes on the back.
+// Each note has the ID of its word as GUID, so that importing a newer
+// export into Anki updates the notes rather than adding them again.
+type Exporter struct {
+	imageStore core.ImageStore
+	blobStore  core.BlobStore
+	// The name of the deck the cards are put in
+	Deck string
+	// If set, only the translations into the language are exported
+	TranslationLanguage string
+}
+
+// NewExporter returns an exporter that includes the images of words. Without
+// a blob store images are left out.
+func NewExporter(imageStore core.ImageStore, blobStore core.BlobStore) *Exporter {
+	return &Exporter{
+		imageStore: imageStore,
+		blobStore:  blobStore,
+		Deck:       "kartoteka",
+	}
+}
+
+func (exporter *Exporter) Export(w io.Writer, words []*entity.Word) error {
+	tmp, err := ioutil.TempFile("", "kartoteka-anki-*.db")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	media, err := exporter.writeCollection(tmp.Name(), words)
+	if err != nil {
+		return fmt.Errorf("Error writing the collection: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	err = copyToZip(zw, "collection.anki2", tmp.Name())
+	if err != nil {
+		return err
+	}
+	// Media files are stored as numbered entries
+	mediaNames := map[string]string{}
+	for i, image := range media {
+		entry := strconv.Itoa(i)
+		mediaNames[entry] = mediaName(image)
+		err = exporter.copyImageToZip(zw, entry, image)
+		if err != nil {
+			return fmt.Errorf("Error writing the image %s: %w", image.ID.String, err)
+		}
+	}
+	f, err := createInZip(zw, "media", zip.Deflate)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(mediaNames)
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func copyToZip(zw *zip.Writer, name string, filename string) error {
+	r, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := createInZip(zw, name, zip.Deflate)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func createInZip(zw *zip.Writer, name string, method uint16) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: time.Now(),
+	})
+}
+
+func (exporter *Exporter) copyImageToZip(zw *zip.Writer, name string, image *entity.Image) error {
+	blob, err := exporter.blobStore.Open(image.BlobKey)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	// Images are already compressed
+	f, err := createInZip(zw, name, zip.Store)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, blob)
+	return err
+}
+
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+func mediaName(image *entity.Image) string {
+	return "kartoteka-" + image.ID.String + mediaExtensions[image.MimeType]
+}
+
+// writeCollection writes the words to a new collection, returning the
+// images they refer to.
+func (exporter *Exporter) writeCollection(filename string, words []*entity.Word) ([]*entity.Image, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(collectionSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anki uses times in milliseconds as IDs
+	now := time.Now()
+	modelID := now.UnixNano() / int64(time.Millisecond)
+	deckID := modelID + 1
+	err = exporter.writeCol(tx, now, modelID, deckID)
+	if err != nil {
+		return nil, err
+	}
+
+	images := []*entity.Image{}
+	imageNames := map[string]string{}
+	for i, word := range words {
+		image := ""
+		if word.ImageID.Valid && exporter.blobStore != nil {
+			if imageNames[word.ImageID.String] == "" {
+				img, err := exporter.imageStore.Get(word.ImageID)
+				if err != nil {
+					return nil, fmt.Errorf("Error getting the image of '%s': %w", word.Word, err)
+				}
+				images = append(images, img)
+				imageNames[word.ImageID.String] = mediaName(img)
+			}
+			image = fmt.Sprintf(`<img src="%s">`, html.EscapeString(imageNames[word.ImageID.String]))
+		}
+		fields := []string{
+			html.EscapeString(word.Word),
+			exporter.translationField(word),
+			strings.ReplaceAll(html.EscapeString(word.Notes), "\n", "<br>"),
+			image,
+		}
+		tags := make([]string, len(word.Tags))
+		for i, tag := range word.Tags {
+			tags[i] = strings.ReplaceAll(tag, core.TagSeparator, TagSeparator)
+		}
+		sort.Strings(tags)
+		noteTags := ""
+		if len(tags) != 0 {
+			noteTags = " " + strings.Join(tags, " ") + " "
+		}
+		noteID := deckID + 1 + int64(i)
+		_, err = tx.Exec("insert into notes (id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data) values (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '');",
+			noteID, word.ID.String, modelID, now.Unix(), noteTags, strings.Join(fields, fieldSeparator), word.Word, checksum(word.Word))
+		if err != nil {
+			return nil, err
+		}
+		// New cards are shown in the order of due
+		_, err = tx.Exec("insert into cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data) values (?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '');",
+			noteID, noteID, deckID, now.Unix(), i+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return images, tx.Commit()
+}
+
+// translationField returns the translations with one on each line, each
+// followed by its language unless only one language is exported.
+func (exporter *Exporter) translationField(word *entity.Word) string {
+	lines := []string{}
+	for _, translation := range word.Translations {
+		if exporter.TranslationLanguage == "" {
+			lines = append(lines, html.EscapeString(translation.Translation+" ("+translation.LanguageCode+")"))
+		} else if translation.LanguageCode == exporter.TranslationLanguage {
+			lines = append(lines, html.EscapeString(translation.Translation))
+		}
+	}
+	return strings.Join(lines, "<br>")
+}
+
+// checksum is the checksum Anki keeps of the sort field, which is the first
+// 8 digits of its hexadecimal SHA-1 as a number.
+func checksum(sortField string) int64 {
+	sum := sha1.Sum([]byte(sortField))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+func (exporter *Exporter) writeCol(tx *sql.Tx, now time.Time, modelID, deckID int64) error {
+	fields := []map[string]interface{}{}
+	for i, name := range exportFields {
+		fields = append(fields, map[string]interface{}{
+			"name": name, "ord": i, "sticky": false, "rtl": false,
+			"font": "Arial", "size": 20, "media": []string{},
+		})
+	}
+	models := map[string]interface{}{
+		strconv.FormatInt(modelID, 10): map[string]interface{}{
+			"id": modelID, "name": "kartoteka", "type": 0, "mod": now.Unix(), "usn": -1,
+			"sortf": 0, "did": deckID, "tags": []string{}, "vers": []string{},
+			"flds": fields,
+			"tmpls": []map[string]interface{}{{
+				"name": "Card 1", "ord": 0, "did": nil,
+				"qfmt":  "{{Word}}",
+				"afmt":  "{{FrontSide}}\n\n<hr id=answer>\n\n{{Translation}}\n{{#Image}}<br>{{Image}}{{/Image}}\n{{#Notes}}<br><small>{{Notes}}</small>{{/Notes}}",
+				"bqfmt": "", "bafmt": "",
+			}},
+			"css":       ".card {\n font-family: arial;\n font-size: 20px;\n text-align: center;\n color: black;\n background-color: white;\n}\nimg {\n max-width: 100%;\n}\n",
+			"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+			"latexPost": "\\end{document}",
+			"req":       [][]interface{}{{0, "any", []int{0}}},
+		},
+	}
+	deck := func(id int64, name string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "mod": now.Unix(), "usn": -1, "desc": "",
+			"dyn": 0, "conf": 1, "collapsed": false, "browserCollapsed": false,
+			"extendNew": 0, "extendRev": 0,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0},
+			"lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	decks := map[string]interface{}{
+		"1":                           deck(1, "Default"),
+		strconv.FormatInt(deckID, 10): deck(deckID, exporter.Deck),
+	}
+	deckConfigs := map[string]interface{}{
+		"1": map[string]interface{}{
+			"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60,
+			"autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+			"new": map[string]interface{}{
+				"delays": []int{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": 2500,
+				"order": 1, "perDay": 20, "bury": false, "separate": true,
+			},
+			"rev": map[string]interface{}{
+				"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1,
+				"maxIvl": 36500, "bury": false, "minSpace": 1,
+			},
+			"lapse": map[string]interface{}{
+				"delays": []int{10}, "mult": 0, "minInt": 1,
+				"leechFails": 8, "leechAction": 0,
+			},
+		},
+	}
+	conf := map[string]interface{}{
+		"nextPos": 1, "estTimes": true, "activeDecks": []int64{1}, "sortType": "noteFld",
+		"timeLim": 0, "sortBackwards": false, "addToCur": true, "curDeck": 1,
+		"newSpread": 0, "dueCounts": true, "curModel": modelID, "collapseTime": 1200,
+	}
+
+	values := []interface{}{}
+	for _, v := range []interface{}{conf, models, decks, deckConfigs} {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(encoded))
+	}
+	_, err := tx.Exec("insert into col (id, crt, mod, scm, ver, dty, usn, ls, conf, models, decks, dconf, tags) values (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}');",
+		append([]interface{}{now.Unix(), now.UnixNano() / int64(time.Millisecond), now.UnixNano() / int64(time.Millisecond)}, values...)...)
+	return err
+}
@@ -0,0 +1,337 @@
+package anki
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/wordfile"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// What the fields of notes are imported as, by the names of the fields or
+// by their positions counted from 1. Each is "word", "notes", "image" or
+// "tr:" followed by a language code. Fields that are not mapped are left
+// out.
+type Mapping map[string]string
+
+// DefaultMapping maps the first field to the word and the second to a
+// translation into the language, or to the notes if no language is given.
+func DefaultMapping(translationLanguage string) Mapping {
+	if translationLanguage == "" {
+		return Mapping{"1": "word", "2": "notes"}
+	}
+	return Mapping{"1": "word", "2": "tr:" + translationLanguage}
+}
+
+// Set adds a mapping given as FIELD=TARGET.
+func (mapping Mapping) Set(s string) error {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("%w: expected FIELD=TARGET, got '%s'", core.ErrInvalid, s)
+	}
+	field, target := s[:i], s[i+1:]
+	switch {
+	case target == "word", target == "notes", target == "image":
+	case strings.HasPrefix(target, "tr:") && len(target) > len("tr:"):
+	default:
+		return fmt.Errorf("%w: unknown target '%s' for the field %s", core.ErrInvalid, target, field)
+	}
+	mapping[field] = target
+	return nil
+}
+
+type Summary struct {
+	wordfile.Summary
+	// Notes without a word, which are left out
+	Skipped int
+	// Images attached to words that had none
+	Images int
+}
+
+// Imports the notes of a package as the words of a user. Notes with the ID
+// of one of the user's words as GUID, as exported by Exporter, are imported
+// as that word. Other words get IDs derived from the GUIDs of the notes, so
+// that importing a newer version of the package updates the words it added
+// before.
+type Importer struct {
+	wordStore     core.WordStore
+	languageStore core.LanguageStore
+	imageService  *service.ImageService
+	user          *entity.User
+	// The language of the words
+	Lang    string
+	Mapping Mapping
+	// Added to every word along with the tags of the notes, such as to tell
+	// which deck the words are from
+	Tags []string
+	// Where a line is written for each word added or changed, and for what
+	// is left out
+	Log io.Writer
+}
+
+// NewImporter returns an importer of notes as words of the user. Without an
+// image service images are counted but not attached, as for a dry run.
+func NewImporter(wordStore core.WordStore, languageStore core.LanguageStore, imageService *service.ImageService, user *entity.User) *Importer {
+	return &Importer{
+		wordStore:     wordStore,
+		languageStore: languageStore,
+		imageService:  imageService,
+		user:          user,
+		Mapping:       DefaultMapping(""),
+		Log:           ioutil.Discard,
+	}
+}
+
+// The namespace of the IDs given to imported words
+var noteNamespace = uuid.MustParse("5b0e4a3c-9d1f-4c52-8a7e-0f6b2d9c1e84")
+
+func (importer *Importer) Import(pkg *Package) (*Summary, error) {
+	err := importer.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := new(Summary)
+	sections := []*wordfile.Section{}
+	images := map[string]string{}
+	for _, note := range pkg.Notes {
+		section, image := importer.section(note)
+		if section.Word == "" {
+			sum.Skipped++
+			fmt.Fprintf(importer.Log, "skipped\tnote %s has no word\n", note.GUID)
+			continue
+		}
+		section.ID, err = importer.wordID(note)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+		if image != "" {
+			images[section.ID] = image
+		}
+	}
+
+	wordImporter := wordfile.NewImporter(importer.wordStore, importer.languageStore, importer.user)
+	wordImporter.Log = importer.Log
+	wordSum, err := wordImporter.Import(sections)
+	if err != nil {
+		return nil, err
+	}
+	sum.Summary = *wordSum
+
+	for _, section := range sections {
+		if images[section.ID] == "" {
+			continue
+		}
+		attached, err := importer.attach(pkg, section, images[section.ID])
+		if err != nil {
+			return nil, err
+		}
+		if attached {
+			sum.Images++
+		}
+	}
+	return sum, nil
+}
+
+func (importer *Importer) validate() error {
+	codes := []string{importer.Lang}
+	hasWord := false
+	for _, target := range importer.Mapping {
+		if target == "word" {
+			hasWord = true
+		}
+		if strings.HasPrefix(target, "tr:") {
+			codes = append(codes, strings.TrimPrefix(target, "tr:"))
+		}
+	}
+	if !hasWord {
+		return fmt.Errorf("%w: no field is mapped to the word", core.ErrInvalid)
+	}
+	for _, code := range codes {
+		_, err := importer.languageStore.Get(code)
+		if err == core.ErrNotFound {
+			return fmt.Errorf("%w: unknown language '%s'", core.ErrInvalid, code)
+		} else if err != nil {
+			return err
+		}
+	}
+	for _, tag := range importer.Tags {
+		err := service.ValidateTag(tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wordID returns the ID of the word the note is imported as.
+func (importer *Importer) wordID(note *Note) (string, error) {
+	var id entity.WordID
+	err := id.Scan(note.GUID)
+	if err != nil {
+		return "", err
+	}
+	word, err := importer.wordStore.Get(id)
+	if err == nil && word.UserID == importer.user.ID {
+		return word.ID.String, nil
+	} else if err != nil && err != core.ErrNotFound {
+		return "", err
+	}
+	return uuid.NewSHA1(noteNamespace, []byte(importer.user.ID.String+"\x00"+note.GUID)).String(), nil
+}
+
+// section returns the note as a section of a word file, along with the name
+// of the first image in the mapped fields, if any.
+func (importer *Importer) section(note *Note) (*wordfile.Section, string) {
+	section := &wordfile.Section{
+		Lang: importer.Lang,
+		Tr:   map[string]interface{}{},
+	}
+	image := ""
+	notes := []string{}
+	for i, field := range note.Fields {
+		target, ok := "", false
+		if i < len(note.FieldNames) {
+			target, ok = importer.Mapping[note.FieldNames[i]]
+		}
+		if !ok {
+			target, ok = importer.Mapping[strconv.Itoa(i+1)]
+		}
+		if !ok {
+			continue
+		}
+		if image == "" {
+			if images := fieldImages(field); len(images) != 0 {
+				image = images[0]
+			}
+		}
+		switch {
+		case target == "word":
+			if section.Word == "" {
+				section.Word = strings.Join(strings.Fields(fieldText(field)), " ")
+			}
+		case target == "notes":
+			if text := fieldText(field); text != "" {
+				notes = append(notes, text)
+			}
+		case strings.HasPrefix(target, "tr:"):
+			code := strings.TrimPrefix(target, "tr:")
+			texts, _ := section.Tr[code].([]string)
+			// Each line is a translation of its own
+			for _, line := range strings.Split(fieldText(field), "\n") {
+				if line = strings.Join(strings.Fields(line), " "); line != "" {
+					texts = append(texts, line)
+				}
+			}
+			if len(texts) != 0 {
+				section.Tr[code] = texts
+			}
+		}
+	}
+	section.Notes = strings.Join(notes, "\n\n")
+
+	seen := map[string]bool{}
+	tags := append([]string{}, importer.Tags...)
+	for _, tag := range note.Tags {
+		tag = strings.ReplaceAll(tag, TagSeparator, core.TagSeparator)
+		if service.ValidateTag(tag) != nil {
+			fmt.Fprintf(importer.Log, "skipped\tinvalid tag '%s' of note %s\n", tag, note.GUID)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			section.Tags = append(section.Tags, tag)
+		}
+	}
+	return section, image
+}
+
+// attach attaches the image to the word of the section unless it already
+// has one, which it keeps. Images that cannot be read are left out.
+func (importer *Importer) attach(pkg *Package, section *wordfile.Section, name string) (bool, error) {
+	word, err := importer.wordStore.Get(entity.WordID(sql.NullString{String: section.ID, Valid: true}))
+	if err != nil {
+		return false, fmt.Errorf("Error getting '%s': %w", section.Word, err)
+	}
+	if word.ImageID.Valid {
+		return false, nil
+	}
+	content, err := pkg.OpenMedia(name)
+	if err == core.ErrNotFound {
+		// Newer versions of Anki percent-encode the names in fields
+		if unescaped, err2 := url.PathUnescape(name); err2 == nil {
+			content, err = pkg.OpenMedia(unescaped)
+		}
+	}
+	if err == core.ErrNotFound {
+		fmt.Fprintf(importer.Log, "skipped\timage %s of '%s' is not in the package\n", name, section.Word)
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Error reading the image %s: %w", name, err)
+	}
+	defer content.Close()
+	if importer.imageService == nil {
+		return true, nil
+	}
+	// The word had no image, so no blobs are left unused
+	_, err = importer.imageService.Attach(word, &entity.Image{}, content)
+	if errors.Is(err, core.ErrInvalid) {
+		fmt.Fprintf(importer.Log, "skipped\timage %s of '%s': %s\n", name, section.Word, err)
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Error attaching the image %s to '%s': %w", name, section.Word, err)
+	}
+	fmt.Fprintf(importer.Log, "image\t%s (%s)\n", section.Word, section.Lang)
+	return true, nil
+}
+
+var (
+	soundPattern = regexp.MustCompile(`\[sound:[^\]]*\]`)
+	imagePattern = regexp.MustCompile(`(?i)<img\s[^>]*?src\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))[^>]*>`)
+	// A run of block elements starts a single new line
+	blockPattern     = regexp.MustCompile(`(?i)(?:</?(?:div|p|li|tr)(?:\s[^>]*)?>)+`)
+	lineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>`)
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+	blankLines       = regexp.MustCompile(`\n{3,}`)
+)
+
+// fieldText returns the text of the HTML of a field, with line breaks where
+// the HTML has them and without sounds and images.
+func fieldText(field string) string {
+	text := strings.NewReplacer("\r\n", " ", "\n", " ").Replace(field)
+	text = soundPattern.ReplaceAllString(text, "")
+	text = blockPattern.ReplaceAllString(text, "\n")
+	text = lineBreakPattern.ReplaceAllString(text, "\n")
+	text = tagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = strings.ReplaceAll(text, "\u00a0", " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// fieldImages returns the names of the images in the HTML of a field.
+func fieldImages(field string) []string {
+	names := []string{}
+	for _, m := range imagePattern.FindAllStringSubmatch(field, -1) {
+		names = append(names, html.UnescapeString(m[1]+m[2]+m[3]))
+	}
+	return names
+}
@@ -0,0 +1,101 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Stores blobs in a directory under the hex SHA-256 of their content, so
+// that the same content is only stored once. Blobs are spread over
+// subdirectories named by the first two characters of the key.
+type FileStore struct {
+	directory string
+}
+
+func NewFileStore(directory string) (*FileStore, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{
+		directory: directory,
+	}, nil
+}
+
+var validKey = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// The content is written to a temporary file first, so that a failed or
+// partial write never leaves a blob under a key that does not match it.
+func (store *FileStore) Put(r io.Reader) (string, error) {
+	tmp, err := ioutil.TempFile(store.directory, ".upload-")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+
+	key := hex.EncodeToString(hash.Sum(nil))
+	blobPath := store.path(key)
+	_, err = os.Stat(blobPath)
+	if err == nil {
+		return key, nil
+	}
+	err = os.MkdirAll(filepath.Dir(blobPath), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmpName, blobPath)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Returns core.ErrNotFound if there is no blob with the key.
+func (store *FileStore) Open(key string) (core.Blob, error) {
+	if !validKey.MatchString(key) {
+		return nil, fmt.Errorf("%w: '%s' is not a blob key", core.ErrInvalid, key)
+	}
+	file, err := os.Open(store.path(key))
+	if os.IsNotExist(err) {
+		return nil, core.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (store *FileStore) Delete(key string) error {
+	if !validKey.MatchString(key) {
+		return fmt.Errorf("%w: '%s' is not a blob key", core.ErrInvalid, key)
+	}
+	err := os.Remove(store.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (store *FileStore) path(key string) string {
+	return filepath.Join(store.directory, key[:2], key[2:])
+}
@@ -0,0 +1,63 @@
+package blobstore
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreBasic(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kartoteka-blobstore-")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(directory)
+	store, err := NewFileStore(directory)
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %s", err)
+	}
+
+	key, err := store.Put(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Failed to put blob: %s", err)
+	}
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", key)
+
+	again, err := store.Put(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Failed to put blob: %s", err)
+	}
+	assert.Equal(t, key, again)
+
+	blob, err := store.Open(key)
+	if err != nil {
+		t.Fatalf("Failed to open blob: %s", err)
+	}
+	content, err := ioutil.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		t.Fatalf("Failed to read blob: %s", err)
+	}
+	assert.Equal(t, "hello", string(content))
+
+	err = store.Delete(key)
+	if err != nil {
+		t.Fatalf("Failed to delete blob: %s", err)
+	}
+	_, err = store.Open(key)
+	assert.Equal(t, core.ErrNotFound, err)
+
+	_, err = store.Open("../../etc/passwd")
+	assert.ErrorIs(t, err, core.ErrInvalid)
+
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %s", err)
+	}
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), ".upload-"), "temporary file left behind")
+	}
+}
@@ -0,0 +1,453 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var errPasswordsDoNotMatch = errors.New("The passwords do not match")
+
+// Serves /register, /login, /logout, /verify-email, /forgot-password and
+// /reset-password
+type Account struct {
+	txProvider
+	templateProvider
+	cookieSettings
+	i18nBundle *i18n.Bundle
+	mailer     core.Mailer
+	// Used for links in e-mails rather than the Host header of the request,
+	// which the client controls
+	baseURL string
+}
+
+func NewAccount(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle, secureCookies bool, mailer core.Mailer, baseURL string) *Account {
+	return &Account{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		cookieSettings:   cookieSettings{secureCookies},
+		i18nBundle:       i18nBundle,
+		mailer:           mailer,
+		baseURL:          strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (ctx *Account) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	isGet := req.Method == http.MethodGet || req.Method == http.MethodHead
+	isPost := req.Method == http.MethodPost
+	switch {
+	case req.URL.Path == "/logout" && isPost:
+		ctx.serveLogout(w, req)
+	case req.URL.Path == "/register" && isGet:
+		ctx.render(w, req, "register", map[string]interface{}{
+			"Next": safeRedirectTarget(req.URL.Query().Get("next")),
+		})
+	case req.URL.Path == "/register" && isPost:
+		ctx.serveRegister(w, req)
+	case req.URL.Path == "/login" && isGet:
+		ctx.render(w, req, "login", map[string]interface{}{
+			"Next": safeRedirectTarget(req.URL.Query().Get("next")),
+		})
+	case req.URL.Path == "/login" && isPost:
+		ctx.serveLogin(w, req)
+	case req.URL.Path == "/verify-email" && isGet:
+		ctx.serveVerifyEmail(w, req)
+	case req.URL.Path == "/verify-email/send" && isPost:
+		ctx.serveSendVerification(w, req)
+	case req.URL.Path == "/forgot-password" && isGet:
+		ctx.render(w, req, "forgot-password", map[string]interface{}{})
+	case req.URL.Path == "/forgot-password" && isPost:
+		ctx.serveForgotPassword(w, req)
+	case req.URL.Path == "/reset-password" && isGet:
+		ctx.render(w, req, "reset-password", map[string]interface{}{
+			"Token": req.URL.Query().Get("token"),
+		})
+	case req.URL.Path == "/reset-password" && isPost:
+		ctx.serveResetPassword(w, req)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctx *Account) render(w http.ResponseWriter, req *http.Request, templateName string, pageData map[string]interface{}) {
+	pageData["Localizer"] = ctx.localizer(req)
+	pageData["User"] = UserFromContext(req.Context())
+	err := ctx.Template().ExecuteTemplate(w, templateName, pageData)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Renders a page with nothing but a message, as the outcome of following a
+// link from an e-mail.
+func (ctx *Account) renderMessage(w http.ResponseWriter, req *http.Request, message *i18n.Message, isError bool) {
+	pageData := map[string]interface{}{}
+	msg := ctx.localize(ctx.localizer(req), message, nil)
+	if isError {
+		pageData["Error"] = msg
+	} else {
+		pageData["Message"] = msg
+	}
+	ctx.render(w, req, "account-message", pageData)
+}
+
+func (ctx *Account) localizer(req *http.Request) *i18n.Localizer {
+	return i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+}
+
+func (ctx *Account) localize(localizer *i18n.Localizer, message *i18n.Message, templateData map[string]interface{}) string {
+	msg, err := localizer.Localize(&i18n.LocalizeConfig{
+		DefaultMessage: message,
+		TemplateData:   templateData,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return msg
+}
+
+func (ctx *Account) localizeError(req *http.Request, err error) string {
+	var message *i18n.Message
+	switch {
+	case err == service.ErrInvalidCredentials:
+		message = &i18n.Message{ID: "InvalidCredentials", Other: "Invalid username or password"}
+	case err == errPasswordsDoNotMatch:
+		message = &i18n.Message{ID: "PasswordsDoNotMatch", Other: "The passwords do not match"}
+	default:
+		return err.Error()
+	}
+	return ctx.localize(ctx.localizer(req), message, nil)
+}
+
+var invalidTokenMessage = &i18n.Message{
+	ID:    "InvalidToken",
+	Other: "The link is invalid or has expired",
+}
+
+func (ctx *Account) serveRegister(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := strings.TrimSpace(req.PostForm.Get("username"))
+	email := strings.TrimSpace(req.PostForm.Get("email"))
+	password := req.PostForm.Get("password")
+	next := safeRedirectTarget(req.PostForm.Get("next"))
+	pageData := map[string]interface{}{
+		"Username": username,
+		"Email":    email,
+		"Next":     next,
+	}
+
+	if password != req.PostForm.Get("password_repeated") {
+		pageData["Error"] = ctx.localizeError(req, errPasswordsDoNotMatch)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.render(w, req, "register", pageData)
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	userStore := repository.NewUserStore(tx)
+	user, err := service.NewAccountService(userStore).Register(username, email, password)
+	if errors.Is(err, core.ErrInvalid) || errors.Is(err, core.ErrAlreadyExists) {
+		pageData["Error"] = ctx.localizeError(req, err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.render(w, req, "register", pageData)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	now := time.Now()
+	token, session, err := service.NewSessionService(repository.NewSessionStore(tx), userStore).Start(user.ID, now)
+	if err != nil {
+		panic(err)
+	}
+	verificationToken, err := service.NewTokenService(repository.NewTokenStore(tx)).Issue(user.ID, entity.TokenPurposeVerifyEmail, email, now)
+	if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+	ctx.sendVerification(req, user, verificationToken)
+	ctx.setSessionCookie(w, token, session.ExpiresAt)
+	http.Redirect(w, req, next, http.StatusSeeOther)
+}
+
+func (ctx *Account) serveLogin(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username := strings.TrimSpace(req.PostForm.Get("username"))
+	next := safeRedirectTarget(req.PostForm.Get("next"))
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	userStore := repository.NewUserStore(tx)
+	user, err := service.NewAccountService(userStore).Authenticate(username, req.PostForm.Get("password"))
+	if err == service.ErrInvalidCredentials {
+		w.WriteHeader(http.StatusUnauthorized)
+		ctx.render(w, req, "login", map[string]interface{}{
+			"Username": username,
+			"Next":     next,
+			"Error":    ctx.localizeError(req, err),
+		})
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	token, session, err := service.NewSessionService(repository.NewSessionStore(tx), userStore).Start(user.ID, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+	ctx.setSessionCookie(w, token, session.ExpiresAt)
+	http.Redirect(w, req, next, http.StatusSeeOther)
+}
+
+func (ctx *Account) serveLogout(w http.ResponseWriter, req *http.Request) {
+	cookie, err := req.Cookie(sessionCookieName)
+	if err == nil && cookie.Value != "" {
+		tx := ctx.Tx()
+		defer tx.Rollback()
+		err = service.NewSessionService(repository.NewSessionStore(tx), repository.NewUserStore(tx)).End(cookie.Value)
+		if err != nil {
+			panic(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			panic(err)
+		}
+	}
+	ctx.clearSessionCookie(w)
+	http.Redirect(w, req, "/random", http.StatusSeeOther)
+}
+
+func (ctx *Account) serveVerifyEmail(w http.ResponseWriter, req *http.Request) {
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	issued, err := service.NewTokenService(repository.NewTokenStore(tx)).Redeem(req.URL.Query().Get("token"), entity.TokenPurposeVerifyEmail, time.Now())
+	if err == core.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		ctx.renderMessage(w, req, invalidTokenMessage, true)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	userStore := repository.NewUserStore(tx)
+	user, err := userStore.Get(issued.UserID)
+	if err != nil {
+		panic(err)
+	}
+	err = service.NewAccountService(userStore).VerifyEmail(user, issued.Email)
+	if errors.Is(err, core.ErrInvalid) || errors.Is(err, core.ErrAlreadyExists) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.render(w, req, "account-message", map[string]interface{}{
+			"Error": ctx.localizeError(req, err),
+		})
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+	ctx.renderMessage(w, req, &i18n.Message{
+		ID:    "EmailVerified",
+		Other: "Your e-mail address has been verified",
+	}, false)
+}
+
+func (ctx *Account) serveSendVerification(w http.ResponseWriter, req *http.Request) {
+	user := requireUser(w, req)
+	if user == nil {
+		return
+	}
+	if user.EmailUnverified == "" {
+		http.Redirect(w, req, "/random", http.StatusSeeOther)
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+	token, err := service.NewTokenService(repository.NewTokenStore(tx)).Issue(user.ID, entity.TokenPurposeVerifyEmail, user.EmailUnverified, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+	ctx.sendVerification(req, user, token)
+	ctx.renderMessage(w, req, &i18n.Message{
+		ID:    "VerificationSent",
+		Other: "A link to verify your e-mail address has been sent",
+	}, false)
+}
+
+func (ctx *Account) serveForgotPassword(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(req.PostForm.Get("email"))
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	user, err := repository.NewUserStore(tx).GetByEmail(email)
+	if err == nil {
+		token, err := service.NewTokenService(repository.NewTokenStore(tx)).Issue(user.ID, entity.TokenPurposeResetPassword, email, time.Now())
+		if err != nil {
+			panic(err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			panic(err)
+		}
+		localizer := ctx.localizer(req)
+		ctx.send(&core.Mail{
+			To: email,
+			Subject: ctx.localize(localizer, &i18n.Message{
+				ID:    "ResetPasswordSubject",
+				Other: "Reset your kartoteka password",
+			}, nil),
+			Body: ctx.localize(localizer, &i18n.Message{
+				ID:    "ResetPasswordBody",
+				Other: "Someone asked to reset the password of the kartoteka user {{.Username}}. If it was you, open this link to choose a new password:\n\n{{.Link}}\n\nThe link expires in an hour. If you did not ask for this, you can ignore this e-mail.\n",
+			}, map[string]interface{}{
+				"Username": user.Username,
+				"Link":     ctx.baseURL + "/reset-password?token=" + url.QueryEscape(token),
+			}),
+		})
+	} else if err != core.ErrNotFound {
+		panic(err)
+	}
+
+	// The same response whether or not the address is registered, so as not
+	// to reveal who has an account
+	ctx.renderMessage(w, req, &i18n.Message{
+		ID:    "PasswordResetSent",
+		Other: "If the address belongs to an account, a link to reset the password has been sent to it",
+	}, false)
+}
+
+func (ctx *Account) serveResetPassword(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token := req.PostForm.Get("token")
+	password := req.PostForm.Get("password")
+	if password != req.PostForm.Get("password_repeated") {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.render(w, req, "reset-password", map[string]interface{}{
+			"Token": token,
+			"Error": ctx.localizeError(req, errPasswordsDoNotMatch),
+		})
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	issued, err := service.NewTokenService(repository.NewTokenStore(tx)).Redeem(token, entity.TokenPurposeResetPassword, time.Now())
+	if err == core.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		ctx.renderMessage(w, req, invalidTokenMessage, true)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	userStore := repository.NewUserStore(tx)
+	user, err := userStore.Get(issued.UserID)
+	if err != nil {
+		panic(err)
+	}
+	err = service.NewAccountService(userStore).SetPassword(user, password)
+	if errors.Is(err, core.ErrInvalid) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.render(w, req, "reset-password", map[string]interface{}{
+			"Token": token,
+			"Error": ctx.localizeError(req, err),
+		})
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	// Whoever knew the old password should not stay logged in
+	err = repository.NewSessionStore(tx).DeleteByUser(user.ID)
+	if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+	ctx.clearSessionCookie(w)
+	ctx.renderMessage(w, req, &i18n.Message{
+		ID:    "PasswordChanged",
+		Other: "Your password has been changed, and you can now log in with it",
+	}, false)
+}
+
+func (ctx *Account) sendVerification(req *http.Request, user *entity.User, token string) {
+	localizer := ctx.localizer(req)
+	ctx.send(&core.Mail{
+		To: user.EmailUnverified,
+		Subject: ctx.localize(localizer, &i18n.Message{
+			ID:    "VerifyEmailSubject",
+			Other: "Verify your e-mail address for kartoteka",
+		}, nil),
+		Body: ctx.localize(localizer, &i18n.Message{
+			ID:    "VerifyEmailBody",
+			Other: "Open this link to verify the e-mail address of the kartoteka user {{.Username}}:\n\n{{.Link}}\n\nThe link expires in a week.\n",
+		}, map[string]interface{}{
+			"Username": user.Username,
+			"Link":     ctx.baseURL + "/verify-email?token=" + url.QueryEscape(token),
+		}),
+	})
+}
+
+// Mail is sent after the transaction has been committed, and failures are
+// only logged, since the user can always ask for another link.
+func (ctx *Account) send(mail *core.Mail) {
+	err := ctx.mailer.Send(mail)
+	if err != nil {
+		log.Printf("Failed to send mail: %s", err)
+	}
+}
+
+// Only allows redirects to paths on this site after logging in.
+func safeRedirectTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/random"
+	}
+	return next
+}
@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// The usernames of the users allowed to administer the site
+type Admins map[string]bool
+
+func (admins Admins) Contains(user *entity.User) bool {
+	return user != nil && admins[user.Username]
+}
+
+// Serves /admin/languages
+type LanguageAdmin struct {
+	txProvider
+	templateProvider
+	i18nBundle *i18n.Bundle
+	admins     Admins
+}
+
+func NewLanguageAdmin(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle, admins Admins) *LanguageAdmin {
+	return &LanguageAdmin{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		i18nBundle:       i18nBundle,
+		admins:           admins,
+	}
+}
+
+type languageUsage struct {
+	*entity.Language
+	WordCount        int
+	TranslationCount int
+}
+
+func (ctx *LanguageAdmin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	user := requireUser(w, req)
+	if user == nil {
+		return
+	}
+	if !ctx.admins.Contains(user) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		tx := ctx.Tx()
+		defer tx.Rollback()
+		ctx.render(w, req, tx, map[string]interface{}{})
+	case http.MethodPost:
+		ctx.servePost(w, req)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctx *LanguageAdmin) render(w http.ResponseWriter, req *http.Request, tx *sql.Tx, pageData map[string]interface{}) {
+	languageStore := repository.NewLanguageStore(tx)
+	languages, err := languageStore.ListAll()
+	if err != nil {
+		panic(err)
+	}
+	usages := make([]*languageUsage, 0, len(languages))
+	for _, language := range languages {
+		wordCount, translationCount, err := languageStore.CountUsage(language.Code)
+		if err != nil {
+			panic(err)
+		}
+		usages = append(usages, &languageUsage{language, wordCount, translationCount})
+	}
+
+	pageData["Languages"] = usages
+	pageData["Localizer"] = i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+	pageData["User"] = UserFromContext(req.Context())
+	err = ctx.Template().ExecuteTemplate(w, "admin-languages", pageData)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Takes an 'action' of add, rename or delete, with 'code' and for add and
+// rename 'native_name'.
+func (ctx *LanguageAdmin) servePost(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	code := req.PostForm.Get("code")
+	nativeName := req.PostForm.Get("native_name")
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	languageService := service.NewLanguageService(repository.NewLanguageStore(tx))
+	switch req.PostForm.Get("action") {
+	case "add":
+		_, err = languageService.Add(code, nativeName)
+	case "rename":
+		_, err = languageService.Rename(code, nativeName)
+	case "delete":
+		err = languageService.Delete(code)
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, core.ErrInvalid) || errors.Is(err, core.ErrAlreadyExists) || errors.Is(err, core.ErrInUse) || err == core.ErrNotFound {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.render(w, req, tx, map[string]interface{}{
+			"Error": err.Error(),
+			"Code":  code,
+		})
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+	http.Redirect(w, req, req.URL.Path, http.StatusSeeOther)
+}
+
+// Serves /admin/tags
+type TagAdmin struct {
+	txProvider
+	templateProvider
+	i18nBundle *i18n.Bundle
+	admins     Admins
+}
+
+func NewTagAdmin(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle, admins Admins) *TagAdmin {
+	return &TagAdmin{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		i18nBundle:       i18nBundle,
+		admins:           admins,
+	}
+}
+
+// A tag change waiting to be confirmed, with the form values it was asked
+// for with
+type pendingTagChange struct {
+	Action string
+	Tag    string
+	NewTag string
+	Tags   string
+	Query  string
+	// The number of words the change would make changes to
+	Count int
+}
+
+func (ctx *TagAdmin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	user := requireUser(w, req)
+	if user == nil {
+		return
+	}
+	if !ctx.admins.Contains(user) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		tx := ctx.Tx()
+		defer tx.Rollback()
+		ctx.render(w, req, tx, map[string]interface{}{})
+	case http.MethodPost:
+		ctx.servePost(w, req)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctx *TagAdmin) render(w http.ResponseWriter, req *http.Request, tx *sql.Tx, pageData map[string]interface{}) {
+	tags, err := repository.NewTagStore(tx).ListNodes()
+	if err != nil {
+		panic(err)
+	}
+	pageData["Tags"] = tags
+	pageData["Localizer"] = i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+	pageData["User"] = UserFromContext(req.Context())
+	err = ctx.Template().ExecuteTemplate(w, "admin-tags", pageData)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Takes an 'action' of rename, merge, delete, add or remove, with 'tag' for
+// all but merge, 'new_tag' for rename and merge, 'tags' separated by spaces
+// for merge, and 'q' for add and remove. The change is made and the number
+// of words it changed is shown, but it is only committed when sent again
+// with 'confirm'.
+func (ctx *TagAdmin) servePost(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	change := &pendingTagChange{
+		Action: req.PostForm.Get("action"),
+		Tag:    strings.TrimSpace(req.PostForm.Get("tag")),
+		NewTag: strings.TrimSpace(req.PostForm.Get("new_tag")),
+		Tags:   req.PostForm.Get("tags"),
+		Query:  req.PostForm.Get("q"),
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	tagService := service.NewTagService(repository.NewTagStore(tx), repository.NewWordStore(tx))
+	switch change.Action {
+	case "rename":
+		change.Count, err = tagService.Rename(change.Tag, change.NewTag)
+	case "merge":
+		change.Count, err = tagService.Merge(strings.Fields(change.Tags), change.NewTag)
+	case "delete":
+		change.Count, err = tagService.Delete(change.Tag)
+	case "add", "remove":
+		var spec core.WordSpec
+		spec, err = syntax.ParseWordSpec(change.Query)
+		if err != nil {
+			err = fmt.Errorf("%w: %s", core.ErrInvalid, err)
+		} else if change.Action == "add" {
+			change.Count, err = tagService.AddToMatching(spec, change.Tag)
+		} else {
+			change.Count, err = tagService.RemoveFromMatching(spec, change.Tag)
+		}
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, core.ErrInvalid) {
+		// Refused before any word was changed
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ctx.render(w, req, tx, map[string]interface{}{
+			"Error": err.Error(),
+		})
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	if req.PostForm.Get("confirm") == "" {
+		// Shows the tags as they were
+		tx.Rollback()
+		tx = ctx.Tx()
+		defer tx.Rollback()
+		ctx.render(w, req, tx, map[string]interface{}{
+			"Pending": change,
+		})
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+	http.Redirect(w, req, req.URL.Path, http.StatusSeeOther)
+}
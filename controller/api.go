@@ -0,0 +1,567 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiPrefix          = "/api/v1/"
+	apiDefaultLimit    = 50
+	apiMaximumLimit    = 500
+	apiMaximumBodySize = 1 << 20
+)
+
+type API struct {
+	txProvider
+	blobStore    core.BlobStore
+	maxImageSize int64
+	admins       Admins
+}
+
+func NewAPI(db *sql.DB, blobStore core.BlobStore, maxImageSize int64, admins Admins) *API {
+	return &API{
+		txProvider:   txProvider{db},
+		blobStore:    blobStore,
+		maxImageSize: maxImageSize,
+		admins:       admins,
+	}
+}
+
+type apiWord struct {
+	ID           string            `json:"id"`
+	Word         string            `json:"word"`
+	LanguageCode string            `json:"language_code"`
+	Username     string            `json:"username,omitempty"`
+	Notes        string            `json:"notes"`
+	Translations []*apiTranslation `json:"translations"`
+	Tags         []string          `json:"tags"`
+	ImageURL     string            `json:"image_url,omitempty"`
+}
+
+type apiTranslation struct {
+	LanguageCode string `json:"language_code"`
+	Translation  string `json:"translation"`
+}
+
+type apiImage struct {
+	ID             string `json:"id"`
+	URL            string `json:"url"`
+	MimeType       string `json:"mime_type"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	License        string `json:"license"`
+	Attribution    string `json:"attribution"`
+	AttributionURL string `json:"attribution_url"`
+}
+
+type apiLanguage struct {
+	Code       string `json:"code"`
+	NativeName string `json:"native_name"`
+}
+
+type apiTag struct {
+	Tag       string `json:"tag"`
+	WordCount int    `json:"word_count"`
+}
+
+type apiList struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// An error with the HTTP status it should be reported with
+type apiStatusError struct {
+	status  int
+	message string
+}
+
+func (err *apiStatusError) Error() string {
+	return err.message
+}
+
+func apiErrorf(status int, format string, v ...interface{}) error {
+	return &apiStatusError{status, fmt.Sprintf(format, v...)}
+}
+
+func newAPIWord(word *entity.Word) *apiWord {
+	w := &apiWord{
+		ID:           word.ID.String,
+		Word:         word.Word,
+		LanguageCode: word.LanguageCode,
+		Username:     word.UserUsername,
+		Notes:        word.Notes,
+		Translations: make([]*apiTranslation, 0, len(word.Translations)),
+		Tags:         append([]string{}, word.Tags...),
+	}
+	for _, translation := range word.Translations {
+		w.Translations = append(w.Translations, &apiTranslation{
+			LanguageCode: translation.LanguageCode,
+			Translation:  translation.Translation,
+		})
+	}
+	if word.ImageID.Valid {
+		w.ImageURL = imageURL(word.ImageID)
+	}
+	return w
+}
+
+func (w *apiWord) toEntity(word *entity.Word) {
+	word.Word = w.Word
+	word.LanguageCode = w.LanguageCode
+	word.Notes = w.Notes
+	word.Translations = make([]*entity.WordTranslation, 0, len(w.Translations))
+	for _, translation := range w.Translations {
+		word.Translations = append(word.Translations, &entity.WordTranslation{
+			WordID:       word.ID,
+			LanguageCode: translation.LanguageCode,
+			Translation:  translation.Translation,
+		})
+	}
+	word.Tags = w.Tags
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.Split(strings.TrimPrefix(req.URL.Path, apiPrefix), "/")
+	resource := path[0]
+	var id, subresource string
+	if len(path) >= 2 {
+		id = path[1]
+	}
+	if len(path) == 3 {
+		subresource = path[2]
+	}
+	if len(path) > 3 || (len(path) >= 2 && id == "") || (len(path) == 3 && subresource == "") {
+		api.writeError(w, apiErrorf(http.StatusNotFound, "Not found"))
+		return
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && UserFromContext(req.Context()) == nil {
+		api.writeError(w, apiErrorf(http.StatusUnauthorized, "Logging in is required for changes"))
+		return
+	}
+
+	tx := api.Tx()
+	defer tx.Rollback()
+
+	var status int
+	var response interface{}
+	var unusedBlobKeys []string
+	var err error
+	switch {
+	case resource == "words" && subresource == "image":
+		status, response, unusedBlobKeys, err = api.serveWordImage(tx, req, id)
+	case subresource != "":
+		err = apiErrorf(http.StatusNotFound, "Not found")
+	case resource == "words" && id == "":
+		status, response, err = api.serveWords(tx, req)
+	case resource == "words":
+		status, response, unusedBlobKeys, err = api.serveWord(tx, req, id)
+	case resource == "languages" && id == "":
+		status, response, err = api.serveLanguages(tx, req)
+	case resource == "languages":
+		status, response, err = api.serveLanguage(tx, req, id)
+	case resource == "tags" && id == "":
+		status, response, err = api.serveTags(tx, req)
+	default:
+		err = apiErrorf(http.StatusNotFound, "Not found")
+	}
+	if err != nil {
+		api.writeError(w, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		api.writeError(w, err)
+		return
+	}
+	for _, blobKey := range unusedBlobKeys {
+		err = api.blobStore.Delete(blobKey)
+		if err != nil {
+			log.Printf("Failed to delete unused image blob %s: %s", blobKey, err)
+		}
+	}
+	api.writeJSON(w, status, response)
+}
+
+func (api *API) writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	if response == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (api *API) writeError(w http.ResponseWriter, err error) {
+	var statusErr *apiStatusError
+	status := http.StatusInternalServerError
+	message := http.StatusText(status)
+	switch {
+	case errors.As(err, &statusErr):
+		status = statusErr.status
+		message = statusErr.message
+	case errors.Is(err, core.ErrNotFound):
+		status = http.StatusNotFound
+		message = err.Error()
+	case errors.Is(err, core.ErrAlreadyExists), errors.Is(err, core.ErrInUse):
+		status = http.StatusConflict
+		message = err.Error()
+	case errors.Is(err, core.ErrInvalid):
+		status = http.StatusUnprocessableEntity
+		message = err.Error()
+	default:
+		log.Printf("Error serving API request: %s", err)
+	}
+	if status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", message)
+		message = http.StatusText(status)
+	}
+	api.writeJSON(w, status, &apiError{Error: message})
+}
+
+func (api *API) readJSON(req *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, req.Body, apiMaximumBodySize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		return apiErrorf(http.StatusBadRequest, "Invalid request body: %s", err)
+	}
+	return nil
+}
+
+func apiMethodNotAllowed(allowed string) error {
+	return &apiStatusError{http.StatusMethodNotAllowed, allowed}
+}
+
+func (api *API) parseRange(req *http.Request) (int, int, error) {
+	offset := 0
+	limit := apiDefaultLimit
+	var err error
+	if s := req.URL.Query().Get("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, apiErrorf(http.StatusBadRequest, "Invalid offset '%s'", s)
+		}
+	}
+	if s := req.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > apiMaximumLimit {
+			return 0, 0, apiErrorf(http.StatusBadRequest, "Invalid limit '%s', must be between 1 and %d", s, apiMaximumLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+func (api *API) serveWords(tx *sql.Tx, req *http.Request) (int, interface{}, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		var spec core.WordSpec = core.AnyWordSpec{}
+		if q := req.URL.Query().Get("q"); q != "" {
+			var err error
+			spec, err = syntax.ParseWordSpec(q)
+			if err != nil {
+				return 0, nil, apiErrorf(http.StatusBadRequest, "Invalid query: %s", strings.TrimSpace(err.Error()))
+			}
+		}
+		offset, limit, err := api.parseRange(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		wordStore := repository.NewWordStore(tx)
+		query := &core.WordQuery{Spec: spec, OrderByRelevance: true}
+		total, err := wordStore.Count(query)
+		if err != nil {
+			return 0, nil, err
+		}
+		words, err := wordStore.List(query.SetRange(offset, limit))
+		if err != nil {
+			return 0, nil, err
+		}
+		items := make([]*apiWord, 0, len(words))
+		for _, word := range words {
+			items = append(items, newAPIWord(word))
+		}
+		return http.StatusOK, &apiList{
+			Items:  items,
+			Total:  total,
+			Offset: offset,
+			Limit:  limit,
+		}, nil
+
+	case http.MethodPost:
+		var body apiWord
+		err := api.readJSON(req, &body)
+		if err != nil {
+			return 0, nil, err
+		}
+		user := UserFromContext(req.Context())
+		word := &entity.Word{
+			ID:     entity.WordID(entity.NewID()),
+			UserID: user.ID,
+		}
+		body.toEntity(word)
+		wordStore := repository.NewWordStore(tx)
+		err = service.NewWordService(wordStore, repository.NewLanguageStore(tx)).Add(word)
+		if err != nil {
+			return 0, nil, err
+		}
+		word, err = wordStore.Get(word.ID)
+		if err != nil {
+			return 0, nil, err
+		}
+		return http.StatusCreated, newAPIWord(word), nil
+
+	default:
+		return 0, nil, apiMethodNotAllowed("GET, HEAD, POST")
+	}
+}
+
+func (api *API) serveWord(tx *sql.Tx, req *http.Request, id string) (int, interface{}, []string, error) {
+	var wordID entity.WordID
+	err := wordID.Scan(id)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	wordStore := repository.NewWordStore(tx)
+	word, err := wordStore.Get(wordID)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && word.UserID != UserFromContext(req.Context()).ID {
+		return 0, nil, nil, apiErrorf(http.StatusForbidden, "Only the owner of a word can change it")
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return http.StatusOK, newAPIWord(word), nil, nil
+
+	case http.MethodPut:
+		var body apiWord
+		err = api.readJSON(req, &body)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if body.ID != "" && body.ID != word.ID.String {
+			return 0, nil, nil, apiErrorf(http.StatusBadRequest, "The word ID in the body does not match the URL")
+		}
+		body.toEntity(word)
+		err = service.NewWordService(wordStore, repository.NewLanguageStore(tx)).Update(word)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		word, err = wordStore.Get(word.ID)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		return http.StatusOK, newAPIWord(word), nil, nil
+
+	case http.MethodDelete:
+		// Detached first, so that the image is deleted along with the word
+		// unless other words use it
+		imageService := service.NewImageService(repository.NewImageStore(tx), wordStore, api.blobStore, api.maxImageSize)
+		unusedBlobKeys, err := imageService.Detach(word)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		err = wordStore.Delete(word.ID)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		return http.StatusNoContent, nil, unusedBlobKeys, nil
+
+	default:
+		return 0, nil, nil, apiMethodNotAllowed("GET, HEAD, PUT, DELETE")
+	}
+}
+
+// Takes a multipart form with the image in the 'image' field, and 'license',
+// 'attribution' and 'attribution_url' fields.
+func (api *API) serveWordImage(tx *sql.Tx, req *http.Request, id string) (int, interface{}, []string, error) {
+	var wordID entity.WordID
+	err := wordID.Scan(id)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	wordStore := repository.NewWordStore(tx)
+	word, err := wordStore.Get(wordID)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return 0, nil, nil, apiMethodNotAllowed("POST, DELETE")
+	}
+	if word.UserID != UserFromContext(req.Context()).ID {
+		return 0, nil, nil, apiErrorf(http.StatusForbidden, "Only the owner of a word can change it")
+	}
+	imageService := service.NewImageService(repository.NewImageStore(tx), wordStore, api.blobStore, api.maxImageSize)
+
+	switch req.Method {
+	case http.MethodPost:
+		req.Body = http.MaxBytesReader(nil, req.Body, api.maxImageSize+apiMaximumBodySize)
+		err = req.ParseMultipartForm(apiMaximumBodySize)
+		if err != nil {
+			return 0, nil, nil, apiErrorf(http.StatusBadRequest, "Invalid request body: %s", err)
+		}
+		defer req.MultipartForm.RemoveAll()
+		file, _, err := req.FormFile("image")
+		if err != nil {
+			return 0, nil, nil, apiErrorf(http.StatusBadRequest, "Missing 'image' field: %s", err)
+		}
+		defer file.Close()
+		image := &entity.Image{
+			License:        req.FormValue("license"),
+			Attribution:    req.FormValue("attribution"),
+			AttributionUrl: req.FormValue("attribution_url"),
+		}
+		unusedBlobKeys, err := imageService.Attach(word, image, file)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		return http.StatusCreated, &apiImage{
+			ID:             image.ID.String,
+			URL:            imageURL(image.ID),
+			MimeType:       image.MimeType,
+			Width:          image.Width,
+			Height:         image.Height,
+			License:        image.License,
+			Attribution:    image.Attribution,
+			AttributionURL: image.AttributionUrl,
+		}, unusedBlobKeys, nil
+
+	case http.MethodDelete:
+		unusedBlobKeys, err := imageService.Detach(word)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		return http.StatusNoContent, nil, unusedBlobKeys, nil
+
+	default:
+		return 0, nil, nil, apiMethodNotAllowed("POST, DELETE")
+	}
+}
+
+func (api *API) serveLanguages(tx *sql.Tx, req *http.Request) (int, interface{}, error) {
+	languageStore := repository.NewLanguageStore(tx)
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		languages, err := languageStore.ListAll()
+		if err != nil {
+			return 0, nil, err
+		}
+		items := make([]*apiLanguage, 0, len(languages))
+		for _, language := range languages {
+			items = append(items, &apiLanguage{language.Code, language.NativeName})
+		}
+		return http.StatusOK, &apiList{
+			Items: items,
+			Total: len(items),
+			Limit: len(items),
+		}, nil
+
+	case http.MethodPost:
+		if !api.admins.Contains(UserFromContext(req.Context())) {
+			return 0, nil, apiErrorf(http.StatusForbidden, "Only administrators can change languages")
+		}
+		var body apiLanguage
+		err := api.readJSON(req, &body)
+		if err != nil {
+			return 0, nil, err
+		}
+		language, err := service.NewLanguageService(languageStore).Add(body.Code, body.NativeName)
+		if err != nil {
+			return 0, nil, err
+		}
+		return http.StatusCreated, &apiLanguage{language.Code, language.NativeName}, nil
+
+	default:
+		return 0, nil, apiMethodNotAllowed("GET, HEAD, POST")
+	}
+}
+
+func (api *API) serveLanguage(tx *sql.Tx, req *http.Request, code string) (int, interface{}, error) {
+	languageStore := repository.NewLanguageStore(tx)
+	language, err := languageStore.Get(code)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead && !api.admins.Contains(UserFromContext(req.Context())) {
+		return 0, nil, apiErrorf(http.StatusForbidden, "Only administrators can change languages")
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return http.StatusOK, &apiLanguage{language.Code, language.NativeName}, nil
+
+	case http.MethodPut:
+		var body apiLanguage
+		err = api.readJSON(req, &body)
+		if err != nil {
+			return 0, nil, err
+		}
+		if body.Code != "" && body.Code != language.Code {
+			return 0, nil, apiErrorf(http.StatusBadRequest, "The language code in the body does not match the URL")
+		}
+		language, err = service.NewLanguageService(languageStore).Rename(language.Code, body.NativeName)
+		if err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, &apiLanguage{language.Code, language.NativeName}, nil
+
+	case http.MethodDelete:
+		err = service.NewLanguageService(languageStore).Delete(language.Code)
+		if err != nil {
+			return 0, nil, err
+		}
+		return http.StatusNoContent, nil, nil
+
+	default:
+		return 0, nil, apiMethodNotAllowed("GET, HEAD, PUT, DELETE")
+	}
+}
+
+func (api *API) serveTags(tx *sql.Tx, req *http.Request) (int, interface{}, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		tags, err := repository.NewTagStore(tx).ListAll()
+		if err != nil {
+			return 0, nil, err
+		}
+		items := make([]*apiTag, 0, len(tags))
+		for _, tag := range tags {
+			items = append(items, &apiTag{tag.Tag, tag.WordCount})
+		}
+		return http.StatusOK, &apiList{
+			Items: items,
+			Total: len(items),
+			Limit: len(items),
+		}, nil
+
+	default:
+		return 0, nil, apiMethodNotAllowed("GET, HEAD")
+	}
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"net/http"
+	"sync"
+)
+
+// requestedCardDirection returns the direction chosen with the direction
+// parameter, or else with a dir: operator the spec requires, or the empty
+// direction if neither is given.
+func requestedCardDirection(req *http.Request, spec core.WordSpec) core.CardDirection {
+	direction := core.CardDirection(req.FormValue("direction"))
+	if direction.Valid() {
+		return direction
+	}
+	return specCardDirection(spec)
+}
+
+func specCardDirection(spec core.WordSpec) core.CardDirection {
+	switch s := spec.(type) {
+	case core.DirectionWordSpec:
+		return core.CardDirection(s)
+	case *core.AndWordSpec:
+		if direction := specCardDirection(s.Left); direction != "" {
+			return direction
+		}
+		return specCardDirection(s.Right)
+	default:
+		return ""
+	}
+}
+
+// drawCardDirection picks forward or reverse for a card shown in both
+// directions.
+func drawCardDirection(direction core.CardDirection, rng core.Rand, rngMutex *sync.Mutex) core.CardDirection {
+	if direction != core.CardDirectionBoth {
+		return direction
+	}
+	rngMutex.Lock()
+	defer rngMutex.Unlock()
+	if rng.Int()%2 == 0 {
+		return core.CardDirectionForward
+	}
+	return core.CardDirectionReverse
+}
+
+// specTranslationLanguage returns the language of the first translation the
+// spec requires, or the empty string if it requires none.
+func specTranslationLanguage(spec core.WordSpec) string {
+	switch s := spec.(type) {
+	case core.TranslationWordSpec:
+		return string(s)
+	case *core.AndWordSpec:
+		if languageCode := specTranslationLanguage(s.Left); languageCode != "" {
+			return languageCode
+		}
+		return specTranslationLanguage(s.Right)
+	default:
+		return ""
+	}
+}
+
+// promptTranslations returns the translations of the word shown first on a
+// reversed card, those in the given language or all of them.
+func promptTranslations(word *entity.Word, languageCode string) []*entity.WordTranslation {
+	if languageCode == "" {
+		return word.Translations
+	}
+	translations := []*entity.WordTranslation{}
+	for _, translation := range word.Translations {
+		if translation.LanguageCode == languageCode {
+			translations = append(translations, translation)
+		}
+	}
+	return translations
+}
+
+// setCardDirection sets the page data templates show a card in the given
+// direction with. Without a direction, the whole card is shown at once. A
+// card is shown forward if the word has no translations to show first.
+func setCardDirection(pageData map[string]interface{}, word *entity.Word, spec core.WordSpec, direction core.CardDirection) {
+	if direction == core.CardDirectionReverse {
+		translations := promptTranslations(word, specTranslationLanguage(spec))
+		if len(translations) != 0 {
+			pageData["Reverse"] = true
+			pageData["PromptTranslations"] = translations
+			return
+		}
+		direction = core.CardDirectionForward
+	}
+	if direction == core.CardDirectionForward {
+		pageData["Forward"] = true
+	}
+}
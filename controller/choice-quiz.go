@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// How many translations to choose among, the right one included
+const choiceQuizChoices = 4
+
+type ChoiceQuiz struct {
+	txProvider
+	templateProvider
+	rng        *rand.Rand
+	rngMutex   sync.Mutex
+	i18nBundle *i18n.Bundle
+}
+
+func NewChoiceQuiz(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle) *ChoiceQuiz {
+	return &ChoiceQuiz{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		rng:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		i18nBundle:       i18nBundle,
+	}
+}
+
+func (ctx *ChoiceQuiz) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		ctx.serveQuestion(w, req)
+	case http.MethodPost:
+		ctx.serveAnswer(w, req)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctx *ChoiceQuiz) serveQuestion(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get("q")
+	if q == "" {
+		http.Redirect(w, req, "/random", http.StatusSeeOther)
+		return
+	}
+
+	localizer := i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+	pageData := map[string]interface{}{
+		"Spec":      q,
+		"Localizer": localizer,
+		"User":      UserFromContext(req.Context()),
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	var question *service.ChoiceQuestion
+	var languageNativeNameMap map[string]string
+
+	wordSpec, err := syntax.ParseWordSpec(q)
+	if err != nil {
+		pageData["Error"] = err.Error()
+		goto render
+	}
+
+	languageNativeNameMap, err = service.NewLanguageService(repository.NewLanguageStore(tx)).GetNativeNameMap()
+	if err != nil {
+		panic(err)
+	}
+	pageData["LanguageNativeNameMap"] = languageNativeNameMap
+
+	ctx.rngMutex.Lock()
+	question, err = service.NewChoiceQuiz(repository.NewWordStore(tx), wordSpec, ctx.rng).
+		NewQuestion(specTranslationLanguage(wordSpec), choiceQuizChoices)
+	ctx.rngMutex.Unlock()
+	if err == core.ErrNotFound {
+		msg, err := localizer.Localize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "NoMatches",
+				Other: "No entries match that query",
+			},
+		})
+		if err != nil {
+			panic(fmt.Errorf("Localization error: %w", err))
+		}
+		pageData["Error"] = msg
+		goto render
+	} else if err != nil {
+		panic(err)
+	}
+	pageData["Word"] = question.Word
+	pageData["AnswerLanguage"] = question.AnswerLanguage
+	pageData["Choices"] = question.Choices
+
+render:
+	err = ctx.Template().ExecuteTemplate(w, "choice-quiz-question", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func (ctx *ChoiceQuiz) serveAnswer(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, quizMaximumBodySize)
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var wordID entity.WordID
+	err = wordID.Scan(req.PostForm.Get("word_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	answerLanguage := req.PostForm.Get("answer_language")
+	choice := req.PostForm.Get("choice")
+	if utf8.RuneCountInString(choice) > service.MaximumAnswerLength {
+		http.Error(w, fmt.Sprintf("The choice is longer than %d characters", service.MaximumAnswerLength), http.StatusBadRequest)
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	word, err := repository.NewWordStore(tx).Get(wordID)
+	if err == core.ErrNotFound {
+		http.Error(w, "No such word", http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	languageNativeNameMap, err := service.NewLanguageService(repository.NewLanguageStore(tx)).GetNativeNameMap()
+	if err != nil {
+		panic(err)
+	}
+
+	correct := service.IsCorrectChoice(word, answerLanguage, choice)
+	user := UserFromContext(req.Context())
+	pageData := map[string]interface{}{
+		"Spec":                  req.PostForm.Get("q"),
+		"Localizer":             i18n.NewLocalizer(ctx.i18nBundle, word.LanguageCode, req.Header.Get("Accept-Language")),
+		"User":                  user,
+		"Word":                  word,
+		"LanguageNativeNameMap": languageNativeNameMap,
+		"Choice":                choice,
+		"AnswerLanguage":        answerLanguage,
+		"Correct":               correct,
+	}
+
+	if user != nil {
+		quizResultStore := repository.NewQuizResultStore(tx)
+		err = quizResultStore.Add(&entity.QuizResult{
+			ID:         entity.QuizResultID(entity.NewID()),
+			UserID:     user.ID,
+			WordID:     word.ID,
+			Mode:       entity.QuizModeChoice,
+			Correct:    correct,
+			AnsweredAt: time.Now(),
+		})
+		if err != nil {
+			panic(err)
+		}
+		answered, correctCount, err := quizResultStore.CountByUser(user.ID, entity.QuizModeChoice)
+		if err != nil {
+			panic(err)
+		}
+		pageData["AnsweredCount"] = answered
+		pageData["CorrectCount"] = correctCount
+	}
+
+	err = ctx.Template().ExecuteTemplate(w, "choice-quiz-result", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
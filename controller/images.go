@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const imagesPrefix = "/images/"
+
+// Serves /images/{id}, and the scaled down variants of images at
+// /images/{id}/{width}
+type Images struct {
+	txProvider
+	blobStore core.BlobStore
+}
+
+func NewImages(db *sql.DB, blobStore core.BlobStore) *Images {
+	return &Images{
+		txProvider: txProvider{db},
+		blobStore:  blobStore,
+	}
+}
+
+func imageURL(id entity.ImageID) string {
+	return imagesPrefix + id.String
+}
+
+func imageVariantURL(variant *entity.ImageVariant) string {
+	return fmt.Sprintf("%s%s/%d", imagesPrefix, variant.ImageID.String, variant.Width)
+}
+
+// Lists the variants and the image itself for the srcset attribute of img
+// elements.
+func imageSrcset(image *entity.Image, variants []*entity.ImageVariant) string {
+	candidates := make([]string, 0, len(variants)+1)
+	for _, variant := range variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", imageVariantURL(variant), variant.Width))
+	}
+	if image.Width != 0 {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", imageURL(image.ID), image.Width))
+	}
+	return strings.Join(candidates, ", ")
+}
+
+func (ctx *Images) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(req.URL.Path, imagesPrefix), "/")
+	if len(path) > 2 {
+		http.NotFound(w, req)
+		return
+	}
+	var id entity.ImageID
+	err := id.Scan(path[0])
+	if err != nil {
+		panic(err)
+	}
+	width := 0
+	if len(path) == 2 {
+		width, err = strconv.Atoi(path[1])
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+	}
+
+	tx := ctx.Tx()
+	mimeType, blobKey, err := ctx.lookup(tx, id, width)
+	tx.Rollback()
+	if err == core.ErrNotFound {
+		http.NotFound(w, req)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	blob, err := ctx.blobStore.Open(blobKey)
+	if err == core.ErrNotFound {
+		http.NotFound(w, req)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	defer blob.Close()
+
+	// A new upload always gets a new image ID, so the content behind an ID
+	// never changes
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+blobKey+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, req, "", time.Time{}, blob)
+}
+
+// Returns the MIME type and blob key of the image, or of its variant of the
+// given width if it is not 0.
+func (ctx *Images) lookup(tx *sql.Tx, id entity.ImageID, width int) (string, string, error) {
+	imageStore := repository.NewImageStore(tx)
+	if width == 0 {
+		image, err := imageStore.Get(id)
+		if err != nil {
+			return "", "", err
+		}
+		return image.MimeType, image.BlobKey, nil
+	}
+	variant, err := imageStore.GetVariant(id, width)
+	if err != nil {
+		return "", "", err
+	}
+	return variant.MimeType, variant.BlobKey, nil
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The answer form holds only a few short fields
+const quizMaximumBodySize = 1 << 14
+
+type Quiz struct {
+	txProvider
+	templateProvider
+	rng        *rand.Rand
+	rngMutex   sync.Mutex
+	i18nBundle *i18n.Bundle
+}
+
+func NewQuiz(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle) *Quiz {
+	return &Quiz{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		rng:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		i18nBundle:       i18nBundle,
+	}
+}
+
+func (ctx *Quiz) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		ctx.serveQuestion(w, req)
+	case http.MethodPost:
+		ctx.serveAnswer(w, req)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// quizAnswers returns the translations of the word in the answer language,
+// or in any language if none is given, or the word itself if the card is
+// reversed.
+func quizAnswers(word *entity.Word, answerLanguage string, reversed bool) []service.AcceptedAnswer {
+	if reversed {
+		return []service.AcceptedAnswer{{
+			Text:         word.Word,
+			LanguageCode: word.LanguageCode,
+		}}
+	}
+	answers := []service.AcceptedAnswer{}
+	for _, translation := range word.Translations {
+		if answerLanguage == "" || translation.LanguageCode == answerLanguage {
+			answers = append(answers, service.AcceptedAnswer{
+				Text:         translation.Translation,
+				LanguageCode: translation.LanguageCode,
+			})
+		}
+	}
+	return answers
+}
+
+func (ctx *Quiz) serveQuestion(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get("q")
+	if q == "" {
+		http.Redirect(w, req, "/random", http.StatusSeeOther)
+		return
+	}
+
+	localizer := i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+	pageData := map[string]interface{}{
+		"Spec":      q,
+		"Direction": req.URL.Query().Get("direction"),
+		"Localizer": localizer,
+		"User":      UserFromContext(req.Context()),
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	var word *entity.Word
+	var answerLanguage string
+	var languageNativeNameMap map[string]string
+
+	wordSpec, err := syntax.ParseWordSpec(q)
+	if err != nil {
+		pageData["Error"] = err.Error()
+		goto render
+	}
+
+	languageNativeNameMap, err = service.NewLanguageService(repository.NewLanguageStore(tx)).GetNativeNameMap()
+	if err != nil {
+		panic(err)
+	}
+	pageData["LanguageNativeNameMap"] = languageNativeNameMap
+
+	answerLanguage = specTranslationLanguage(wordSpec)
+	ctx.rngMutex.Lock()
+	word, err = service.NewWordLottery(repository.NewWordStore(tx), wordSpec, ctx.rng).DrawWord()
+	ctx.rngMutex.Unlock()
+	if err == core.ErrNotFound {
+		msg, err := localizer.Localize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "NoMatches",
+				Other: "No entries match that query",
+			},
+		})
+		if err != nil {
+			panic(fmt.Errorf("Localization error: %w", err))
+		}
+		pageData["Error"] = msg
+		goto render
+	} else if err != nil {
+		panic(err)
+	}
+	pageData["Word"] = word
+	pageData["AnswerLanguage"] = answerLanguage
+	// Only reversed cards are shown differently, since the answer is
+	// always hidden until it has been given
+	setCardDirection(pageData, word, wordSpec,
+		drawCardDirection(requestedCardDirection(req, wordSpec), ctx.rng, &ctx.rngMutex))
+
+render:
+	err = ctx.Template().ExecuteTemplate(w, "quiz-question", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func (ctx *Quiz) serveAnswer(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, quizMaximumBodySize)
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var wordID entity.WordID
+	err = wordID.Scan(req.PostForm.Get("word_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	answerLanguage := req.PostForm.Get("answer_language")
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	word, err := repository.NewWordStore(tx).Get(wordID)
+	if err == core.ErrNotFound {
+		http.Error(w, "No such word", http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	languageNativeNameMap, err := service.NewLanguageService(repository.NewLanguageStore(tx)).GetNativeNameMap()
+	if err != nil {
+		panic(err)
+	}
+
+	reversed := req.PostForm.Get("reversed") != ""
+	answer := req.PostForm.Get("answer")
+	if utf8.RuneCountInString(answer) > service.MaximumAnswerLength {
+		http.Error(w, fmt.Sprintf("The answer is longer than %d characters", service.MaximumAnswerLength), http.StatusBadRequest)
+		return
+	}
+	result := service.GradeAnswer(answer, quizAnswers(word, answerLanguage, reversed))
+
+	pageData := map[string]interface{}{
+		"Spec":                  req.PostForm.Get("q"),
+		"Direction":             req.PostForm.Get("direction"),
+		"Reverse":               reversed,
+		"Localizer":             i18n.NewLocalizer(ctx.i18nBundle, word.LanguageCode, req.Header.Get("Accept-Language")),
+		"User":                  UserFromContext(req.Context()),
+		"Word":                  word,
+		"LanguageNativeNameMap": languageNativeNameMap,
+		"Answer":                answer,
+		"AnswerLanguage":        answerLanguage,
+		"Result":                result,
+	}
+	err = ctx.Template().ExecuteTemplate(w, "quiz-result", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
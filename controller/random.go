@@ -63,7 +63,9 @@ func (ctx *Random) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if q == "" {
 		localizer := i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
 		pageData := map[string]interface{}{
+			"Direction": "",
 			"Localizer": localizer,
+			"User":      UserFromContext(req.Context()),
 		}
 		err = ctx.Template().ExecuteTemplate(w, "random-index", pageData)
 		if err != nil {
@@ -76,12 +78,24 @@ func (ctx *Random) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		var wordSpec core.WordSpec
 		var tx *sql.Tx
 		var languageNativeNameMap map[string]string
+		var user *entity.User
+		var scheduler core.Scheduler
+		order := req.URL.Query().Get("order")
+		if order == "due" {
+			user = requireUser(w, req)
+			if user == nil {
+				return
+			}
+		}
 
 		localizer := i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
 
 		pageData := map[string]interface{}{
 			"Spec":      q,
+			"Order":     order,
+			"Direction": req.URL.Query().Get("direction"),
 			"Localizer": localizer,
+			"User":      UserFromContext(req.Context()),
 		}
 
 		wordSpec, err = syntax.ParseWordSpec(q)
@@ -100,7 +114,18 @@ func (ctx *Random) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		pageData["LanguageNativeNameMap"] = languageNativeNameMap
 
 		wordStore = repository.NewWordStore(tx)
-		wordLottery = service.NewWordLottery(wordStore, wordSpec, ctx.rng)
+		switch order {
+		case "due":
+			scheduler, err = service.GetUserScheduler(repository.NewSchedulerSettingsStore(tx), user.ID)
+			if err != nil {
+				panic(err)
+			}
+			wordLottery = service.NewDueWordLottery(
+				service.NewReviewQueue(repository.NewReviewStore(tx), scheduler, user.ID, wordSpec),
+				time.Now())
+		default:
+			wordLottery = service.NewWordLottery(wordStore, wordSpec, ctx.rng)
+		}
 		word, err = wordLottery.DrawWord()
 		if err == core.ErrNotFound {
 			msg, err := localizer.Localize(&i18n.LocalizeConfig{
@@ -119,6 +144,22 @@ func (ctx *Random) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 		pageData["Word"] = word
 		pageData["Localizer"] = i18n.NewLocalizer(ctx.i18nBundle, word.LanguageCode, req.Header.Get("Accept-Language"))
+		setCardDirection(pageData, word, wordSpec,
+			drawCardDirection(requestedCardDirection(req, wordSpec), ctx.rng, &ctx.rngMutex))
+		if word.ImageID.Valid {
+			imageStore := repository.NewImageStore(tx)
+			image, err := imageStore.Get(word.ImageID)
+			if err != nil {
+				panic(err)
+			}
+			variants, err := imageStore.ListVariants(image.ID)
+			if err != nil {
+				panic(err)
+			}
+			pageData["Image"] = image
+			pageData["ImageURL"] = imageURL(image.ID)
+			pageData["ImageSrcset"] = imageSrcset(image, variants)
+		}
 
 	render:
 		err = ctx.Template().ExecuteTemplate(w, "random-word", pageData)
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Review struct {
+	txProvider
+	templateProvider
+	rng        *rand.Rand
+	rngMutex   sync.Mutex
+	i18nBundle *i18n.Bundle
+}
+
+func NewReview(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle) *Review {
+	return &Review{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		rng:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		i18nBundle:       i18nBundle,
+	}
+}
+
+func (ctx *Review) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if requireUser(w, req) == nil {
+		return
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		ctx.serveCard(w, req)
+	case http.MethodPost:
+		if req.URL.Path == "/review/settings" {
+			ctx.serveSettings(w, req)
+		} else {
+			ctx.serveGrade(w, req)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctx *Review) serveIndex(w http.ResponseWriter, req *http.Request, localizer *i18n.Localizer) {
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	user := UserFromContext(req.Context())
+	settings, err := repository.NewSchedulerSettingsStore(tx).Get(user.ID)
+	if err == core.ErrNotFound {
+		settings = &entity.SchedulerSettings{
+			UserID:           user.ID,
+			Algorithm:        entity.SchedulerAlgorithmSM2,
+			DesiredRetention: 0.9,
+		}
+	} else if err != nil {
+		panic(err)
+	}
+
+	pageData := map[string]interface{}{
+		"Direction":         "",
+		"Localizer":         localizer,
+		"SchedulerSettings": settings,
+		"User":              user,
+	}
+	err = ctx.Template().ExecuteTemplate(w, "review-index", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func (ctx *Review) serveSettings(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	desiredRetention, err := strconv.ParseFloat(req.PostForm.Get("desired_retention"), 64)
+	if err != nil {
+		http.Error(w, "Invalid desired retention", http.StatusBadRequest)
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	user := UserFromContext(req.Context())
+	settingsStore := repository.NewSchedulerSettingsStore(tx)
+	settings, err := settingsStore.Get(user.ID)
+	if err == core.ErrNotFound {
+		settings = &entity.SchedulerSettings{
+			UserID: user.ID,
+		}
+	} else if err != nil {
+		panic(err)
+	}
+	settings.Algorithm = req.PostForm.Get("algorithm")
+	settings.DesiredRetention = desiredRetention
+	_, err = service.NewScheduler(settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = settingsStore.Update(settings)
+	if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+
+	http.Redirect(w, req, "/review", http.StatusSeeOther)
+}
+
+func (ctx *Review) serveCard(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get("q")
+	localizer := i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+	if q == "" {
+		ctx.serveIndex(w, req, localizer)
+		return
+	}
+
+	var word *entity.Word
+	var wordSpec core.WordSpec
+	var user *entity.User
+	var reviewQueue core.ReviewQueue
+	var scheduler core.Scheduler
+	var languageNativeNameMap map[string]string
+	var dueCount int
+	now := time.Now()
+
+	pageData := map[string]interface{}{
+		"Spec":      q,
+		"Direction": req.URL.Query().Get("direction"),
+		"Localizer": localizer,
+		"User":      UserFromContext(req.Context()),
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	wordSpec, err := syntax.ParseWordSpec(q)
+	if err != nil {
+		pageData["Error"] = err.Error()
+		goto render
+	}
+
+	languageNativeNameMap, err = service.NewLanguageService(repository.NewLanguageStore(tx)).GetNativeNameMap()
+	if err != nil {
+		panic(err)
+	}
+	pageData["LanguageNativeNameMap"] = languageNativeNameMap
+
+	user = UserFromContext(req.Context())
+
+	dueCount, err = repository.NewReviewStore(tx).CountDue(user.ID, &core.WordQuery{Spec: wordSpec}, now)
+	if err != nil {
+		panic(err)
+	}
+	pageData["DueCount"] = dueCount
+
+	scheduler, err = service.GetUserScheduler(repository.NewSchedulerSettingsStore(tx), user.ID)
+	if err != nil {
+		panic(err)
+	}
+	reviewQueue = service.NewReviewQueue(repository.NewReviewStore(tx), scheduler, user.ID, wordSpec)
+	word, err = reviewQueue.NextWord(now)
+	if err == core.ErrNotFound {
+		msg, err := localizer.Localize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "NothingToReview",
+				Other: "No entries matching that query are due for review",
+			},
+		})
+		if err != nil {
+			panic(fmt.Errorf("Localization error: %w", err))
+		}
+		pageData["Error"] = msg
+		goto render
+	} else if err != nil {
+		panic(err)
+	}
+	pageData["Word"] = word
+	pageData["Localizer"] = i18n.NewLocalizer(ctx.i18nBundle, word.LanguageCode, req.Header.Get("Accept-Language"))
+	setCardDirection(pageData, word, wordSpec,
+		drawCardDirection(requestedCardDirection(req, wordSpec), ctx.rng, &ctx.rngMutex))
+
+render:
+	err = ctx.Template().ExecuteTemplate(w, "review-card", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func (ctx *Review) serveGrade(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := req.PostForm.Get("q")
+	var wordID entity.WordID
+	err = wordID.Scan(req.PostForm.Get("word_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gradeNumber, err := strconv.Atoi(req.PostForm.Get("grade"))
+	if err != nil || !entity.Grade(gradeNumber).Valid() {
+		http.Error(w, "Invalid grade", http.StatusBadRequest)
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	user := UserFromContext(req.Context())
+
+	_, err = repository.NewWordStore(tx).Get(wordID)
+	if err == core.ErrNotFound {
+		http.Error(w, "No such word", http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	scheduler, err := service.GetUserScheduler(repository.NewSchedulerSettingsStore(tx), user.ID)
+	if err != nil {
+		panic(err)
+	}
+	reviewQueue := service.NewReviewQueue(repository.NewReviewStore(tx), scheduler, user.ID, core.AnyWordSpec{})
+	_, err = reviewQueue.Grade(wordID, entity.Grade(gradeNumber), time.Now())
+	if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+
+	values := url.Values{"q": {q}}
+	if direction := req.PostForm.Get("direction"); direction != "" {
+		values.Set("direction", direction)
+	}
+	http.Redirect(w, req, "/review?"+values.Encode(), http.StatusSeeOther)
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"database/sql"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const searchPageSize = 25
+
+type Search struct {
+	txProvider
+	templateProvider
+	i18nBundle *i18n.Bundle
+}
+
+func NewSearch(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle) *Search {
+	return &Search{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		i18nBundle:       i18nBundle,
+	}
+}
+
+func (ctx *Search) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get("q")
+	if q == "" {
+		http.Redirect(w, req, "/random", http.StatusSeeOther)
+		return
+	}
+	offset, err := strconv.Atoi(req.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	localizer := i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+	pageData := map[string]interface{}{
+		"Spec":      q,
+		"Localizer": localizer,
+		"User":      UserFromContext(req.Context()),
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	wordSpec, err := syntax.ParseWordSpec(q)
+	if err != nil {
+		pageData["Error"] = err.Error()
+	} else {
+		languageNativeNameMap, err := service.NewLanguageService(repository.NewLanguageStore(tx)).GetNativeNameMap()
+		if err != nil {
+			panic(err)
+		}
+		pageData["LanguageNativeNameMap"] = languageNativeNameMap
+
+		wordStore := repository.NewWordStore(tx)
+		query := &core.WordQuery{
+			Spec:             wordSpec,
+			OrderByRelevance: true,
+		}
+		total, err := wordStore.Count(query)
+		if err != nil {
+			panic(err)
+		}
+		words, err := wordStore.List(query.SetRange(offset, searchPageSize))
+		if err != nil {
+			panic(err)
+		}
+		pageData["Words"] = words
+		pageData["Total"] = total
+		if offset > 0 {
+			previous := offset - searchPageSize
+			if previous < 0 {
+				previous = 0
+			}
+			pageData["PreviousURL"] = searchURL(q, previous)
+		}
+		if offset+searchPageSize < total {
+			pageData["NextURL"] = searchURL(q, offset+searchPageSize)
+		}
+	}
+
+	err = ctx.Template().ExecuteTemplate(w, "search-results", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func searchURL(q string, offset int) string {
+	values := url.Values{"q": {q}}
+	if offset != 0 {
+		values.Set("offset", strconv.Itoa(offset))
+	}
+	return "/search?" + values.Encode()
+}
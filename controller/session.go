@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const sessionCookieName = "kartoteka_session"
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+func withUser(ctx context.Context, user *entity.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// Returns the logged in user, or nil.
+func UserFromContext(ctx context.Context) *entity.User {
+	user, _ := ctx.Value(userContextKey).(*entity.User)
+	return user
+}
+
+// Puts the user of the session cookie, if any, in the request context.
+type Authenticator struct {
+	txProvider
+	handler http.Handler
+}
+
+func NewAuthenticator(db *sql.DB, handler http.Handler) *Authenticator {
+	return &Authenticator{
+		txProvider: txProvider{db},
+		handler:    handler,
+	}
+}
+
+func (ctx *Authenticator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	cookie, err := req.Cookie(sessionCookieName)
+	if err == nil && cookie.Value != "" {
+		user := ctx.resolve(cookie.Value)
+		if user != nil {
+			req = req.WithContext(withUser(req.Context(), user))
+		}
+	}
+	ctx.handler.ServeHTTP(w, req)
+}
+
+func (ctx *Authenticator) resolve(token string) *entity.User {
+	tx := ctx.Tx()
+	defer tx.Rollback()
+	sessionService := service.NewSessionService(repository.NewSessionStore(tx), repository.NewUserStore(tx))
+	user, err := sessionService.Resolve(token, time.Now())
+	if err == core.ErrNotFound {
+		return nil
+	} else if err != nil {
+		panic(err)
+	}
+	return user
+}
+
+// Returns the logged in user, or redirects to the login page and returns
+// nil.
+func requireUser(w http.ResponseWriter, req *http.Request) *entity.User {
+	user := UserFromContext(req.Context())
+	if user == nil {
+		next := req.URL.RequestURI()
+		if req.Method != http.MethodGet {
+			next = req.URL.Path
+		}
+		http.Redirect(w, req, "/login?next="+url.QueryEscape(next), http.StatusSeeOther)
+	}
+	return user
+}
+
+type cookieSettings struct {
+	secure bool
+}
+
+func (settings cookieSettings) setSessionCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   settings.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (settings cookieSettings) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   settings.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
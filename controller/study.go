@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStudySessionSize = 20
+
+type Study struct {
+	txProvider
+	templateProvider
+	rng        *rand.Rand
+	rngMutex   sync.Mutex
+	i18nBundle *i18n.Bundle
+}
+
+func NewStudy(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle) *Study {
+	return &Study{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		rng:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		i18nBundle:       i18nBundle,
+	}
+}
+
+func (ctx *Study) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if requireUser(w, req) == nil {
+		return
+	}
+	id := strings.TrimPrefix(req.URL.Path, "/study")
+	id = strings.TrimPrefix(id, "/")
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if id == "" {
+			ctx.serveIndex(w, req, "")
+		} else {
+			ctx.serveSession(w, req, id)
+		}
+	case http.MethodPost:
+		if id == "" {
+			ctx.serveStart(w, req)
+		} else {
+			ctx.serveAnswer(w, req, id)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (ctx *Study) serveIndex(w http.ResponseWriter, req *http.Request, errorMessage string) {
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	user := UserFromContext(req.Context())
+	sessions, err := repository.NewStudySessionStore(tx).ListUnfinished(user.ID)
+	if err != nil {
+		panic(err)
+	}
+	size := req.FormValue("size")
+	if size == "" {
+		size = strconv.Itoa(defaultStudySessionSize)
+	}
+	pageData := map[string]interface{}{
+		"Spec":      req.FormValue("q"),
+		"Direction": req.FormValue("direction"),
+		"Size":      size,
+		"MaxSize":   service.StudySessionMaxSize,
+		"Sessions":  sessions,
+		"Localizer": i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language")),
+		"User":      user,
+	}
+	if errorMessage != "" {
+		pageData["Error"] = errorMessage
+	}
+	err = ctx.Template().ExecuteTemplate(w, "study-index", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func (ctx *Study) serveStart(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := req.PostForm.Get("q")
+	wordSpec, err := syntax.ParseWordSpec(q)
+	if err != nil {
+		ctx.serveIndex(w, req, err.Error())
+		return
+	}
+	size, err := strconv.Atoi(req.PostForm.Get("size"))
+	if err != nil {
+		http.Error(w, "Invalid session size", http.StatusBadRequest)
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	user := UserFromContext(req.Context())
+	ctx.rngMutex.Lock()
+	session, err := service.NewStudySessionService(repository.NewStudySessionStore(tx), repository.NewWordStore(tx), ctx.rng).
+		Start(user.ID, q, wordSpec, requestedCardDirection(req, wordSpec), size, time.Now())
+	ctx.rngMutex.Unlock()
+	if err == core.ErrNotFound {
+		localizer := i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language"))
+		msg, err := localizer.Localize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "NoMatches",
+				Other: "No entries match that query",
+			},
+		})
+		if err != nil {
+			panic(fmt.Errorf("Localization error: %w", err))
+		}
+		tx.Rollback()
+		ctx.serveIndex(w, req, msg)
+		return
+	} else if errors.Is(err, core.ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+
+	http.Redirect(w, req, "/study/"+session.ID.String, http.StatusSeeOther)
+}
+
+// getSession gets the session with the ID if it belongs to the user of the
+// request, and otherwise responds with not found.
+func (ctx *Study) getSession(w http.ResponseWriter, req *http.Request, tx *sql.Tx, id string) *entity.StudySession {
+	var sessionID entity.StudySessionID
+	err := sessionID.Scan(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	session, err := repository.NewStudySessionStore(tx).Get(sessionID)
+	if err == core.ErrNotFound || (err == nil && session.UserID != UserFromContext(req.Context()).ID) {
+		http.Error(w, "No such study session", http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		panic(err)
+	}
+	return session
+}
+
+func (ctx *Study) serveSession(w http.ResponseWriter, req *http.Request, id string) {
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	session := ctx.getSession(w, req, tx, id)
+	if session == nil {
+		return
+	}
+	studySessions := service.NewStudySessionService(repository.NewStudySessionStore(tx), repository.NewWordStore(tx), ctx.rng)
+	languageNativeNameMap, err := service.NewLanguageService(repository.NewLanguageStore(tx)).GetNativeNameMap()
+	if err != nil {
+		panic(err)
+	}
+	pageData := map[string]interface{}{
+		"Session":               session,
+		"Spec":                  session.Query,
+		"Direction":             session.Direction,
+		"LanguageNativeNameMap": languageNativeNameMap,
+		"Localizer":             i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language")),
+		"User":                  UserFromContext(req.Context()),
+	}
+
+	word, position, err := studySessions.NextWord(session)
+	if err == core.ErrNotFound {
+		summary, err := studySessions.Summarize(session)
+		if err != nil {
+			panic(err)
+		}
+		pageData["Summary"] = summary
+		err = ctx.Template().ExecuteTemplate(w, "study-summary", pageData)
+		if err != nil {
+			panic(err)
+		}
+		tx.Commit()
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	// The spec was valid when the session was started
+	wordSpec, err := syntax.ParseWordSpec(session.Query)
+	if err != nil {
+		wordSpec = core.AnyWordSpec{}
+	}
+	pageData["Word"] = word
+	pageData["Position"] = position
+	pageData["Number"] = position + 1
+	pageData["Localizer"] = i18n.NewLocalizer(ctx.i18nBundle, word.LanguageCode, req.Header.Get("Accept-Language"))
+	setCardDirection(pageData, word, wordSpec,
+		drawCardDirection(core.CardDirection(session.Direction), ctx.rng, &ctx.rngMutex))
+
+	err = ctx.Template().ExecuteTemplate(w, "study-card", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
+
+func (ctx *Study) serveAnswer(w http.ResponseWriter, req *http.Request, id string) {
+	err := req.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	position, err := strconv.Atoi(req.PostForm.Get("position"))
+	if err != nil {
+		http.Error(w, "Invalid position", http.StatusBadRequest)
+		return
+	}
+
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	session := ctx.getSession(w, req, tx, id)
+	if session == nil {
+		return
+	}
+	err = service.NewStudySessionService(repository.NewStudySessionStore(tx), repository.NewWordStore(tx), ctx.rng).
+		Answer(session, position, entity.StudyResult(req.PostForm.Get("result")))
+	if errors.Is(err, core.ErrInvalid) {
+		// Sent twice, or from a page left open in another tab; show
+		// whatever is next
+		http.Redirect(w, req, "/study/"+session.ID.String, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		panic(err)
+	}
+
+	http.Redirect(w, req, "/study/"+session.ID.String, http.StatusSeeOther)
+}
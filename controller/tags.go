@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"database/sql"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"html/template"
+	"net/http"
+)
+
+type Tags struct {
+	txProvider
+	templateProvider
+	i18nBundle *i18n.Bundle
+}
+
+func NewTags(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle) *Tags {
+	return &Tags{
+		txProvider:       txProvider{db},
+		templateProvider: templateProvider{tpl},
+		i18nBundle:       i18nBundle,
+	}
+}
+
+func (ctx *Tags) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	tx := ctx.Tx()
+	defer tx.Rollback()
+
+	tree, err := service.NewTagService(repository.NewTagStore(tx), repository.NewWordStore(tx)).Tree()
+	if err != nil {
+		panic(err)
+	}
+	pageData := map[string]interface{}{
+		"Tags":      tree,
+		"Localizer": i18n.NewLocalizer(ctx.i18nBundle, req.Header.Get("Accept-Language")),
+		"User":      UserFromContext(req.Context()),
+	}
+	err = ctx.Template().ExecuteTemplate(w, "tags", pageData)
+	if err != nil {
+		panic(err)
+	}
+	tx.Commit()
+}
@@ -57,6 +57,19 @@ type Image struct {
 	License        string  `sqlname:"license"`
 	Attribution    string  `sqlname:"attribution"`
 	AttributionUrl string  `sqlname:"attribution_url"`
+	// Key of the image content in the blob store
+	BlobKey string `sqlname:"blob_key"`
+	Width   int    `sqlname:"width"`
+	Height  int    `sqlname:"height"`
+}
+
+// A scaled down copy of an image
+type ImageVariant struct {
+	ImageID  ImageID `sqlname:"image_id"`
+	Width    int     `sqlname:"width"`
+	Height   int     `sqlname:"height"`
+	MimeType string  `sqlname:"mime_type"`
+	BlobKey  string  `sqlname:"blob_key"`
 }
 
 type WordID ID
@@ -87,12 +100,12 @@ func (id WordID) Marshal() ([]byte, error) {
 }
 
 type Word struct {
-	ID           WordID `sqlname:"word_id"`
-	Word         string `sqlname:"word"`
-	LanguageCode string `sqlname:"language_code"`
-	UserID       UserID `sqlname:"user_id"`
-	ImageID      UserID `sqlname:"image_id"`
-	Notes        string `sqlname:"notes"`
+	ID           WordID  `sqlname:"word_id"`
+	Word         string  `sqlname:"word"`
+	LanguageCode string  `sqlname:"language_code"`
+	UserID       UserID  `sqlname:"user_id"`
+	ImageID      ImageID `sqlname:"image_id"`
+	Notes        string  `sqlname:"notes"`
 
 	Translations []*WordTranslation
 	Tags         []string
@@ -109,3 +122,8 @@ type WordTag struct {
 	WordID WordID `sqlname:"word_id"`
 	Tag    string `sqlname:"tag"`
 }
+
+type Tag struct {
+	Tag       string `sqlname:"tag"`
+	WordCount int    `sqlname:"word_count"`
+}
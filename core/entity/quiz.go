@@ -0,0 +1,31 @@
+package entities
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+type QuizResultID ID
+
+func (id *QuizResultID) Scan(val interface{}) error {
+	return (*sql.NullString)(id).Scan(val)
+}
+
+func (id QuizResultID) Value() (driver.Value, error) {
+	return sql.NullString(id).Value()
+}
+
+const (
+	// A translation chosen among plausible wrong ones
+	QuizModeChoice = "choice"
+)
+
+type QuizResult struct {
+	ID         QuizResultID `sqlname:"quiz_result_id"`
+	UserID     UserID       `sqlname:"user_id"`
+	WordID     WordID       `sqlname:"word_id"`
+	Mode       string       `sqlname:"mode"`
+	Correct    bool         `sqlname:"correct"`
+	AnsweredAt time.Time    `sqlname:"answered_at"`
+}
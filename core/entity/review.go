@@ -0,0 +1,57 @@
+package entities
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+type ReviewID ID
+
+func (id *ReviewID) Scan(val interface{}) error {
+	return (*sql.NullString)(id).Scan(val)
+}
+
+func (id ReviewID) Value() (driver.Value, error) {
+	return sql.NullString(id).Value()
+}
+
+type Grade int
+
+const (
+	GradeAgain Grade = 1
+	GradeHard  Grade = 2
+	GradeGood  Grade = 3
+	GradeEasy  Grade = 4
+)
+
+func (grade Grade) Valid() bool {
+	return grade >= GradeAgain && grade <= GradeEasy
+}
+
+type Review struct {
+	ID          ReviewID  `sqlname:"review_id"`
+	UserID      UserID    `sqlname:"user_id"`
+	WordID      WordID    `sqlname:"word_id"`
+	Grade       Grade     `sqlname:"grade"`
+	ReviewedAt  time.Time `sqlname:"reviewed_at"`
+	DueAt       time.Time `sqlname:"due_at"`
+	Interval    float64   `sqlname:"interval_days"`
+	EaseFactor  float64   `sqlname:"ease_factor"`
+	Repetitions int       `sqlname:"repetitions"`
+	Stability   float64   `sqlname:"stability"`
+	Difficulty  float64   `sqlname:"difficulty"`
+}
+
+const (
+	SchedulerAlgorithmSM2  = "sm2"
+	SchedulerAlgorithmFSRS = "fsrs"
+)
+
+type SchedulerSettings struct {
+	UserID           UserID  `sqlname:"user_id"`
+	Algorithm        string  `sqlname:"algorithm"`
+	DesiredRetention float64 `sqlname:"desired_retention"`
+	// JSON array of FSRS weights, or empty for the defaults
+	Weights string `sqlname:"weights"`
+}
@@ -0,0 +1,14 @@
+package entities
+
+import (
+	"time"
+)
+
+type Session struct {
+	// SHA-256 hash of the token in the session cookie, so that a leaked
+	// database does not give away valid sessions
+	TokenHash string    `sqlname:"token_hash"`
+	UserID    UserID    `sqlname:"user_id"`
+	CreatedAt time.Time `sqlname:"created_at"`
+	ExpiresAt time.Time `sqlname:"expires_at"`
+}
@@ -0,0 +1,53 @@
+package entities
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+type StudySessionID ID
+
+func (id *StudySessionID) Scan(val interface{}) error {
+	return (*sql.NullString)(id).Scan(val)
+}
+
+func (id StudySessionID) Value() (driver.Value, error) {
+	return sql.NullString(id).Value()
+}
+
+// A run through a sample of the words matching a query, each shown once
+type StudySession struct {
+	ID     StudySessionID `sqlname:"study_session_id"`
+	UserID UserID         `sqlname:"user_id"`
+	Query  string         `sqlname:"query"`
+	// The card direction cards are shown in, or empty for the default
+	Direction string `sqlname:"direction"`
+	// The position of the word shown next
+	Position  int       `sqlname:"position"`
+	Size      int       `sqlname:"size"`
+	CreatedAt time.Time `sqlname:"created_at"`
+}
+
+func (session *StudySession) Finished() bool {
+	return session.Position >= session.Size
+}
+
+type StudyResult string
+
+const (
+	StudyResultNone   StudyResult = ""
+	StudyResultKnown  StudyResult = "known"
+	StudyResultMissed StudyResult = "missed"
+)
+
+func (result StudyResult) Valid() bool {
+	return result == StudyResultKnown || result == StudyResultMissed
+}
+
+type StudySessionWord struct {
+	StudySessionID StudySessionID `sqlname:"study_session_id"`
+	Position       int            `sqlname:"position"`
+	WordID         WordID         `sqlname:"word_id"`
+	Result         StudyResult    `sqlname:"result"`
+}
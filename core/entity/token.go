@@ -0,0 +1,24 @@
+package entities
+
+import (
+	"time"
+)
+
+type TokenPurpose string
+
+const (
+	TokenPurposeVerifyEmail   TokenPurpose = "verify-email"
+	TokenPurposeResetPassword TokenPurpose = "reset-password"
+)
+
+// A single-use token sent by e-mail. Like sessions, only the SHA-256 hash
+// of the token is stored.
+type Token struct {
+	TokenHash string       `sqlname:"token_hash"`
+	UserID    UserID       `sqlname:"user_id"`
+	Purpose   TokenPurpose `sqlname:"purpose"`
+	// The address the token was sent to
+	Email     string    `sqlname:"email"`
+	CreatedAt time.Time `sqlname:"created_at"`
+	ExpiresAt time.Time `sqlname:"expires_at"`
+}
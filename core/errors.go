@@ -1,7 +1,10 @@
 package core
 
 var (
-	ErrNotFound = &Error{"Not found"}
+	ErrNotFound      = &Error{"Not found"}
+	ErrAlreadyExists = &Error{"Already exists"}
+	ErrInvalid       = &Error{"Invalid"}
+	ErrInUse         = &Error{"In use"}
 )
 
 type Error struct {
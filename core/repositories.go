@@ -2,10 +2,14 @@ package core
 
 import (
 	entity "github.com/ivartj/kartoteka/core/entity"
+	"io"
+	"time"
 )
 
 type UserStore interface {
 	Get(id entity.UserID) (*entity.User, error)
+	GetByUsername(username string) (*entity.User, error)
+	GetByEmail(email string) (*entity.User, error)
 	Update(word *entity.User) error
 	Delete(id entity.UserID) error
 }
@@ -17,6 +21,14 @@ type WordStore interface {
 	Delete(id entity.WordID) error
 	List(query *WordQuery) ([]*entity.Word, error)
 	Count(query *WordQuery) (int, error)
+	// Lists the IDs of the words matching the query, without getting the
+	// words themselves
+	ListIDs(query *WordQuery) ([]entity.WordID, error)
+	// Gets the word matching the spec that comes first at or after the key,
+	// a non-negative integer, in an order words are kept in at random, and
+	// comes back around to the first word in that order if there is none
+	// after the key. Drawing the key at random draws a random word.
+	Sample(spec WordSpec, key int) (*entity.Word, error)
 }
 
 type WordQuery struct {
@@ -24,6 +36,8 @@ type WordQuery struct {
 	hasRange bool
 	Offset   int
 	Length   int
+	// Orders words by how well they match the text searched for in Spec
+	OrderByRelevance bool
 }
 
 func (q *WordQuery) SetRange(offset, length int) *WordQuery {
@@ -42,4 +56,89 @@ type LanguageStore interface {
 	ListAll() ([]*entity.Language, error)
 	Update(language *entity.Language) error
 	Delete(langCode string) error
+	// Counts the words in the language and the translations to it
+	CountUsage(langCode string) (int, int, error)
+}
+
+type ImageStore interface {
+	Get(id entity.ImageID) (*entity.Image, error)
+	Add(image *entity.Image) error
+	Delete(id entity.ImageID) error
+	// Counts the words the image is attached to
+	CountWords(id entity.ImageID) (int, error)
+	// Counts the images and image variants stored under the blob key
+	CountByBlobKey(blobKey string) (int, error)
+	AddVariant(variant *entity.ImageVariant) error
+	GetVariant(id entity.ImageID, width int) (*entity.ImageVariant, error)
+	// Lists the variants of the image from the narrowest to the widest
+	ListVariants(id entity.ImageID) ([]*entity.ImageVariant, error)
+}
+
+type BlobStore interface {
+	// Returns the key the content is stored under
+	Put(r io.Reader) (string, error)
+	Open(key string) (Blob, error)
+	Delete(key string) error
+}
+
+type Blob interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type TagStore interface {
+	ListAll() ([]*entity.Tag, error)
+	ListNodes() ([]*entity.Tag, error)
+}
+
+type ReviewStore interface {
+	Add(review *entity.Review) error
+	GetLatest(userID entity.UserID, wordID entity.WordID) (*entity.Review, error)
+	// Lists all reviews by the user ordered by word and then by time
+	ListByUser(userID entity.UserID) ([]*entity.Review, error)
+	// Lists words matching the query that the user has never reviewed or
+	// that are due at the given time, the most overdue words first.
+	ListDue(userID entity.UserID, query *WordQuery, now time.Time) ([]*entity.Word, error)
+	CountDue(userID entity.UserID, query *WordQuery, now time.Time) (int, error)
+}
+
+type QuizResultStore interface {
+	Add(result *entity.QuizResult) error
+	// Counts the user's answers in the quiz mode and how many were correct
+	CountByUser(userID entity.UserID, mode string) (int, int, error)
+}
+
+type StudySessionStore interface {
+	// Adds the session with the words in the order they are to be shown
+	Add(session *entity.StudySession, wordIDs []entity.WordID) error
+	Get(id entity.StudySessionID) (*entity.StudySession, error)
+	// Updates the position of the session
+	Update(session *entity.StudySession) error
+	// Lists the user's sessions with words left to show, the newest first
+	ListUnfinished(userID entity.UserID) ([]*entity.StudySession, error)
+	// Lists the words of the session that have not been deleted since it
+	// was started, by position
+	ListWords(id entity.StudySessionID) ([]*entity.StudySessionWord, error)
+	SetResult(id entity.StudySessionID, position int, result entity.StudyResult) error
+}
+
+type SchedulerSettingsStore interface {
+	Get(userID entity.UserID) (*entity.SchedulerSettings, error)
+	Update(settings *entity.SchedulerSettings) error
+}
+
+type SessionStore interface {
+	Add(session *entity.Session) error
+	Get(tokenHash string) (*entity.Session, error)
+	Delete(tokenHash string) error
+	DeleteByUser(userID entity.UserID) error
+	DeleteExpired(now time.Time) error
+}
+
+type TokenStore interface {
+	Add(token *entity.Token) error
+	Get(tokenHash string) (*entity.Token, error)
+	Delete(tokenHash string) error
+	DeleteByUser(userID entity.UserID, purpose entity.TokenPurpose) error
+	DeleteExpired(now time.Time) error
 }
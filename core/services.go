@@ -2,6 +2,7 @@ package core
 
 import (
 	entity "github.com/ivartj/kartoteka/core/entity"
+	"time"
 )
 
 type WordLottery interface {
@@ -15,3 +16,24 @@ type Rand interface {
 type LanguageService interface {
 	GetNativeNameMap() (map[string]string, error)
 }
+
+type Scheduler interface {
+	// Fills in the due time and scheduling state of review from its grade
+	// and the user's previous review of the same word, which may be nil.
+	Schedule(previous *entity.Review, review *entity.Review)
+}
+
+type ReviewQueue interface {
+	NextWord(now time.Time) (*entity.Word, error)
+	Grade(wordID entity.WordID, grade entity.Grade, now time.Time) (*entity.Review, error)
+}
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(mail *Mail) error
+}
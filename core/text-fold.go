@@ -0,0 +1,113 @@
+package core
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Spellings of letters in languages where learners commonly type them
+// differently than taking away their diacritics would, applied before
+// foldLetters.
+var foldLanguageLetters = map[string]map[rune]string{
+	"de": {'ä': "ae", 'ö': "oe", 'ü': "ue"},
+	"da": {'æ': "ae", 'ø': "o", 'å': "a"},
+	"no": {'æ': "ae", 'ø': "o", 'å': "a"},
+	"nb": {'æ': "ae", 'ø': "o", 'å': "a"},
+	"nn": {'æ': "ae", 'ø': "o", 'å': "a"},
+}
+
+// Letters without a decomposition into a base letter and diacritics, like
+// Polish ł, spelled the way they are usually written without them.
+var foldLetters = map[rune]string{
+	'ł': "l",
+	'ø': "o",
+	'æ': "ae",
+	'œ': "oe",
+	'ß': "ss",
+	'đ': "d",
+	'ð': "d",
+	'þ': "th",
+	'ħ': "h",
+	'ı': "i",
+}
+
+// Letters that learners leaving out diacritics often type as a single plain
+// letter, as "arlig" for Norwegian "ærlig", applied before foldLetters in
+// one of the variants of FoldTextVariants.
+var foldBareLetters = map[rune]string{
+	'æ': "a",
+	'œ': "o",
+}
+
+// FoldText lower-cases text in the given language, spells letters without
+// diacritics and replaces compatibility characters like ligatures, so that
+// "Jabłko" and "jablko" fold to the same text, as do Norwegian "blåbær" and
+// "blabaer".
+func FoldText(text, languageCode string) string {
+	return foldText(text, foldLanguageLetters[foldLanguage(languageCode)])
+}
+
+// foldText folds text, spelling letters as in letters before taking away
+// diacritics.
+func foldText(text string, letters map[rune]string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if s, ok := letters[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	decomposed := norm.NFKD.String(b.String())
+	b.Reset()
+	for _, r := range decomposed {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if s, ok := foldLetters[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// FoldTextVariants returns the ways text may be folded, leaving out
+// duplicates: without the spellings of any language, as in each of the given
+// languages with their own spellings, or in every such language if none are
+// given, and with letters like æ as a single plain letter. Text matches other
+// text if any of their variants do, so that German "Mädchen" is found both
+// as "madchen" and as "maedchen".
+func FoldTextVariants(text string, languageCodes ...string) []string {
+	if len(languageCodes) == 0 {
+		for languageCode := range foldLanguageLetters {
+			languageCodes = append(languageCodes, languageCode)
+		}
+		sort.Strings(languageCodes)
+	}
+	variants := []string{foldText(text, nil)}
+	add := func(variant string) {
+		for _, other := range variants {
+			if other == variant {
+				return
+			}
+		}
+		variants = append(variants, variant)
+	}
+	for _, languageCode := range languageCodes {
+		add(FoldText(text, languageCode))
+	}
+	add(foldText(text, foldBareLetters))
+	return variants
+}
+
+// foldLanguage returns the primary language subtag of a BCP 47 tag
+func foldLanguage(languageCode string) string {
+	if i := strings.IndexAny(languageCode, "-_"); i != -1 {
+		languageCode = languageCode[:i]
+	}
+	return strings.ToLower(languageCode)
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFoldText(t *testing.T) {
+	assert.Equal(t, "jablko", FoldText("Jabłko", "pl"))
+	assert.Equal(t, "zrodlo", FoldText("ŹRÓDŁO", "pl"))
+	assert.Equal(t, "blabaer", FoldText("blåbær", "no"))
+	assert.Equal(t, "blabaer", FoldText("blåbær", "nb-NO"))
+	assert.Equal(t, "smorbrod", FoldText("smørbrød", "da"))
+	assert.Equal(t, "maedchen", FoldText("Mädchen", "de"))
+	assert.Equal(t, "madchen", FoldText("Mädchen", "sv"))
+	assert.Equal(t, "strasse", FoldText("Straße", "de"))
+	assert.Equal(t, "cafe", FoldText("café", "fr"))
+	assert.Equal(t, "file", FoldText("ﬁle", "en"))
+}
+
+func TestFoldTextVariants(t *testing.T) {
+	assert.Equal(t, []string{"jablko"}, FoldTextVariants("jabłko"))
+	assert.ElementsMatch(t, []string{"madchen", "maedchen"}, FoldTextVariants("Mädchen"))
+	assert.Equal(t, []string{"madchen", "maedchen"}, FoldTextVariants("Mädchen", "de"))
+	assert.Equal(t, []string{"madchen"}, FoldTextVariants("Mädchen", "sv"))
+	assert.Equal(t, []string{"aerlig", "arlig"}, FoldTextVariants("Ærlig", "no"))
+}
+
+func TestTextWordSpecFolding(t *testing.T) {
+	word := &entity.Word{
+		Word:         "jabłko",
+		LanguageCode: "pl",
+		Translations: []*entity.WordTranslation{
+			{LanguageCode: "no", Translation: "et eple"},
+			{LanguageCode: "de", Translation: "ein Apfel"},
+		},
+	}
+	assert.True(t, (&TextWordSpec{Text: "JABLKO"}).Match(word))
+	assert.True(t, (&TextWordSpec{Text: "jabł", Prefix: true}).Match(word))
+
+	word = &entity.Word{
+		Word:         "blåbær",
+		LanguageCode: "no",
+		Translations: []*entity.WordTranslation{
+			{LanguageCode: "de", Translation: "Heidelbeere, Blaubeere"},
+			{LanguageCode: "sv", Translation: "blåbär"},
+		},
+	}
+	assert.True(t, (&TextWordSpec{Field: TextFieldWord, Text: "blabaer"}).Match(word))
+	assert.True(t, (&TextWordSpec{Field: TextFieldWord, Text: "blåbær"}).Match(word))
+	assert.True(t, (&TextWordSpec{Field: TextFieldWord, Text: "blabar"}).Match(word))
+	assert.False(t, (&TextWordSpec{Field: TextFieldWord, Text: "blobar"}).Match(word))
+	assert.True(t, (&TextWordSpec{Field: TextFieldTranslations, Text: "blabar"}).Match(word))
+
+	// Letters spelled the way of the language are also matched without
+	// their diacritics
+	word = &entity.Word{Word: "Mädchen", LanguageCode: "de"}
+	assert.True(t, (&TextWordSpec{Text: "maedchen"}).Match(word))
+	assert.True(t, (&TextWordSpec{Text: "madchen"}).Match(word))
+	assert.True(t, (&TextWordSpec{Text: "mäd", Prefix: true}).Match(word))
+	assert.False(t, (&TextWordSpec{Text: "medchen"}).Match(word))
+	word = &entity.Word{Word: "Ærlig", LanguageCode: "no"}
+	assert.True(t, (&TextWordSpec{Text: "aerlig"}).Match(word))
+	assert.True(t, (&TextWordSpec{Text: "arlig"}).Match(word))
+	assert.True(t, (&TextWordSpec{Text: "ærlig"}).Match(word))
+}
@@ -2,6 +2,8 @@ package core
 
 import (
 	entity "github.com/ivartj/kartoteka/core/entity"
+	"strings"
+	"unicode"
 )
 
 type WordSpec interface {
@@ -40,17 +42,48 @@ func (spec *NotWordSpec) Match(w *entity.Word) bool {
 	return !spec.Spec.Match(w)
 }
 
+// Separates the levels of hierarchical tags, as in food/fruit
+const TagSeparator = "/"
+
+// Matches words with the tag or a tag under it, so that food matches
+// food/fruit. A '*' matches any run of characters, so that a* matches a1 and
+// food/* matches the tags under food but not food itself.
 type TagWordSpec string
 
 func (spec TagWordSpec) Match(w *entity.Word) bool {
 	for _, tag := range w.Tags {
-		if tag == string(spec) {
+		if spec.MatchTag(tag) {
 			return true
 		}
 	}
 	return false
 }
 
+func (spec TagWordSpec) MatchTag(tag string) bool {
+	return matchWildcard(string(spec), tag) || matchWildcard(string(spec)+TagSeparator+"*", tag)
+}
+
+// matchWildcard tells whether s matches the pattern, in which '*' matches
+// any run of characters and everything else only itself.
+func matchWildcard(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i == -1 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
 type TranslationWordSpec string
 
 func (spec TranslationWordSpec) Match(w *entity.Word) bool {
@@ -73,3 +106,117 @@ type UserWordSpec string
 func (spec UserWordSpec) Match(w *entity.Word) bool {
 	return w.UserUsername == string(spec)
 }
+
+type CardDirection string
+
+const (
+	// The word is shown first and its translations are revealed
+	CardDirectionForward CardDirection = "forward"
+	// Translations are shown first and the word is revealed
+	CardDirectionReverse CardDirection = "reverse"
+	// Either direction, chosen anew for each card
+	CardDirectionBoth CardDirection = "both"
+)
+
+func (direction CardDirection) Valid() bool {
+	switch direction {
+	case CardDirectionForward, CardDirectionReverse, CardDirectionBoth:
+		return true
+	default:
+		return false
+	}
+}
+
+// DirectionWordSpec chooses the direction cards are shown in, and matches
+// every word.
+type DirectionWordSpec CardDirection
+
+func (spec DirectionWordSpec) Match(w *entity.Word) bool {
+	return true
+}
+
+type TextField string
+
+const (
+	TextFieldAny          TextField = ""
+	TextFieldWord         TextField = "word"
+	TextFieldTranslations TextField = "translations"
+	TextFieldNotes        TextField = "notes"
+)
+
+// TextWordSpec matches words containing the words of Text in sequence, in
+// the given field or in any of them, ignoring case, diacritics and
+// punctuation. With Prefix, the last word of Text only needs to begin a word.
+type TextWordSpec struct {
+	Field  TextField
+	Text   string
+	Prefix bool
+}
+
+func (spec *TextWordSpec) Match(w *entity.Word) bool {
+	type field struct {
+		text         string
+		languageCode string
+	}
+	var fields []field
+	if spec.Field == TextFieldAny || spec.Field == TextFieldWord {
+		fields = append(fields, field{w.Word, w.LanguageCode})
+	}
+	if spec.Field == TextFieldAny || spec.Field == TextFieldTranslations {
+		for _, translation := range w.Translations {
+			fields = append(fields, field{translation.Translation, translation.LanguageCode})
+		}
+	}
+	if spec.Field == TextFieldAny || spec.Field == TextFieldNotes {
+		fields = append(fields, field{w.Notes, w.LanguageCode})
+	}
+	// The text searched for may be in any language, and is matched against
+	// each way the text of the field may be folded in its own language, as
+	// in the full-text index
+	phrases := [][]string{}
+	for _, variant := range FoldTextVariants(spec.Text) {
+		phrase := TextTokens(variant)
+		if len(phrase) == 0 {
+			return false
+		}
+		phrases = append(phrases, phrase)
+	}
+	for _, field := range fields {
+		for _, variant := range FoldTextVariants(field.text, field.languageCode) {
+			tokens := TextTokens(variant)
+			for _, phrase := range phrases {
+				if matchPhrase(tokens, phrase, spec.Prefix) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func matchPhrase(tokens, phrase []string, prefix bool) bool {
+	last := len(phrase) - 1
+outer:
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		for j, word := range phrase {
+			if j == last && prefix {
+				if !strings.HasPrefix(tokens[i+j], word) {
+					continue outer
+				}
+			} else if tokens[i+j] != word {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// TextTokens splits text into lower case words the way the full-text index
+// does, separating them at anything that is not a letter, digit or mark. Text
+// is folded with FoldTextVariants before it is indexed.
+func TextTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r))
+	})
+}
@@ -31,3 +31,51 @@ func TestWordSpecBasic(t *testing.T) {
 	assert.True(t, spec.Match(words[0]))
 	assert.False(t, spec.Match(words[1]))
 }
+
+func TestTextWordSpec(t *testing.T) {
+	word := &entity.Word{
+		Word:  "jabłko",
+		Notes: "Rzeczownik, rodzaj nijaki.",
+		Translations: []*entity.WordTranslation{
+			{LanguageCode: "en", Translation: "an apple"},
+		},
+	}
+
+	assert.True(t, (&TextWordSpec{Text: "Jabłko"}).Match(word))
+	assert.True(t, (&TextWordSpec{Field: TextFieldWord, Text: "jabł", Prefix: true}).Match(word))
+	assert.False(t, (&TextWordSpec{Field: TextFieldWord, Text: "jabł"}).Match(word))
+	assert.True(t, (&TextWordSpec{Text: "an apple"}).Match(word))
+	assert.False(t, (&TextWordSpec{Text: "apple an"}).Match(word))
+	assert.False(t, (&TextWordSpec{Field: TextFieldNotes, Text: "apple"}).Match(word))
+	assert.True(t, (&TextWordSpec{Field: TextFieldNotes, Text: "rodzaj nij", Prefix: true}).Match(word))
+	assert.False(t, (&TextWordSpec{Text: "!"}).Match(word))
+}
+
+func TestTagWordSpecHierarchy(t *testing.T) {
+	for _, c := range []struct {
+		spec  string
+		tag   string
+		match bool
+	}{
+		{"food", "food", true},
+		{"food", "food/fruit", true},
+		{"food", "food/fruit/citrus", true},
+		{"food", "foods", false},
+		{"food/fruit", "food", false},
+		{"food/*", "food/fruit", true},
+		{"food/*", "food", false},
+		{"a*", "a1", true},
+		{"a*", "a1/extra", true},
+		{"a*", "b1", false},
+		{"*/fruit", "food/fruit", true},
+		{"*/fruit", "food/fruit/citrus", true},
+		{"*/fruit", "fruit", false},
+		{"f*d", "food", true},
+		{"f*d", "fold/x", true},
+		{"f*d", "fork", false},
+	} {
+		assert.Equal(t, c.match, TagWordSpec(c.spec).MatchTag(c.tag), "%s matching %s", c.spec, c.tag)
+	}
+	assert.True(t, TagWordSpec("food").Match(&entity.Word{Tags: []string{"a1", "food/fruit"}}))
+	assert.False(t, TagWordSpec("food").Match(&entity.Word{Tags: []string{"a1"}}))
+}
@@ -0,0 +1,444 @@
+// Reads and writes words as CSV or TSV, one word to a row, with a header row
+// naming what each column holds.
+package csvfile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/wordfile"
+	"io"
+	"sort"
+	"strings"
+)
+
+type Format struct {
+	Delimiter rune
+	// Whether fields may be quoted with '"', as spreadsheets do for fields
+	// with delimiters, quotes or line breaks in them. Without quoting, a
+	// '"' is read as any other character, and fields cannot have
+	// delimiters or line breaks.
+	Quoting bool
+}
+
+var (
+	CSV = Format{Delimiter: ',', Quoting: true}
+	TSV = Format{Delimiter: '\t', Quoting: true}
+)
+
+// The columns other than translations, which are "tr:" followed by a
+// language code and can be repeated for several translations into the same
+// language
+var columnNames = []string{"id", "word", "lang", "tags", "notes"}
+
+// A row of a file, as a section of a word file so that it can be imported
+// the same way
+type Row struct {
+	// The line of the file the row starts on
+	Line    int
+	Section *wordfile.Section
+	// The columns of the cells, counted from 1, for reporting problems
+	cols map[string]int
+}
+
+// Read reads the rows of a file whose first row is the header. Words
+// without a lang column are in defaultLanguage. Problems with the header
+// and with reading rows are returned along with the rows read, so that they
+// can be reported together with the problems Validate finds.
+func Read(r io.Reader, format Format, defaultLanguage string) ([]*Row, []wordfile.Problem, error) {
+	records := newRecordReader(r, format)
+	problems := []wordfile.Problem{}
+
+	header, line, err := records.next()
+	if err == io.EOF {
+		return nil, []wordfile.Problem{{Line: 1, Col: 1, Message: "the file is empty"}}, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, cell := range header {
+		cell = strings.TrimSpace(strings.TrimPrefix(cell, "\ufeff"))
+		name := strings.ToLower(cell)
+		columns[i] = name
+		switch {
+		case strings.HasPrefix(name, "tr:") && len(name) > len("tr:"):
+			// The language code keeps its case, as in pt-BR
+			columns[i] = "tr:" + strings.TrimSpace(cell[len("tr:"):])
+			continue
+		case !contains(columnNames, name):
+			problems = append(problems, wordfile.Problem{Line: line, Col: i + 1, Message: fmt.Sprintf("unknown column '%s'", header[i])})
+		case seen[name]:
+			problems = append(problems, wordfile.Problem{Line: line, Col: i + 1, Message: fmt.Sprintf("the column '%s' is repeated", name)})
+		}
+		seen[name] = true
+	}
+	if !seen["word"] {
+		problems = append(problems, wordfile.Problem{Line: line, Col: 1, Message: "there is no word column"})
+	}
+	if len(problems) != 0 {
+		return nil, problems, nil
+	}
+
+	rows := []*Row{}
+	for {
+		record, line, err := records.next()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// Reading cannot go on reliably after a quoting error
+			problems = append(problems, wordfile.Problem{Line: parseErr.Line, Col: parseErr.Column, Message: parseErr.Err.Error()})
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if isEmpty(record) {
+			continue
+		}
+		if len(record) != len(columns) {
+			problems = append(problems, wordfile.Problem{Line: line, Col: 1, Message: fmt.Sprintf("expected %d fields, got %d", len(columns), len(record))})
+			continue
+		}
+		rows = append(rows, newRow(line, columns, record, defaultLanguage))
+	}
+	return rows, problems, nil
+}
+
+func newRow(line int, columns []string, record []string, defaultLanguage string) *Row {
+	row := &Row{
+		Line: line,
+		Section: &wordfile.Section{
+			Lang: defaultLanguage,
+			Tr:   map[string]interface{}{},
+		},
+		cols: map[string]int{},
+	}
+	section := row.Section
+	for i, column := range columns {
+		cell := strings.TrimSpace(record[i])
+		if _, ok := row.cols[column]; !ok {
+			row.cols[column] = i + 1
+		}
+		switch column {
+		case "id":
+			section.ID = cell
+		case "word":
+			section.Word = cell
+		case "lang":
+			if cell != "" {
+				section.Lang = cell
+			}
+		case "tags":
+			// Tags cannot have spaces, so both spaces and commas separate
+			// them
+			for _, tag := range strings.FieldsFunc(cell, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			}) {
+				if !contains(section.Tags, tag) {
+					section.Tags = append(section.Tags, tag)
+				}
+			}
+		case "notes":
+			section.Notes = strings.ReplaceAll(cell, "\r\n", "\n")
+		default:
+			code := strings.TrimPrefix(column, "tr:")
+			texts, _ := section.Tr[code].([]string)
+			if cell != "" {
+				section.Tr[code] = append(texts, cell)
+			}
+		}
+	}
+	return row
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmpty(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads records along with the lines they start on
+type recordReader struct {
+	csv     *csv.Reader
+	scanner *bufio.Scanner
+	format  Format
+	line    int
+}
+
+func newRecordReader(r io.Reader, format Format) *recordReader {
+	records := &recordReader{format: format}
+	if format.Quoting {
+		records.csv = csv.NewReader(r)
+		records.csv.Comma = format.Delimiter
+		records.csv.FieldsPerRecord = -1
+	} else {
+		records.scanner = bufio.NewScanner(r)
+	}
+	return records
+}
+
+func (records *recordReader) next() ([]string, int, error) {
+	if records.csv != nil {
+		record, err := records.csv.Read()
+		if err != nil {
+			return nil, 0, err
+		}
+		line, _ := records.csv.FieldPos(0)
+		return record, line, nil
+	}
+	if !records.scanner.Scan() {
+		if records.scanner.Err() != nil {
+			return nil, 0, records.scanner.Err()
+		}
+		return nil, 0, io.EOF
+	}
+	records.line++
+	text := strings.TrimSuffix(records.scanner.Text(), "\r")
+	return strings.Split(text, string(records.format.Delimiter)), records.line, nil
+}
+
+// Validate checks the rows for everything that would keep them from being
+// imported, returning every problem found in the order of the file.
+func Validate(rows []*Row, languageStore core.LanguageStore) ([]wordfile.Problem, error) {
+	problems := []wordfile.Problem{}
+	languages := map[string]bool{}
+	knownLanguage := func(code string) (bool, error) {
+		known, ok := languages[code]
+		if ok {
+			return known, nil
+		}
+		_, err := languageStore.Get(code)
+		if err != nil && err != core.ErrNotFound {
+			return false, err
+		}
+		languages[code] = err == nil
+		return err == nil, nil
+	}
+	ids := map[string]int{}
+
+	for _, row := range rows {
+		section := row.Section
+		problemAt := func(column string, format string, v ...interface{}) {
+			// Problems with a column the file does not have, such as a
+			// missing language, are at the start of the row
+			col := row.cols[column]
+			if col == 0 {
+				col = 1
+			}
+			problems = append(problems, wordfile.Problem{
+				Line:    row.Line,
+				Col:     col,
+				Message: fmt.Sprintf(format, v...),
+			})
+		}
+		if section.ID != "" {
+			if line, ok := ids[section.ID]; ok {
+				problemAt("id", "the ID %s is also used on line %d", section.ID, line)
+			} else {
+				ids[section.ID] = row.Line
+			}
+		}
+		if section.Word == "" {
+			problemAt("word", "the word is empty")
+		}
+		if section.Lang == "" {
+			problemAt("lang", "the language is not given")
+		} else if known, err := knownLanguage(section.Lang); err != nil {
+			return nil, err
+		} else if !known {
+			problemAt("lang", "unknown language '%s'", section.Lang)
+		}
+		codes := make([]string, 0, len(section.Tr))
+		for code := range section.Tr {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			known, err := knownLanguage(code)
+			if err != nil {
+				return nil, err
+			}
+			if !known {
+				problemAt("tr:"+code, "unknown language '%s'", code)
+			}
+		}
+		for _, tag := range section.Tags {
+			err := service.ValidateTag(tag)
+			if err != nil {
+				problemAt("tags", "invalid tag '%s'", tag)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// Sections returns the sections of the rows, for importing with a
+// wordfile.Importer.
+func Sections(rows []*Row) []*wordfile.Section {
+	sections := make([]*wordfile.Section, len(rows))
+	for i, row := range rows {
+		sections[i] = row.Section
+	}
+	return sections
+}
+
+// Write writes the words with a header row, ordered as in word files. Each
+// translation gets a cell of its own, so there are as many columns for a
+// language as the most translations any word has into it.
+func Write(w io.Writer, words []*entity.Word, format Format) error {
+	words = sortWords(words)
+	counts := map[string]int{}
+	for _, word := range words {
+		wordCounts := map[string]int{}
+		for _, translation := range word.Translations {
+			wordCounts[translation.LanguageCode]++
+			if wordCounts[translation.LanguageCode] > counts[translation.LanguageCode] {
+				counts[translation.LanguageCode] = wordCounts[translation.LanguageCode]
+			}
+		}
+	}
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	header := []string{"id", "word", "lang"}
+	for _, code := range codes {
+		for i := 0; i < counts[code]; i++ {
+			header = append(header, "tr:"+code)
+		}
+	}
+	header = append(header, "tags", "notes")
+
+	records := newRecordWriter(w, format)
+	err := records.write(header)
+	if err != nil {
+		return err
+	}
+	for _, word := range words {
+		record := []string{word.ID.String, word.Word, word.LanguageCode}
+		for _, code := range codes {
+			texts := translations(word, code)
+			for i := 0; i < counts[code]; i++ {
+				if i < len(texts) {
+					record = append(record, texts[i])
+				} else {
+					record = append(record, "")
+				}
+			}
+		}
+		tags := append([]string{}, word.Tags...)
+		sort.Strings(tags)
+		record = append(record, strings.Join(tags, " "), word.Notes)
+		err = records.write(record)
+		if err != nil {
+			return fmt.Errorf("Error writing '%s': %w", word.Word, err)
+		}
+	}
+	return records.flush()
+}
+
+// WriteQuizlet writes the words as Quizlet imports them, as a term and a
+// definition separated by a tab on each line, without a header or quoting.
+// The definition is the translations into the language, or all translations
+// if no language is given, separated by "; ". Words without any are left
+// out.
+func WriteQuizlet(w io.Writer, words []*entity.Word, translationLanguage string) error {
+	bw := bufio.NewWriter(w)
+	clean := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+	for _, word := range sortWords(words) {
+		texts := translations(word, translationLanguage)
+		if len(texts) == 0 {
+			continue
+		}
+		_, err := fmt.Fprintf(bw, "%s\t%s\n", clean.Replace(word.Word), clean.Replace(strings.Join(texts, "; ")))
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// translations returns the translations of the word into the language, or
+// all of them if no language is given.
+func translations(word *entity.Word, languageCode string) []string {
+	texts := []string{}
+	for _, translation := range word.Translations {
+		if languageCode == "" || translation.LanguageCode == languageCode {
+			texts = append(texts, translation.Translation)
+		}
+	}
+	return texts
+}
+
+func sortWords(words []*entity.Word) []*entity.Word {
+	sorted := append([]*entity.Word{}, words...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.LanguageCode != b.LanguageCode {
+			return a.LanguageCode < b.LanguageCode
+		}
+		if a.Word != b.Word {
+			return a.Word < b.Word
+		}
+		return a.ID.String < b.ID.String
+	})
+	return sorted
+}
+
+type recordWriter struct {
+	csv    *csv.Writer
+	w      *bufio.Writer
+	format Format
+}
+
+func newRecordWriter(w io.Writer, format Format) *recordWriter {
+	records := &recordWriter{format: format}
+	if format.Quoting {
+		records.csv = csv.NewWriter(w)
+		records.csv.Comma = format.Delimiter
+	} else {
+		records.w = bufio.NewWriter(w)
+	}
+	return records
+}
+
+func (records *recordWriter) write(record []string) error {
+	if records.csv != nil {
+		return records.csv.Write(record)
+	}
+	for i, cell := range record {
+		if strings.ContainsAny(cell, string(records.format.Delimiter)+"\r\n") {
+			return fmt.Errorf("%w: column %d has a delimiter or line break, which cannot be written without quoting", core.ErrInvalid, i+1)
+		}
+	}
+	_, err := records.w.WriteString(strings.Join(record, string(records.format.Delimiter)) + "\n")
+	return err
+}
+
+func (records *recordWriter) flush() error {
+	if records.csv != nil {
+		records.csv.Flush()
+		return records.csv.Error()
+	}
+	return records.w.Flush()
+}
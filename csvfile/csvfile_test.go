@@ -0,0 +1,191 @@
+package csvfile
+
+import (
+	"bytes"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/repository/repositorytest"
+	"github.com/ivartj/kartoteka/wordfile"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testContext struct {
+	wordStore     core.WordStore
+	languageStore core.LanguageStore
+	user          *entity.User
+}
+
+func newTestContext(t *testing.T) *testContext {
+	db := repositorytest.Open(t, "pl", "en", "no")
+	return &testContext{
+		wordStore:     repository.NewWordStore(db),
+		languageStore: repository.NewLanguageStore(db),
+		user:          repositorytest.AddUser(t, db, "csvwords"),
+	}
+}
+
+func (ctx *testContext) export(t *testing.T, format Format) string {
+	words, err := ctx.wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		t.Fatalf("Failed to list words: %s", err)
+	}
+	var b bytes.Buffer
+	err = Write(&b, words, format)
+	if err != nil {
+		t.Fatalf("Failed to write words: %s", err)
+	}
+	return b.String()
+}
+
+func (ctx *testContext) importFile(t *testing.T, content string, format Format) *wordfile.Summary {
+	rows, problems, err := Read(strings.NewReader(content), format, "pl")
+	if err != nil {
+		t.Fatalf("Failed to read words: %s", err)
+	}
+	validationProblems, err := Validate(rows, ctx.languageStore)
+	if err != nil {
+		t.Fatalf("Failed to validate words: %s", err)
+	}
+	problems = append(problems, validationProblems...)
+	if len(problems) != 0 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+	sum, err := wordfile.NewImporter(ctx.wordStore, ctx.languageStore, ctx.user).Import(Sections(rows))
+	if err != nil {
+		t.Fatalf("Failed to import words: %s", err)
+	}
+	return sum
+}
+
+func TestRoundTrip(t *testing.T) {
+	source := newTestContext(t)
+	translation := func(languageCode, text string) *entity.WordTranslation {
+		return &entity.WordTranslation{LanguageCode: languageCode, Translation: text}
+	}
+	for _, word := range []*entity.Word{
+		{Word: "jabłko", LanguageCode: "pl",
+			Tags:         []string{"a1", "food/fruit"},
+			Translations: []*entity.WordTranslation{translation("en", "an apple"), translation("no", "et eple")}},
+		{Word: "zamek", LanguageCode: "pl",
+			Translations: []*entity.WordTranslation{translation("en", "a lock"), translation("en", "a zip, a zipper")}},
+		{Word: "et \"hus\"", LanguageCode: "no",
+			Notes: "Intetkjønn.\nFlertall: hus."},
+	} {
+		word.ID = entity.WordID(entity.NewID())
+		word.UserID = source.user.ID
+		err := source.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	for _, format := range []Format{CSV, TSV} {
+		exported := source.export(t, format)
+		assert.True(t, strings.HasPrefix(exported, strings.Join([]string{"id", "word", "lang", "tr:en", "tr:en", "tr:no", "tags", "notes"}, string(format.Delimiter))))
+
+		target := newTestContext(t)
+		sum := target.importFile(t, exported, format)
+		assert.Equal(t, 3, sum.Added)
+		assert.Equal(t, exported, target.export(t, format))
+
+		sum = target.importFile(t, exported, format)
+		assert.Equal(t, &wordfile.Summary{Unchanged: 3}, sum)
+	}
+
+	// Notes with line breaks cannot be written without quoting
+	words, _ := source.wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	err := Write(&bytes.Buffer{}, words, Format{Delimiter: '\t'})
+	assert.ErrorIs(t, err, core.ErrInvalid)
+}
+
+func TestReadWithoutQuoting(t *testing.T) {
+	ctx := newTestContext(t)
+	sum := ctx.importFile(t, "Word\tTr:en\tTAGS\n\"cytat\"\t\"a quote\"\ta1,b1\n\n", Format{Delimiter: '\t'})
+	assert.Equal(t, 1, sum.Added)
+	words, err := ctx.wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "\"cytat\"", words[0].Word)
+	assert.Equal(t, "pl", words[0].LanguageCode)
+	assert.Equal(t, "\"a quote\"", words[0].Translations[0].Translation)
+	sort.Strings(words[0].Tags)
+	assert.Equal(t, []string{"a1", "b1"}, words[0].Tags)
+}
+
+func TestReadHeaderSpaces(t *testing.T) {
+	rows, problems, err := Read(strings.NewReader("\ufeff word , Tr: en ,tags\njabłko,an apple,a1\n"), CSV, "pl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, problems)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "jabłko", rows[0].Section.Word)
+	assert.Equal(t, map[string]interface{}{"en": []string{"an apple"}}, rows[0].Section.Tr)
+}
+
+func TestProblems(t *testing.T) {
+	ctx := newTestContext(t)
+	_, problems, err := Read(strings.NewReader("word,colour,word\n"), CSV, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []wordfile.Problem{
+		{Line: 1, Col: 2, Message: "unknown column 'colour'"},
+		{Line: 1, Col: 3, Message: "the column 'word' is repeated"},
+	}, problems)
+
+	rows, problems, err := Read(strings.NewReader(`id,word,lang,tr:en,tr:xx,tags
+k1,jabłko,pl,an apple,,a1
+k1,"gruszka
+(pear)",,a pear,,a1
+,,pl,,,
+,kot,xx,a cat,kot,a*
+,pies,pl
+,"bad"quote,pl,,,
+,never,pl,,,
+`), CSV, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	validationProblems, err := Validate(rows, ctx.languageStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []wordfile.Problem{
+		{Line: 7, Col: 1, Message: "expected 6 fields, got 3"},
+		{Line: 8, Col: 6, Message: "extraneous or missing \" in quoted-field"},
+	}, problems)
+	assert.Equal(t, []wordfile.Problem{
+		{Line: 3, Col: 1, Message: "the ID k1 is also used on line 2"},
+		{Line: 3, Col: 3, Message: "the language is not given"},
+		{Line: 5, Col: 2, Message: "the word is empty"},
+		{Line: 6, Col: 3, Message: "unknown language 'xx'"},
+		{Line: 6, Col: 5, Message: "unknown language 'xx'"},
+		{Line: 6, Col: 6, Message: "invalid tag 'a*'"},
+	}, validationProblems)
+}
+
+func TestWriteQuizlet(t *testing.T) {
+	words := []*entity.Word{
+		{Word: "zamek", LanguageCode: "pl", Translations: []*entity.WordTranslation{
+			{LanguageCode: "en", Translation: "a lock"},
+			{LanguageCode: "no", Translation: "en lås"},
+			{LanguageCode: "en", Translation: "a\tcastle"},
+		}},
+		{Word: "dom", LanguageCode: "pl"},
+		{Word: "jabłko", LanguageCode: "pl", Translations: []*entity.WordTranslation{
+			{LanguageCode: "en", Translation: "an apple"},
+		}},
+	}
+	var b bytes.Buffer
+	err := WriteQuizlet(&b, words, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "jabłko\tan apple\nzamek\ta lock; a castle\n", b.String())
+}
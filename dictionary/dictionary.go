@@ -0,0 +1,217 @@
+// Reads the entries of offline dictionaries, FreeDict TEI files and StarDict
+// dictionaries, and imports them as words with translations.
+package dictionary
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/service"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+type Entry struct {
+	Headword     string
+	Translations []string
+}
+
+// Reads entries one at a time, returning io.EOF after the last
+type EntryReader interface {
+	Next() (*Entry, error)
+}
+
+// ReadHeadwords reads a list of headwords, one to a line, such as a
+// frequency list. Only the first field of each line is read, so that lists
+// with counts after the words can be used as they are. Headwords are lower
+// case, as they are matched regardless of case.
+func ReadHeadwords(r io.Reader) (map[string]bool, error) {
+	headwords := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 0 {
+			headwords[strings.ToLower(fields[0])] = true
+		}
+	}
+	return headwords, scanner.Err()
+}
+
+type Summary struct {
+	// Entries read from the dictionary
+	Entries int
+	// Entries left out by the list of headwords, or without translations
+	Skipped int
+	Added   int
+	// Words that were already there and got translations or tags added
+	Changed int
+	// Words that were already there with every translation and tag
+	Unchanged int
+}
+
+// Imports entries of a dictionary as words of a user. An entry for a word
+// the user already has in the language adds its translations to it, so
+// that importing a dictionary again, or several dictionaries into the same
+// language, does not add words twice.
+type Importer struct {
+	wordStore   core.WordStore
+	wordService *service.WordService
+	user        *entity.User
+	// The language of the headwords
+	Lang string
+	// The language of the translations
+	TranslationLanguage string
+	// If not nil, only entries whose headwords are in it, in lower case, are
+	// imported
+	Headwords map[string]bool
+	// Added to every imported word, such as to tell the source
+	Tags []string
+	// Where progress is written every ProgressInterval entries
+	Progress         io.Writer
+	ProgressInterval int
+}
+
+func NewImporter(wordStore core.WordStore, languageStore core.LanguageStore, user *entity.User) *Importer {
+	return &Importer{
+		wordStore:        wordStore,
+		wordService:      service.NewWordService(wordStore, languageStore),
+		user:             user,
+		Progress:         ioutil.Discard,
+		ProgressInterval: 10000,
+	}
+}
+
+func (importer *Importer) Import(entries EntryReader) (*Summary, error) {
+	for _, tag := range importer.Tags {
+		err := service.ValidateTag(tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	existing, err := importer.wordStore.List(&core.WordQuery{Spec: &core.AndWordSpec{
+		Left:  core.UserWordSpec(importer.user.Username),
+		Right: core.LanguageWordSpec(importer.Lang),
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the words of %s: %w", importer.user.Username, err)
+	}
+	words := map[string]*entity.Word{}
+	for _, word := range existing {
+		if words[word.Word] == nil {
+			words[word.Word] = word
+		}
+	}
+	added := map[string]bool{}
+	matched := map[string]bool{}
+	// Words changed after they were added or listed are only updated after
+	// the last entry, as dictionaries often have several entries for the
+	// same headword
+	changed := map[string]bool{}
+	updates := []*entity.Word{}
+
+	sum := new(Summary)
+	for {
+		if importer.ProgressInterval > 0 && sum.Entries != 0 && sum.Entries%importer.ProgressInterval == 0 {
+			fmt.Fprintf(importer.Progress, "%d entries read, %d words added\n", sum.Entries, len(added))
+		}
+		entry, err := entries.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		sum.Entries++
+
+		headword := strings.Join(strings.Fields(entry.Headword), " ")
+		if headword == "" || len(entry.Translations) == 0 ||
+			(importer.Headwords != nil && !importer.Headwords[strings.ToLower(headword)]) {
+			sum.Skipped++
+			continue
+		}
+
+		word := words[headword]
+		if word == nil {
+			word = &entity.Word{
+				ID:           entity.WordID(entity.NewID()),
+				Word:         headword,
+				UserID:       importer.user.ID,
+				LanguageCode: importer.Lang,
+				Translations: []*entity.WordTranslation{},
+				Tags:         []string{},
+			}
+			importer.merge(word, entry)
+			err = importer.wordService.Add(word)
+			if err != nil {
+				return nil, fmt.Errorf("Error adding '%s': %w", headword, err)
+			}
+			words[headword] = word
+			added[headword] = true
+			continue
+		}
+		if !added[headword] {
+			matched[headword] = true
+		}
+		if importer.merge(word, entry) && !changed[headword] {
+			changed[headword] = true
+			updates = append(updates, word)
+		}
+	}
+
+	for _, word := range updates {
+		err = importer.wordService.Update(word)
+		if err != nil {
+			return nil, fmt.Errorf("Error updating '%s': %w", word.Word, err)
+		}
+		if !added[word.Word] {
+			sum.Changed++
+		}
+	}
+	sum.Added = len(added)
+	sum.Unchanged = len(matched) - sum.Changed
+	return sum, nil
+}
+
+// merge adds the translations of the entry and the tags of the importer
+// that the word does not have, telling whether there were any.
+func (importer *Importer) merge(word *entity.Word, entry *Entry) bool {
+	merged := false
+	for _, text := range entry.Translations {
+		text = strings.Join(strings.Fields(text), " ")
+		if text == "" || hasTranslation(word, importer.TranslationLanguage, text) {
+			continue
+		}
+		word.Translations = append(word.Translations, &entity.WordTranslation{
+			WordID:       word.ID,
+			LanguageCode: importer.TranslationLanguage,
+			Translation:  text,
+		})
+		merged = true
+	}
+	for _, tag := range importer.Tags {
+		if !hasTag(word, tag) {
+			word.Tags = append(word.Tags, tag)
+			merged = true
+		}
+	}
+	return merged
+}
+
+func hasTranslation(word *entity.Word, languageCode, text string) bool {
+	for _, translation := range word.Translations {
+		if translation.LanguageCode == languageCode && translation.Translation == text {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(word *entity.Word, tag string) bool {
+	for _, t := range word.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
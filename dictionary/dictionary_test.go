@@ -0,0 +1,216 @@
+package dictionary
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/repository/repositorytest"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, entries EntryReader) []*Entry {
+	all := []*Entry{}
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			return all
+		} else if err != nil {
+			t.Fatalf("Failed to read an entry: %s", err)
+		}
+		all = append(all, entry)
+	}
+}
+
+func TestTEIReader(t *testing.T) {
+	entries := readAll(t, NewTEIReader(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<TEI xmlns="http://www.tei-c.org/ns/1.0">
+<teiHeader><fileDesc><titleStmt><title>Polish-English FreeDict Dictionary</title></titleStmt></fileDesc></teiHeader>
+<text><body>
+<entry>
+  <form><orth>jabłko</orth><pron>ˈjabwkɔ</pron></form>
+  <gramGrp><pos>n</pos></gramGrp>
+  <sense n="1"><cit type="trans" xml:lang="en"><quote>apple</quote></cit></sense>
+  <sense n="2">
+    <cit type="trans" xml:lang="en"><quote>apple tree</quote></cit>
+    <cit type="example"><quote>zjeść jabłko</quote><cit type="trans"><quote>to eat an apple</quote></cit></cit>
+  </sense>
+</entry>
+<entry>
+  <form type="N"><form><orth>zamek</orth></form></form>
+  <sense><sense><cit type="trans"><quote>castle</quote></cit></sense><sense><cit type="trans"><quote>lock &amp; key</quote></cit></sense></sense>
+</entry>
+</body></text>
+</TEI>
+`)))
+	assert.Equal(t, []*Entry{
+		{Headword: "jabłko", Translations: []string{"apple", "apple tree"}},
+		{Headword: "zamek", Translations: []string{"castle", "lock & key"}},
+	}, entries)
+
+	// TEI P4, as in older FreeDict dictionaries
+	entries = readAll(t, NewTEIReader(strings.NewReader(`<TEI.2><text><body>
+<entry><form><orth>kot</orth></form><trans><tr>cat</tr><tr>tomcat</tr></trans></entry>
+</body></text></TEI.2>`)))
+	assert.Equal(t, []*Entry{{Headword: "kot", Translations: []string{"cat", "tomcat"}}}, entries)
+}
+
+// writeStarDict writes a dictionary with the definitions as they are given,
+// compressing them if the definitions file ends in .dz.
+func writeStarDict(t *testing.T, directory, name, sameTypeSequence string, entries map[string][]byte) string {
+	headwords := []string{}
+	for headword := range entries {
+		headwords = append(headwords, headword)
+	}
+	sort.Strings(headwords)
+	var idx, dict bytes.Buffer
+	for _, headword := range headwords {
+		idx.WriteString(headword + "\x00")
+		binary.Write(&idx, binary.BigEndian, uint32(dict.Len()))
+		binary.Write(&idx, binary.BigEndian, uint32(len(entries[headword])))
+		dict.Write(entries[headword])
+	}
+	base := filepath.Join(directory, name)
+	ifo := "StarDict's dict ifo file\nversion=2.4.2\nbookname=" + name + "\n"
+	if sameTypeSequence != "" {
+		ifo += "sametypesequence=" + sameTypeSequence + "\n"
+	}
+	for filename, content := range map[string][]byte{
+		base + ".ifo": []byte(ifo),
+		base + ".idx": idx.Bytes(),
+	} {
+		err := ioutil.WriteFile(filename, content, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Create(base + ".dict.dz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write(dict.Bytes())
+	err = gz.Close()
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base + ".ifo"
+}
+
+func TestStarDict(t *testing.T) {
+	directory, err := ioutil.TempDir("", "kartoteka-stardict-")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(directory)
+
+	ifo := writeStarDict(t, directory, "plain", "m", map[string][]byte{
+		"kot":    []byte("1. cat\n2. tomcat"),
+		"jabłko": []byte("apple"),
+	})
+	dict, err := OpenStarDict(ifo)
+	if err != nil {
+		t.Fatalf("Failed to open the dictionary: %s", err)
+	}
+	assert.Equal(t, "plain", dict.Info["bookname"])
+	assert.Equal(t, []*Entry{
+		{Headword: "jabłko", Translations: []string{"apple"}},
+		{Headword: "kot", Translations: []string{"cat", "tomcat"}},
+	}, readAll(t, dict))
+	dict.Close()
+
+	// Without a sametypesequence, each field starts with its type
+	ifo = writeStarDict(t, directory, "typed", "", map[string][]byte{
+		"dom": []byte("tdɔm\x00h<b>dom</b><br>house &amp; home<br/>\x00W\x00\x00\x00\x02ab"),
+		"kot": []byte("x<k>kot</k> <tr>kɔt</tr> cat\x00"),
+	})
+	dict, err = OpenStarDict(ifo)
+	if err != nil {
+		t.Fatalf("Failed to open the dictionary: %s", err)
+	}
+	assert.Equal(t, []*Entry{
+		{Headword: "dom", Translations: []string{"house & home"}},
+		{Headword: "kot", Translations: []string{"cat"}},
+	}, readAll(t, dict))
+	dict.Close()
+}
+
+type sliceReader []*Entry
+
+func (entries *sliceReader) Next() (*Entry, error) {
+	if len(*entries) == 0 {
+		return nil, io.EOF
+	}
+	entry := (*entries)[0]
+	*entries = (*entries)[1:]
+	return entry, nil
+}
+
+func TestImporter(t *testing.T) {
+	db := repositorytest.Open(t, "pl", "en")
+	languageStore := repository.NewLanguageStore(db)
+	user := repositorytest.AddUser(t, db, "dictionary")
+	wordStore := repository.NewWordStore(db)
+
+	importer := NewImporter(wordStore, languageStore, user)
+	importer.Lang = "pl"
+	importer.TranslationLanguage = "en"
+	importer.Tags = []string{"source/freedict"}
+	headwords, err := ReadHeadwords(strings.NewReader("kot 1200\nZamek 800\n\njabłko\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer.Headwords = headwords
+	entries := func() *sliceReader {
+		return &sliceReader{
+			{Headword: "zamek", Translations: []string{"castle"}},
+			{Headword: "kot", Translations: []string{"cat"}},
+			{Headword: "pies", Translations: []string{"dog"}},
+			{Headword: "zamek", Translations: []string{"lock", "castle"}},
+			{Headword: "jabłko"},
+		}
+	}
+	sum, err := importer.Import(entries())
+	if err != nil {
+		t.Fatalf("Failed to import: %s", err)
+	}
+	assert.Equal(t, &Summary{Entries: 5, Skipped: 2, Added: 2}, sum)
+
+	words, err := wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := map[string][]string{}
+	for _, word := range words {
+		assert.Equal(t, []string{"source/freedict"}, word.Tags)
+		for _, translation := range word.Translations {
+			texts[word.Word] = append(texts[word.Word], translation.Translation)
+		}
+		sort.Strings(texts[word.Word])
+	}
+	assert.Equal(t, map[string][]string{"kot": {"cat"}, "zamek": {"castle", "lock"}}, texts)
+
+	// Importing again changes nothing, and another source adds to the words
+	sum, err = importer.Import(entries())
+	if err != nil {
+		t.Fatalf("Failed to import again: %s", err)
+	}
+	assert.Equal(t, &Summary{Entries: 5, Skipped: 2, Unchanged: 2}, sum)
+	importer.Tags = []string{"source/stardict"}
+	sum, err = importer.Import(&sliceReader{{Headword: "kot", Translations: []string{"cat"}}})
+	if err != nil {
+		t.Fatalf("Failed to import another source: %s", err)
+	}
+	assert.Equal(t, &Summary{Entries: 1, Changed: 1}, sum)
+}
@@ -0,0 +1,275 @@
+package dictionary
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Reads the entries of a StarDict dictionary in the order of its index.
+// The dictionary is given by its .ifo file, next to which are the .idx or
+// .idx.gz index and the .dict or dictzip-compressed .dict.dz definitions.
+// Compressed definitions are decompressed to a temporary file, as the
+// definitions are read out of order, so the dictionary needs to be closed
+// after use.
+type StarDict struct {
+	// The key-value pairs of the .ifo file, such as bookname and wordcount
+	Info map[string]string
+
+	index      *bufio.Reader
+	closers    []io.Closer
+	dict       io.ReaderAt
+	tmp        string
+	offsetBits int
+}
+
+func OpenStarDict(ifoFilename string) (*StarDict, error) {
+	base := strings.TrimSuffix(ifoFilename, ".ifo")
+	dict := &StarDict{}
+	var err error
+	dict.Info, err = readInfo(ifoFilename)
+	if err != nil {
+		return nil, err
+	}
+	dict.offsetBits = 32
+	if dict.Info["idxoffsetbits"] == "64" {
+		dict.offsetBits = 64
+	}
+
+	err = dict.openIndex(base)
+	if err == nil {
+		err = dict.openDefinitions(base)
+	}
+	if err != nil {
+		dict.Close()
+		return nil, err
+	}
+	return dict, nil
+}
+
+func readInfo(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "StarDict's dict ifo file") {
+		if scanner.Err() != nil {
+			return nil, scanner.Err()
+		}
+		return nil, fmt.Errorf("%w: %s is not a StarDict .ifo file", core.ErrInvalid, filename)
+	}
+	info := map[string]string{}
+	for scanner.Scan() {
+		kv := strings.SplitN(strings.TrimRight(scanner.Text(), "\r"), "=", 2)
+		if len(kv) == 2 {
+			info[kv[0]] = kv[1]
+		}
+	}
+	return info, scanner.Err()
+}
+
+func (dict *StarDict) openIndex(base string) error {
+	f, err := os.Open(base + ".idx")
+	if os.IsNotExist(err) {
+		f, err = os.Open(base + ".idx.gz")
+		if err != nil {
+			return err
+		}
+		dict.closers = append(dict.closers, f)
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		dict.index = bufio.NewReader(gz)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	dict.closers = append(dict.closers, f)
+	dict.index = bufio.NewReader(f)
+	return nil
+}
+
+func (dict *StarDict) openDefinitions(base string) error {
+	f, err := os.Open(base + ".dict")
+	if err == nil {
+		dict.closers = append(dict.closers, f)
+		dict.dict = f
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err = os.Open(base + ".dict.dz")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile("", "kartoteka-stardict-")
+	if err != nil {
+		return err
+	}
+	dict.tmp = tmp.Name()
+	dict.closers = append(dict.closers, tmp)
+	dict.dict = tmp
+	_, err = io.Copy(tmp, gz)
+	return err
+}
+
+func (dict *StarDict) Close() error {
+	var err error
+	for _, closer := range dict.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if dict.tmp != "" {
+		os.Remove(dict.tmp)
+	}
+	return err
+}
+
+func (dict *StarDict) Next() (*Entry, error) {
+	headword, err := dict.index.ReadString(0)
+	if err == io.EOF && headword == "" {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	headword = strings.TrimSuffix(headword, "\x00")
+
+	var offset uint64
+	if dict.offsetBits == 64 {
+		err = binary.Read(dict.index, binary.BigEndian, &offset)
+	} else {
+		var offset32 uint32
+		err = binary.Read(dict.index, binary.BigEndian, &offset32)
+		offset = uint64(offset32)
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	var size uint32
+	err = binary.Read(dict.index, binary.BigEndian, &size)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	data := make([]byte, size)
+	_, err = dict.dict.ReadAt(data, int64(offset))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the definition of '%s': %w", headword, unexpectedEOF(err))
+	}
+	entry := &Entry{
+		Headword: headword,
+	}
+	for _, text := range definitionTexts(data, dict.Info["sametypesequence"]) {
+		entry.Translations = append(entry.Translations, definitionLines(text, headword)...)
+	}
+	return entry, nil
+}
+
+// A truncated index or definition is an error rather than the end
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// definitionTexts returns the texts of the fields of a definition, leaving
+// out phonetics and binary fields such as sounds and pictures. Each field
+// has a type, given by the sametypesequence of the dictionary or otherwise
+// before the field. Fields of lower case types are text ending in a NUL,
+// and those of upper case types start with their size, except that the
+// last field of a sametypesequence has neither.
+func definitionTexts(data []byte, types string) []string {
+	texts := []string{}
+	for i := 0; len(data) != 0 && (types == "" || i < len(types)); i++ {
+		var t byte
+		if types == "" {
+			t, data = data[0], data[1:]
+		} else {
+			t = types[i]
+		}
+		last := types != "" && i == len(types)-1
+		var field []byte
+		switch {
+		case last:
+			field, data = data, nil
+		case t >= 'a' && t <= 'z':
+			end := bytes.IndexByte(data, 0)
+			if end < 0 {
+				field, data = data, nil
+			} else {
+				field, data = data[:end], data[end+1:]
+			}
+		default:
+			if len(data) < 4 {
+				return texts
+			}
+			size := int(binary.BigEndian.Uint32(data))
+			data = data[4:]
+			if size > len(data) {
+				size = len(data)
+			}
+			field, data = data[:size], data[size:]
+		}
+		switch t {
+		case 'm', 'l':
+			texts = append(texts, string(field))
+		case 'g', 'h':
+			texts = append(texts, markupText(string(field)))
+		case 'x':
+			texts = append(texts, markupText(xdxfExtraPattern.ReplaceAllString(string(field), "")))
+		}
+	}
+	return texts
+}
+
+var (
+	// The key of XDXF articles repeats the headword, and the transcription
+	// is no translation
+	xdxfExtraPattern  = regexp.MustCompile(`(?is)<(k|tr)>.*?</(k|tr)>`)
+	lineBreakPattern  = regexp.MustCompile(`(?i)<br\s*/?>|</?(?:div|p|li|def)(?:\s[^>]*)?>`)
+	markupTagPattern  = regexp.MustCompile(`<[^>]*>`)
+	senseNumberPrefix = regexp.MustCompile(`^(?:\d+[.)]|[a-z][.)]|[-•*])\s+`)
+)
+
+// markupText returns the text of HTML, Pango or XDXF markup.
+func markupText(markup string) string {
+	text := lineBreakPattern.ReplaceAllString(markup, "\n")
+	text = markupTagPattern.ReplaceAllString(text, "")
+	return html.UnescapeString(text)
+}
+
+// definitionLines returns the lines of the definition as translations,
+// without the numbers of senses and leaving out lines that only repeat the
+// headword.
+func definitionLines(text, headword string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(senseNumberPrefix.ReplaceAllString(line, ""))
+		if line == "" || line == headword {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
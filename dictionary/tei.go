@@ -0,0 +1,110 @@
+package dictionary
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// Reads the entries of a FreeDict dictionary in TEI, as the <entry> elements
+// are reached so that the whole file is never in memory. Both the TEI P5 of
+// current FreeDict dictionaries, with translations in <cit type="trans">,
+// and the TEI P4 of older ones, with translations in <trans><tr>, are read.
+type TEIReader struct {
+	decoder *xml.Decoder
+}
+
+func NewTEIReader(r io.Reader) *TEIReader {
+	decoder := xml.NewDecoder(r)
+	decoder.Entity = xml.HTMLEntity
+	return &TEIReader{
+		decoder: decoder,
+	}
+}
+
+type teiEntry struct {
+	Forms  []teiForm  `xml:"form"`
+	Senses []teiSense `xml:"sense"`
+	Trans  []teiTrans `xml:"trans"`
+}
+
+type teiForm struct {
+	Orths []string  `xml:"orth"`
+	Forms []teiForm `xml:"form"`
+}
+
+type teiSense struct {
+	Cits   []teiCit   `xml:"cit"`
+	Trans  []teiTrans `xml:"trans"`
+	Senses []teiSense `xml:"sense"`
+}
+
+type teiCit struct {
+	Type   string   `xml:"type,attr"`
+	Quotes []string `xml:"quote"`
+}
+
+type teiTrans struct {
+	Trs []string `xml:"tr"`
+}
+
+func (reader *TEIReader) Next() (*Entry, error) {
+	for {
+		token, err := reader.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "entry" {
+			continue
+		}
+		var element teiEntry
+		err = reader.decoder.DecodeElement(&element, &start)
+		if err != nil {
+			return nil, err
+		}
+		entry := &Entry{
+			Headword: headword(element.Forms),
+		}
+		for _, trans := range element.Trans {
+			entry.Translations = append(entry.Translations, trans.Trs...)
+		}
+		entry.Translations = append(entry.Translations, senseTranslations(element.Senses)...)
+		return entry, nil
+	}
+}
+
+// headword returns the first orthography of the forms, which may be nested
+// in forms of their own.
+func headword(forms []teiForm) string {
+	for _, form := range forms {
+		for _, orth := range form.Orths {
+			if strings.TrimSpace(orth) != "" {
+				return orth
+			}
+		}
+		if orth := headword(form.Forms); orth != "" {
+			return orth
+		}
+	}
+	return ""
+}
+
+// senseTranslations returns the translations of the senses and of the
+// senses under them, leaving out those of examples and other citations.
+func senseTranslations(senses []teiSense) []string {
+	translations := []string{}
+	for _, sense := range senses {
+		for _, cit := range sense.Cits {
+			switch cit.Type {
+			case "trans", "translation", "translationEquivalent":
+				translations = append(translations, cit.Quotes...)
+			}
+		}
+		for _, trans := range sense.Trans {
+			translations = append(translations, trans.Trs...)
+		}
+		translations = append(translations, senseTranslations(sense.Senses)...)
+	}
+	return translations
+}
@@ -0,0 +1,119 @@
+// Decodes, orients, scales and re-encodes uploaded images in pure Go.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Guards against small files that decode into huge images
+const MaximumPixels = 50 * 1000 * 1000
+
+var ErrTooManyPixels = errors.New("The image has too many pixels")
+
+// Decodes a JPEG, PNG, GIF or WebP image, turned the way its EXIF
+// orientation says it should be displayed. Only the first frame of
+// animated images is decoded.
+func Decode(data []byte) (*image.NRGBA, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaximumPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	return Orient(toNRGBA(img), orientation), nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	return nrgba
+}
+
+// Applies an EXIF orientation, 1 meaning the image is already upright.
+func Orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // mirrored along the top-left to bottom-right diagonal
+				sx, sy = y, x
+			case 6: // needs rotating 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored along the top-right to bottom-left diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs rotating 90° counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, sy):img.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// Scales the image down to be at most maxWidth pixels wide, keeping its
+// aspect ratio. Images that are narrow enough are returned as they are.
+func Fit(img *image.NRGBA, maxWidth int) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= maxWidth {
+		return img
+	}
+	dh := h * maxWidth / w
+	if dh < 1 {
+		dh = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, maxWidth, dh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// Encodes the image as a PNG if it has any transparency, and as a JPEG
+// otherwise. Nothing but the pixels is written, so metadata such as the
+// location a photo was taken is left out. Returns the MIME type.
+func Encode(w io.Writer, img *image.NRGBA) (string, error) {
+	if img.Opaque() {
+		err := jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+		if err != nil {
+			return "", fmt.Errorf("Failed to encode JPEG: %w", err)
+		}
+		return "image/jpeg", nil
+	}
+	err := png.Encode(w, img)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode PNG: %w", err)
+	}
+	return "image/png", nil
+}
@@ -0,0 +1,103 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+var (
+	red  = color.NRGBA{255, 0, 0, 255}
+	blue = color.NRGBA{0, 0, 255, 255}
+)
+
+func redBlueImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, red)
+	img.SetNRGBA(1, 0, blue)
+	return img
+}
+
+func TestOrient(t *testing.T) {
+	rotated := Orient(redBlueImage(), 6)
+	assert.Equal(t, image.Rect(0, 0, 1, 2), rotated.Bounds())
+	assert.Equal(t, red, rotated.NRGBAAt(0, 0))
+	assert.Equal(t, blue, rotated.NRGBAAt(0, 1))
+
+	rotated = Orient(redBlueImage(), 8)
+	assert.Equal(t, blue, rotated.NRGBAAt(0, 0))
+	assert.Equal(t, red, rotated.NRGBAAt(0, 1))
+
+	mirrored := Orient(redBlueImage(), 2)
+	assert.Equal(t, blue, mirrored.NRGBAAt(0, 0))
+	assert.Equal(t, red, mirrored.NRGBAAt(1, 0))
+}
+
+// Inserts an APP1 segment with an EXIF orientation right after the start
+// of image marker.
+func withOrientation(jpegData []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, uint16(exifOrientationTag))
+	binary.Write(&tiff, binary.BigEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, orientation)
+	binary.Write(&tiff, binary.BigEndian, uint16(0))
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(jpegData[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(jpegData[2:])
+	return out.Bytes()
+}
+
+func TestDecodeAppliesEXIFOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 20)), nil)
+	if err != nil {
+		t.Fatalf("Failed to encode JPEG: %s", err)
+	}
+	data := withOrientation(buf.Bytes(), 6)
+	assert.Equal(t, 6, jpegOrientation(data))
+
+	img, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Failed to decode JPEG: %s", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 20, 40), img.Bounds())
+}
+
+func TestFitAndEncode(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	assert.Equal(t, img, Fit(img, 200))
+	assert.Equal(t, image.Rect(0, 0, 40, 20), Fit(img, 40).Bounds())
+
+	var buf bytes.Buffer
+	mimeType, err := Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("Failed to encode image: %s", err)
+	}
+	assert.Equal(t, "image/png", mimeType)
+
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	buf.Reset()
+	mimeType, err = Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("Failed to encode image: %s", err)
+	}
+	assert.Equal(t, "image/jpeg", mimeType)
+	assert.False(t, bytes.Contains(buf.Bytes(), []byte("Exif")))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/minn/args"
+	"io"
+	"os"
+)
+
+func langUsage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s lang [ --database FILE ] add CODE [ NATIVE-NAME ]\n", mainProgramName)
+	fmt.Fprintf(out, "       %s lang [ --database FILE ] list\n", mainProgramName)
+	fmt.Fprintf(out, "       %s lang [ --database FILE ] rename CODE NATIVE-NAME\n", mainProgramName)
+	fmt.Fprintf(out, "       %s lang [ --database FILE ] delete CODE\n", mainProgramName)
+	fmt.Fprintf(out, "\nCODE is a BCP 47 language tag. If no native name is given to add, the\n")
+	fmt.Fprintf(out, "name of the language in the language itself is taken from CLDR.\n")
+}
+
+// Administers the languages words and translations can be in. Like
+// os.Args, argv starts with the name of the command, "lang".
+func langMain(argv []string, log core.Logger) {
+	database := defaultConfiguration.Database
+	positional := []string{}
+
+	tok := args.NewTokenizer(argv)
+	for tok.Next() {
+		switch arg := tok.Arg(); arg {
+		case "-h", "-?", "--help":
+			langUsage(os.Stdout)
+			os.Exit(0)
+		case "--database":
+			var err error
+			database, err = tok.TakeParameter()
+			if err != nil {
+				log.Fatalf("%s", err)
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if tok.Err() != nil {
+		log.Fatalf("Error on parsing command line arguments: %s", tok.Err())
+	}
+	if len(positional) == 0 {
+		langUsage(os.Stderr)
+		os.Exit(1)
+	}
+	command, params := positional[0], positional[1:]
+
+	db, err := mainOpenDatabase(database)
+	if err != nil {
+		log.Fatalf("Failed to open database file: %s", err)
+	}
+	defer db.Close()
+
+	err = langRun(db, command, params, os.Stdout)
+	if err == errLangUsage {
+		langUsage(os.Stderr)
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+var errLangUsage = errors.New("Invalid usage")
+
+func langRun(db *sql.DB, command string, params []string, out io.Writer) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	languageStore := repository.NewLanguageStore(tx)
+	languageService := service.NewLanguageService(languageStore)
+
+	switch {
+	case command == "add" && (len(params) == 1 || len(params) == 2):
+		nativeName := ""
+		if len(params) == 2 {
+			nativeName = params[1]
+		}
+		language, err := languageService.Add(params[0], nativeName)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Added %s (%s)\n", language.Code, language.NativeName)
+
+	case command == "list" && len(params) == 0:
+		languages, err := languageStore.ListAll()
+		if err != nil {
+			return err
+		}
+		for _, language := range languages {
+			wordCount, translationCount, err := languageStore.CountUsage(language.Code)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s\t%s\t%d words\t%d translations\n", language.Code, language.NativeName, wordCount, translationCount)
+		}
+
+	case command == "rename" && len(params) == 2:
+		code, err := service.ParseLanguageCode(params[0])
+		if err != nil {
+			return err
+		}
+		language, err := languageService.Rename(code, params[1])
+		if err == core.ErrNotFound {
+			return fmt.Errorf("No language '%s'", code)
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Renamed %s to %s\n", language.Code, language.NativeName)
+
+	case command == "delete" && len(params) == 1:
+		code, err := service.ParseLanguageCode(params[0])
+		if err != nil {
+			return err
+		}
+		err = languageService.Delete(code)
+		if err == core.ErrNotFound {
+			return fmt.Errorf("No language '%s'", code)
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Deleted %s\n", code)
+
+	default:
+		return errLangUsage
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sends mail through an SMTP server, authenticating with PLAIN if a
+// username is given. The connection is upgraded with STARTTLS when the
+// server supports it, which is required for PLAIN authentication to be
+// used with anything but localhost.
+type SMTPMailer struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPMailer(address, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Address:  address,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+func (mailer *SMTPMailer) Send(mail *core.Mail) error {
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		host, _, err := net.SplitHostPort(mailer.Address)
+		if err != nil {
+			return fmt.Errorf("Invalid SMTP server address '%s': %w", mailer.Address, err)
+		}
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, host)
+	}
+	err := smtp.SendMail(mailer.Address, auth, mailer.From, []string{mail.To}, formatMessage(mailer.From, mail, time.Now()))
+	if err != nil {
+		return fmt.Errorf("Failed to send mail to %s: %w", mail.To, err)
+	}
+	return nil
+}
+
+func formatMessage(from string, mail *core.Mail, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(mail.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
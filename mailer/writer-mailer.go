@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	"io"
+	"sync"
+	"time"
+)
+
+// Writes mail to a file or standard output instead of sending it, for
+// local development and tests.
+type WriterMailer struct {
+	mutex sync.Mutex
+	w     io.Writer
+	from  string
+}
+
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{
+		w:    w,
+		from: from,
+	}
+}
+
+func (mailer *WriterMailer) Send(mail *core.Mail) error {
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	_, err := mailer.w.Write(formatMessage(mailer.from, mail, time.Now()))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(mailer.w, "\r\n\r\n")
+	return err
+}
@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"bytes"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewWriterMailer(&buf, "kartoteka@example.com")
+	err := mailer.Send(&core.Mail{
+		To:      "bob@example.com",
+		Subject: "Zweryfikuj swój adres",
+		Body:    "First line\nSecond line",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send mail: %s", err)
+	}
+	out := buf.String()
+	assert.Contains(t, out, "From: kartoteka@example.com\r\n")
+	assert.Contains(t, out, "To: bob@example.com\r\n")
+	assert.Contains(t, out, "Subject: =?utf-8?q?Zweryfikuj_sw=C3=B3j_adres?=\r\n")
+	assert.True(t, strings.Contains(out, "\r\n\r\nFirst line\r\nSecond line"))
+}
@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/BurntSushi/toml"
+	"github.com/ivartj/kartoteka/blobstore"
 	"github.com/ivartj/kartoteka/controller"
 	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/mailer"
 	"github.com/ivartj/kartoteka/repository"
 	"github.com/ivartj/minn/args"
 	_ "github.com/mattn/go-sqlite3"
@@ -30,18 +32,46 @@ type mainConfiguration struct {
 	Port            uint16
 	Database        string
 	AssetsDirectory string
+	ImagesDirectory string
+	// In bytes
+	MaxImageSize    int64
 	DefaultLanguage language.Tag
+	SecureCookies   bool
+	Admins          controller.Admins
+	// Defaults to http://localhost:PORT
+	BaseURL      string
+	SMTPServer   string
+	SMTPUsername string
+	MailFrom     string
+	// Where mail is written when no SMTP server is given, "-" meaning
+	// standard output
+	MailFile string
 }
 
 var defaultConfiguration = mainConfiguration{
 	Port:            8888,
 	Database:        "./kartoteka.db",
 	AssetsDirectory: "./assets",
+	ImagesDirectory: "./images",
+	MaxImageSize:    10 << 20,
 	DefaultLanguage: language.English,
+	SecureCookies:   true,
+	MailFrom:        "kartoteka@localhost",
+	MailFile:        "-",
 }
 
+// Read from the environment rather than the command line, where it would
+// be visible to other users of the system
+const mainSMTPPasswordVariable = "KARTOTEKA_SMTP_PASSWORD"
+
 func mainUsage(out io.Writer) {
-	fmt.Fprintf(out, "Usage: %s [ -p PORT ]\n", mainProgramName)
+	fmt.Fprintf(out, "Usage: %s [ -p PORT ] [ --insecure-cookies ] [ --base-url URL ]\n", mainProgramName)
+	fmt.Fprintf(out, "         [ --smtp-server HOST:PORT [ --smtp-username USERNAME ] | --mail-file FILE ]\n")
+	fmt.Fprintf(out, "         [ --mail-from ADDRESS ] [ --images-directory DIRECTORY ] [ --max-image-size BYTES ]\n")
+	fmt.Fprintf(out, "         [ --admin USERNAME ]...\n")
+	fmt.Fprintf(out, "       %s lang ...\n", mainProgramName)
+	fmt.Fprintf(out, "       %s tag ...\n", mainProgramName)
+	fmt.Fprintf(out, "\nThe SMTP password is read from the %s environment variable.\n", mainSMTPPasswordVariable)
 }
 
 func mainParseArgs(argv []string, cfg *mainConfiguration, log core.Logger) error {
@@ -84,6 +114,23 @@ func mainParseArgs(argv []string, cfg *mainConfiguration, log core.Logger) error
 				return err
 			}
 
+		case "--images-directory":
+			var err error
+			cfg.ImagesDirectory, err = tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+
+		case "--max-image-size":
+			sizeStr, err := tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+			cfg.MaxImageSize, err = strconv.ParseInt(sizeStr, 10, 64)
+			if err != nil || cfg.MaxImageSize <= 0 {
+				return fmt.Errorf("Invalid image size '%s'", sizeStr)
+			}
+
 		case "--default-language":
 			languageTag, err := tok.TakeParameter()
 			if err != nil {
@@ -94,6 +141,54 @@ func mainParseArgs(argv []string, cfg *mainConfiguration, log core.Logger) error
 				return fmt.Errorf("Failed parsing language tag: %w", err)
 			}
 
+		case "--insecure-cookies":
+			cfg.SecureCookies = false
+
+		case "--admin":
+			username, err := tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+			if cfg.Admins == nil {
+				cfg.Admins = controller.Admins{}
+			}
+			cfg.Admins[username] = true
+
+		case "--base-url":
+			var err error
+			cfg.BaseURL, err = tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+
+		case "--smtp-server":
+			var err error
+			cfg.SMTPServer, err = tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+
+		case "--smtp-username":
+			var err error
+			cfg.SMTPUsername, err = tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+
+		case "--mail-from":
+			var err error
+			cfg.MailFrom, err = tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+
+		case "--mail-file":
+			var err error
+			cfg.MailFile, err = tok.TakeParameter()
+			if err != nil {
+				return err
+			}
+
 		default:
 			log.Fatalf("Unrecognized option, '%s'", tok.Arg())
 		}
@@ -103,6 +198,10 @@ func mainParseArgs(argv []string, cfg *mainConfiguration, log core.Logger) error
 		return tok.Err()
 	}
 
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = fmt.Sprintf("http://localhost:%d", cfg.Port)
+	}
+
 	return nil
 }
 
@@ -202,19 +301,64 @@ func mainParseTemplateFiles(templateDirectory string) (*template.Template, error
 	return tpl, nil
 }
 
-func mainHTTPHandler(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle, staticDirectory string) http.Handler {
+func mainOpenMailer(cfg *mainConfiguration) (core.Mailer, error) {
+	if cfg.SMTPServer != "" {
+		return mailer.NewSMTPMailer(cfg.SMTPServer, cfg.SMTPUsername, os.Getenv(mainSMTPPasswordVariable), cfg.MailFrom), nil
+	}
+	if cfg.MailFile == "-" {
+		return mailer.NewWriterMailer(os.Stdout, cfg.MailFrom), nil
+	}
+	file, err := os.OpenFile(cfg.MailFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return mailer.NewWriterMailer(file, cfg.MailFrom), nil
+}
+
+func mainHTTPHandler(db *sql.DB, tpl *template.Template, i18nBundle *i18n.Bundle, staticDirectory string, mailer core.Mailer, blobStore core.BlobStore, cfg *mainConfiguration) http.Handler {
 	mux := http.NewServeMux()
 
 	random := controller.NewRandom(db, tpl, i18nBundle)
 	mux.Handle("/random", random)
+	mux.Handle("/search", controller.NewSearch(db, tpl, i18nBundle))
+	mux.Handle("/tags", controller.NewTags(db, tpl, i18nBundle))
+	mux.Handle("/quiz", controller.NewQuiz(db, tpl, i18nBundle))
+	mux.Handle("/quiz/choice", controller.NewChoiceQuiz(db, tpl, i18nBundle))
+	study := controller.NewStudy(db, tpl, i18nBundle)
+	mux.Handle("/study", study)
+	mux.Handle("/study/", study)
+	review := controller.NewReview(db, tpl, i18nBundle)
+	mux.Handle("/review", review)
+	mux.Handle("/review/settings", review)
+	account := controller.NewAccount(db, tpl, i18nBundle, cfg.SecureCookies, mailer, cfg.BaseURL)
+	mux.Handle("/register", account)
+	mux.Handle("/login", account)
+	mux.Handle("/logout", account)
+	mux.Handle("/verify-email", account)
+	mux.Handle("/verify-email/send", account)
+	mux.Handle("/forgot-password", account)
+	mux.Handle("/reset-password", account)
+	mux.Handle("/admin/languages", controller.NewLanguageAdmin(db, tpl, i18nBundle, cfg.Admins))
+	mux.Handle("/admin/tags", controller.NewTagAdmin(db, tpl, i18nBundle, cfg.Admins))
+	mux.Handle("/api/v1/", controller.NewAPI(db, blobStore, cfg.MaxImageSize, cfg.Admins))
+	mux.Handle("/images/", controller.NewImages(db, blobStore))
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(staticDirectory))))
 
-	return mux
+	return controller.NewAuthenticator(db, mux)
 }
 
 func main() {
 	logger := log.New(os.Stderr, "kartoteka: ", 0)
 
+	if len(os.Args) > 1 && os.Args[1] == "lang" {
+		langMain(os.Args[1:], log.New(os.Stderr, mainProgramName+" lang: ", 0))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "tag" {
+		tagMain(os.Args[1:], log.New(os.Stderr, mainProgramName+" tag: ", 0))
+		return
+	}
+
 	cfg := defaultConfiguration
 	err := mainParseArgs(os.Args, &cfg, logger)
 	if err != nil {
@@ -236,7 +380,17 @@ func main() {
 		logger.Fatalf("Error parsing template files: %s", err)
 	}
 
-	handler := mainHTTPHandler(db, tpl, i18nBundle, cfg.AssetsDirectory+"/static")
+	mailer, err := mainOpenMailer(&cfg)
+	if err != nil {
+		logger.Fatalf("Failed to open mail file: %s", err)
+	}
+
+	blobStore, err := blobstore.NewFileStore(cfg.ImagesDirectory)
+	if err != nil {
+		logger.Fatalf("Failed to open images directory: %s", err)
+	}
+
+	handler := mainHTTPHandler(db, tpl, i18nBundle, cfg.AssetsDirectory+"/static", mailer, blobStore, &cfg)
 	err = http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), handler)
 	if err != nil {
 		logger.Fatalf("Error serving HTTP requests: %s", err)
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/util/sqlutil"
+)
+
+type ImageStore struct {
+	db core.DB
+}
+
+func NewImageStore(db core.DB) *ImageStore {
+	return &ImageStore{
+		db: db,
+	}
+}
+
+func (store *ImageStore) Get(id entity.ImageID) (*entity.Image, error) {
+	rows, err := store.db.Query("select * from image where image_id = ?;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, core.ErrNotFound
+	}
+	var image entity.Image
+	err = sqlutil.Rows{rows}.ScanEntity("", &image)
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (store *ImageStore) Add(image *entity.Image) error {
+	return sqlutil.DB{store.db}.InsertEntity("image", image)
+}
+
+func (store *ImageStore) Delete(id entity.ImageID) error {
+	_, err := store.db.Exec("delete from image where image_id = ?;", id)
+	return err
+}
+
+func (store *ImageStore) CountWords(id entity.ImageID) (int, error) {
+	var count int
+	err := store.db.QueryRow("select count(*) from word where image_id = ?;", id).Scan(&count)
+	return count, err
+}
+
+func (store *ImageStore) CountByBlobKey(blobKey string) (int, error) {
+	var count int
+	err := store.db.QueryRow(`
+		select
+			(select count(*) from image where blob_key = ?)
+			+ (select count(*) from image_variant where blob_key = ?);`,
+		blobKey, blobKey).Scan(&count)
+	return count, err
+}
+
+func (store *ImageStore) AddVariant(variant *entity.ImageVariant) error {
+	return sqlutil.DB{store.db}.InsertEntity("image_variant", variant)
+}
+
+func (store *ImageStore) GetVariant(id entity.ImageID, width int) (*entity.ImageVariant, error) {
+	rows, err := store.db.Query("select * from image_variant where image_id = ? and width = ?;", id, width)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, core.ErrNotFound
+	}
+	var variant entity.ImageVariant
+	err = sqlutil.Rows{rows}.ScanEntity("", &variant)
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (store *ImageStore) ListVariants(id entity.ImageID) ([]*entity.ImageVariant, error) {
+	rows, err := store.db.Query("select * from image_variant where image_id = ? order by width;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	variants := []*entity.ImageVariant{}
+	for rows.Next() {
+		var variant entity.ImageVariant
+		err = sqlutil.Rows{rows}.ScanEntity("", &variant)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, &variant)
+	}
+	return variants, rows.Err()
+}
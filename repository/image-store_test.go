@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestImageStoreBasic(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	imageStore := NewImageStore(ctx.db)
+
+	image := &entity.Image{
+		ID:             entity.ImageID(entity.NewID()),
+		MimeType:       "image/png",
+		License:        "CC BY-SA 4.0",
+		Attribution:    "Bob",
+		AttributionUrl: "https://example.com/apple.png",
+		BlobKey:        "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		Width:          800,
+		Height:         600,
+	}
+	err := imageStore.Add(image)
+	if err != nil {
+		t.Fatalf("Failed to add image: %s", err)
+	}
+	variants := []*entity.ImageVariant{
+		&entity.ImageVariant{
+			ImageID:  image.ID,
+			Width:    640,
+			Height:   480,
+			MimeType: "image/jpeg",
+			BlobKey:  "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7",
+		},
+		&entity.ImageVariant{
+			ImageID:  image.ID,
+			Width:    320,
+			Height:   240,
+			MimeType: "image/jpeg",
+			BlobKey:  image.BlobKey,
+		},
+	}
+	for _, variant := range variants {
+		err = imageStore.AddVariant(variant)
+		if err != nil {
+			t.Fatalf("Failed to add image variant: %s", err)
+		}
+	}
+
+	word := &entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         "et eple",
+		LanguageCode: "no",
+		UserID:       ctx.bobID,
+		ImageID:      image.ID,
+	}
+	err = ctx.wordStore.Add(word)
+	if err != nil {
+		t.Fatalf("Failed to add a word: %s", err)
+	}
+
+	retImage, err := imageStore.Get(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get image: %s", err)
+	}
+	assert.Equal(t, image, retImage)
+
+	retWord, err := ctx.wordStore.Get(word.ID)
+	if err != nil {
+		t.Fatalf("Failed to get word: %s", err)
+	}
+	assert.Equal(t, image.ID, retWord.ImageID)
+
+	count, err := imageStore.CountWords(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to count words: %s", err)
+	}
+	assert.Equal(t, 1, count)
+
+	count, err = imageStore.CountByBlobKey(image.BlobKey)
+	if err != nil {
+		t.Fatalf("Failed to count images: %s", err)
+	}
+	assert.Equal(t, 2, count)
+
+	retVariants, err := imageStore.ListVariants(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to list image variants: %s", err)
+	}
+	assert.Equal(t, []*entity.ImageVariant{variants[1], variants[0]}, retVariants)
+
+	variant, err := imageStore.GetVariant(image.ID, 640)
+	if err != nil {
+		t.Fatalf("Failed to get image variant: %s", err)
+	}
+	assert.Equal(t, variants[0], variant)
+
+	retWord.ImageID = entity.ImageID{}
+	err = ctx.wordStore.Update(retWord)
+	if err != nil {
+		t.Fatalf("Failed to update word: %s", err)
+	}
+	err = imageStore.Delete(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to delete image: %s", err)
+	}
+	_, err = imageStore.Get(image.ID)
+	assert.Equal(t, core.ErrNotFound, err)
+	_, err = imageStore.GetVariant(image.ID, 640)
+	assert.Equal(t, core.ErrNotFound, err)
+}
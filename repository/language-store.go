@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"database/sql"
 	"github.com/ivartj/kartoteka/core"
 	entity "github.com/ivartj/kartoteka/core/entity"
 	"github.com/ivartj/kartoteka/util/sqlutil"
@@ -17,9 +18,12 @@ func NewLanguageStore(db core.DB) *LanguageStore {
 }
 
 func (store *LanguageStore) Get(langCode string) (*entity.Language, error) {
-	row := store.db.QueryRow("select * from language where lang_code = ?;", langCode)
+	row := store.db.QueryRow("select * from language where language_code = ?;", langCode)
 	var language entity.Language
 	err := sqlutil.Row{row}.ScanEntity(&language)
+	if err == sql.ErrNoRows {
+		return nil, core.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +31,7 @@ func (store *LanguageStore) Get(langCode string) (*entity.Language, error) {
 }
 
 func (store *LanguageStore) ListAll() ([]*entity.Language, error) {
-	rows, err := store.db.Query("select * from language;")
+	rows, err := store.db.Query("select * from language order by language_code;")
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +53,16 @@ func (store *LanguageStore) Update(language *entity.Language) error {
 }
 
 func (store *LanguageStore) Delete(langCode string) error {
-	_, err := store.db.Exec("delete from language where lang_code = ?;", langCode)
+	_, err := store.db.Exec("delete from language where language_code = ?;", langCode)
 	return err
 }
+
+func (store *LanguageStore) CountUsage(langCode string) (int, int, error) {
+	var wordCount, translationCount int
+	err := store.db.QueryRow(`
+		select
+			(select count(*) from word where language_code = ?),
+			(select count(*) from word_translation where language_code = ?);`,
+		langCode, langCode).Scan(&wordCount, &translationCount)
+	return wordCount, translationCount, err
+}
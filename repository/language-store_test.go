@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLanguageStoreBasic(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	languageStore := NewLanguageStore(ctx.db)
+
+	language, err := languageStore.Get("pl")
+	if err != nil {
+		t.Fatalf("Failed to get language: %s", err)
+	}
+	assert.Equal(t, "Polski", language.NativeName)
+
+	err = languageStore.Update(&entity.Language{
+		Code:       "de",
+		NativeName: "Deutsch",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add language: %s", err)
+	}
+	languages, err := languageStore.ListAll()
+	if err != nil {
+		t.Fatalf("Failed to list languages: %s", err)
+	}
+	assert.Equal(t, 5, len(languages))
+	assert.Equal(t, "de", languages[0].Code)
+
+	err = languageStore.Delete("de")
+	if err != nil {
+		t.Fatalf("Failed to delete language: %s", err)
+	}
+	_, err = languageStore.Get("de")
+	assert.Equal(t, core.ErrNotFound, err)
+}
+
+func TestLanguageStoreCountUsage(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	languageStore := NewLanguageStore(ctx.db)
+
+	err := ctx.wordStore.Add(&entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         "jabłko",
+		LanguageCode: "pl",
+		UserID:       ctx.bobID,
+		Translations: []*entity.WordTranslation{
+			&entity.WordTranslation{
+				LanguageCode: "en",
+				Translation:  "apple",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a word: %s", err)
+	}
+
+	wordCount, translationCount, err := languageStore.CountUsage("pl")
+	if err != nil {
+		t.Fatalf("Failed to count usage: %s", err)
+	}
+	assert.Equal(t, 1, wordCount)
+	assert.Equal(t, 0, translationCount)
+
+	wordCount, translationCount, err = languageStore.CountUsage("en")
+	if err != nil {
+		t.Fatalf("Failed to count usage: %s", err)
+	}
+	assert.Equal(t, 0, wordCount)
+	assert.Equal(t, 1, translationCount)
+
+	// Renaming a language in use must not trip the foreign keys
+	err = languageStore.Update(&entity.Language{
+		Code:       "pl",
+		NativeName: "Język polski",
+	})
+	if err != nil {
+		t.Fatalf("Failed to rename language: %s", err)
+	}
+}
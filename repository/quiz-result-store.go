@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	sqlutil "github.com/ivartj/kartoteka/util/sqlutil"
+)
+
+type QuizResultStore struct {
+	db core.DB
+}
+
+func NewQuizResultStore(db core.DB) *QuizResultStore {
+	return &QuizResultStore{
+		db: db,
+	}
+}
+
+func (store *QuizResultStore) Add(result *entity.QuizResult) error {
+	result.AnsweredAt = result.AnsweredAt.UTC()
+	return sqlutil.DB{store.db}.InsertEntity("quiz_result", result)
+}
+
+func (store *QuizResultStore) CountByUser(userID entity.UserID, mode string) (int, int, error) {
+	var answered, correct int
+	err := store.db.QueryRow(`
+		SELECT count(*), coalesce(sum(correct), 0)
+		FROM quiz_result
+		WHERE user_id = ? AND mode = ?;`,
+		userID, mode).Scan(&answered, &correct)
+	if err != nil {
+		return 0, 0, err
+	}
+	return answered, correct, nil
+}
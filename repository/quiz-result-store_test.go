@@ -0,0 +1,53 @@
+package repository
+
+import (
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestQuizResultStore(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	store := NewQuizResultStore(ctx.db)
+
+	word := &entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         "jabłko",
+		LanguageCode: "pl",
+		UserID:       ctx.aliceID,
+	}
+	err := ctx.wordStore.Add(word)
+	if err != nil {
+		t.Fatalf("Failed to add a word: %s", err)
+	}
+
+	answered, correct, err := store.CountByUser(ctx.bobID, entity.QuizModeChoice)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, answered)
+	assert.Equal(t, 0, correct)
+
+	for _, isCorrect := range []bool{true, false, true} {
+		err = store.Add(&entity.QuizResult{
+			ID:         entity.QuizResultID(entity.NewID()),
+			UserID:     ctx.bobID,
+			WordID:     word.ID,
+			Mode:       entity.QuizModeChoice,
+			Correct:    isCorrect,
+			AnsweredAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a quiz result: %s", err)
+		}
+	}
+
+	answered, correct, err = store.CountByUser(ctx.bobID, entity.QuizModeChoice)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, answered)
+	assert.Equal(t, 2, correct)
+
+	answered, _, err = store.CountByUser(ctx.aliceID, entity.QuizModeChoice)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, answered)
+}
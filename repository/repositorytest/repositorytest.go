@@ -0,0 +1,55 @@
+// Sets up databases for the tests of packages that keep words through the
+// repository, such as the importers.
+package repositorytest
+
+import (
+	"database/sql"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	_ "github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+// Open opens an in-memory database with the schema and the given languages,
+// which is closed when the test ends. It keeps to one connection, as each
+// connection to ":memory:" opens a database of its own.
+func Open(t testing.TB, languageCodes ...string) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	_, err = db.Exec("pragma foreign_keys = on;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repository.InitSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	languageStore := repository.NewLanguageStore(db)
+	for _, code := range languageCodes {
+		err = languageStore.Update(&entity.Language{Code: code, NativeName: code})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// AddUser adds a user by the username.
+func AddUser(t testing.TB, db core.DB, username string) *entity.User {
+	user := &entity.User{
+		ID:       entity.UserID(entity.NewID()),
+		Username: username,
+	}
+	err := repository.NewUserStore(db).Update(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
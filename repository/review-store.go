@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	util "github.com/ivartj/kartoteka/util"
+	sqlutil "github.com/ivartj/kartoteka/util/sqlutil"
+	"time"
+)
+
+type ReviewStore struct {
+	db core.DB
+}
+
+func NewReviewStore(db core.DB) *ReviewStore {
+	return &ReviewStore{
+		db: db,
+	}
+}
+
+func (store *ReviewStore) Add(review *entity.Review) error {
+	// Times are stored as text, so they need a common time zone to be
+	// comparable in SQL.
+	review.ReviewedAt = review.ReviewedAt.UTC()
+	review.DueAt = review.DueAt.UTC()
+	return sqlutil.DB{store.db}.InsertEntity("review", review)
+}
+
+func (store *ReviewStore) GetLatest(userID entity.UserID, wordID entity.WordID) (*entity.Review, error) {
+	rows, err := store.db.Query("SELECT * FROM review_latest WHERE user_id = ? AND word_id = ?;", userID, wordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, core.ErrNotFound
+	}
+	var review entity.Review
+	err = sqlutil.Rows{rows}.ScanEntity("", &review)
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (store *ReviewStore) ListByUser(userID entity.UserID) ([]*entity.Review, error) {
+	rows, err := store.db.Query("SELECT * FROM review WHERE user_id = ? ORDER BY word_id, reviewed_at;", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reviews := []*entity.Review{}
+	for rows.Next() {
+		review := new(entity.Review)
+		err = sqlutil.Rows{rows}.ScanEntity("", review)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, nil
+}
+
+func (store *ReviewStore) ListDue(userID entity.UserID, query *core.WordQuery, now time.Time) ([]*entity.Word, error) {
+	querySql, args := dueWordQuerySql(userID, query, now, "word_view.*")
+	rows, err := store.db.Query(querySql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []*entity.Word{}
+	for rows.Next() {
+		word := new(entity.Word)
+		err = scanWord(rows, "", word)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan word from database: %w", err)
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+func (store *ReviewStore) CountDue(userID entity.UserID, query *core.WordQuery, now time.Time) (int, error) {
+	querySql, args := dueWordQuerySql(userID, query, now, "count(*)")
+	row := store.db.QueryRow(querySql, args...)
+	var count int
+	err := row.Scan(&count)
+	return count, err
+}
+
+func dueWordQuerySql(userID entity.UserID, query *core.WordQuery, now time.Time, projection string) (string, []interface{}) {
+	var b util.FormatBuilder
+
+	b.Add("SELECT \n").Add(projection).Add(" FROM word_view\n")
+	b.Add(" LEFT OUTER JOIN review_latest ON review_latest.word_id = word_view.word_id AND review_latest.user_id = ?\n", userID)
+	b.Add(" WHERE (review_latest.due_at IS NULL OR review_latest.due_at <= ?) AND \n", now.UTC())
+
+	wordQuerySqlWhereClause(&b, query.Spec)
+
+	// Words that have never been reviewed come after the ones that are due
+	b.Add(" ORDER BY review_latest.due_at IS NULL, review_latest.due_at, word_view.word_id \n")
+
+	if query.HasRange() {
+		b.Add(" LIMIT ? OFFSET ? \n", query.Length, query.Offset)
+	}
+
+	return b.Format(), b.Args()
+}
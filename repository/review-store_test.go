@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReviewStoreListDue(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	wordStore := ctx.wordStore
+	reviewStore := NewReviewStore(ctx.db)
+	bobID := ctx.bobID
+
+	words := []*entity.Word{
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "et eple",
+			LanguageCode: "no",
+			UserID:       bobID,
+		},
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "en gulrot",
+			LanguageCode: "no",
+			UserID:       bobID,
+		},
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "en banan",
+			LanguageCode: "no",
+			UserID:       bobID,
+		},
+	}
+	for _, word := range words {
+		err := wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	now := time.Date(2020, time.January, 10, 12, 0, 0, 0, time.UTC)
+	reviews := []*entity.Review{
+		// Reviewed twice, and the latest review is not yet due
+		&entity.Review{
+			WordID:     words[0].ID,
+			ReviewedAt: now.Add(-48 * time.Hour),
+			DueAt:      now.Add(-24 * time.Hour),
+		},
+		&entity.Review{
+			WordID:     words[0].ID,
+			ReviewedAt: now.Add(-1 * time.Hour),
+			DueAt:      now.Add(24 * time.Hour),
+		},
+		// Overdue
+		&entity.Review{
+			WordID:     words[1].ID,
+			ReviewedAt: now.Add(-72 * time.Hour),
+			DueAt:      now.Add(-48 * time.Hour),
+		},
+	}
+	for _, review := range reviews {
+		review.ID = entity.ReviewID(entity.NewID())
+		review.UserID = bobID
+		review.Grade = entity.GradeGood
+		err := reviewStore.Add(review)
+		if err != nil {
+			t.Fatalf("Failed to add a review: %s", err)
+		}
+	}
+
+	query := &core.WordQuery{Spec: core.LanguageWordSpec("no")}
+	dueWords, err := reviewStore.ListDue(bobID, query, now)
+	if err != nil {
+		t.Fatalf("Failed to list due words: %s", err)
+	}
+	assert.Equal(t, 2, len(dueWords))
+	assert.Equal(t, words[1].ID, dueWords[0].ID)
+	assert.Equal(t, words[2].ID, dueWords[1].ID)
+
+	count, err := reviewStore.CountDue(bobID, query, now)
+	if err != nil {
+		t.Fatalf("Failed to count due words: %s", err)
+	}
+	assert.Equal(t, 2, count)
+
+	// Another user has not reviewed anything yet
+	count, err = reviewStore.CountDue(ctx.aliceID, query, now)
+	if err != nil {
+		t.Fatalf("Failed to count due words: %s", err)
+	}
+	assert.Equal(t, 3, count)
+
+	latest, err := reviewStore.GetLatest(bobID, words[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get latest review: %s", err)
+	}
+	assert.Equal(t, reviews[1].ID, latest.ID)
+	assert.True(t, reviews[1].DueAt.Equal(latest.DueAt))
+
+	_, err = reviewStore.GetLatest(bobID, words[2].ID)
+	assert.Equal(t, core.ErrNotFound, err)
+
+	// A review submitted twice at the same time counts once, and the one
+	// added last is the latest
+	twice := &entity.Review{
+		ID:         entity.ReviewID(entity.NewID()),
+		UserID:     bobID,
+		WordID:     words[1].ID,
+		Grade:      entity.GradeGood,
+		ReviewedAt: now.Add(-72 * time.Hour),
+		DueAt:      now.Add(-24 * time.Hour),
+	}
+	err = reviewStore.Add(twice)
+	if err != nil {
+		t.Fatalf("Failed to add a review: %s", err)
+	}
+	latest, err = reviewStore.GetLatest(bobID, words[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to get latest review: %s", err)
+	}
+	assert.Equal(t, twice.ID, latest.ID)
+	dueWords, err = reviewStore.ListDue(bobID, query, now)
+	if err != nil {
+		t.Fatalf("Failed to list due words: %s", err)
+	}
+	assert.Equal(t, 2, len(dueWords))
+	count, err = reviewStore.CountDue(bobID, query, now)
+	if err != nil {
+		t.Fatalf("Failed to count due words: %s", err)
+	}
+	assert.Equal(t, 2, count)
+}
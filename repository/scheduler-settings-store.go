@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/util/sqlutil"
+)
+
+type SchedulerSettingsStore struct {
+	db core.DB
+}
+
+func NewSchedulerSettingsStore(db core.DB) *SchedulerSettingsStore {
+	return &SchedulerSettingsStore{
+		db: db,
+	}
+}
+
+func (store *SchedulerSettingsStore) Get(userID entity.UserID) (*entity.SchedulerSettings, error) {
+	rows, err := store.db.Query("select * from scheduler_settings where user_id = ?;", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, core.ErrNotFound
+	}
+	var settings entity.SchedulerSettings
+	err = sqlutil.Rows{rows}.ScanEntity("", &settings)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (store *SchedulerSettingsStore) Update(settings *entity.SchedulerSettings) error {
+	return sqlutil.DB{store.db}.InsertOrReplaceEntity("scheduler_settings", settings)
+}
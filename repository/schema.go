@@ -5,7 +5,7 @@ import (
 	"github.com/ivartj/kartoteka/sqlmigrate"
 )
 
-const currentSchema = "ivartj-1"
+const currentSchema = "ivartj-20"
 
 func InitSchema(db core.DB) error {
 	m, err := sqlmigrate.New(db)
@@ -99,10 +99,519 @@ func InitSchema(db core.DB) error {
 		return err
 	}
 
+	err = m.RegisterMigration("ivartj-1", "ivartj-2", `
+
+		create table review (
+			review_id text not null
+				primary key,
+			user_id text not null
+				references user(user_id)
+				on delete cascade,
+			word_id text not null
+				references word(word_id)
+				on delete cascade,
+			grade integer not null
+				check (grade between 1 and 4),
+			reviewed_at datetime not null,
+			due_at datetime not null,
+			interval_days real not null,
+			ease_factor real not null,
+			repetitions integer not null
+		);
+
+		create index review_user_word_index
+			on review(user_id, word_id, reviewed_at);
+
+		create view review_latest as
+		select
+			review.*
+		from
+			review
+		where
+			review.reviewed_at = (
+				select max(previous.reviewed_at)
+				from review previous
+				where
+					previous.user_id = review.user_id
+					and previous.word_id = review.word_id
+			);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-2", "ivartj-3", `
+
+		alter table review
+			add column stability real not null default 0;
+
+		alter table review
+			add column difficulty real not null default 0;
+
+		create table scheduler_settings (
+			user_id text not null
+				primary key
+				references user(user_id)
+				on delete cascade,
+			algorithm text not null
+				check (algorithm in ('sm2', 'fsrs')),
+			desired_retention real not null,
+			weights text not null
+				-- JSON array, or empty for the defaults
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-3", "ivartj-4", `
+
+		create table session (
+			token_hash text not null
+				primary key,
+			user_id text not null
+				references user(user_id)
+				on delete cascade,
+			created_at datetime not null,
+			expires_at datetime not null
+		);
+
+		create index session_expires_at_index
+			on session(expires_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-4", "ivartj-5", `
+
+		create table token (
+			token_hash text not null
+				primary key,
+			user_id text not null
+				references user(user_id)
+				on delete cascade,
+			purpose text not null
+				check (purpose in ('verify-email', 'reset-password')),
+			email text not null,
+			created_at datetime not null,
+			expires_at datetime not null
+		);
+
+		create index token_user_index
+			on token(user_id, purpose);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-5", "ivartj-6", `
+
+		alter table image
+			add column blob_key text not null default '';
+
+		create index image_blob_key_index
+			on image(blob_key);
+
+		create index word_image_index
+			on word(image_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-6", "ivartj-7", `
+
+		alter table image
+			add column width integer not null default 0;
+
+		alter table image
+			add column height integer not null default 0;
+
+		create table image_variant (
+			image_id text not null
+				references image(image_id)
+				on delete cascade,
+			width integer not null,
+			height integer not null,
+			mime_type text not null,
+			blob_key text not null,
+			primary key (image_id, width)
+		);
+
+		create index image_variant_blob_key_index
+			on image_variant(blob_key);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-7", "ivartj-8", `
+
+		-- Full-text index of words, kept in sync with word and
+		-- word_translation by the triggers below. Rows share rowid with
+		-- word, and translations holds all translations of the word.
+		create virtual table word_search using fts5(
+			word_id unindexed,
+			word,
+			translations,
+			notes,
+			tokenize = 'unicode61 remove_diacritics 0'
+		);
+
+		insert into word_search (rowid, word_id, word, translations, notes)
+		select
+			word.rowid,
+			word.word_id,
+			word.word,
+			coalesce((
+				select group_concat(translation, ' ')
+				from word_translation
+				where word_translation.word_id = word.word_id
+			), ''),
+			word.notes
+		from word;
+
+		create trigger word_search_insert after insert on word begin
+			insert into word_search (rowid, word_id, word, translations, notes)
+			values (new.rowid, new.word_id, new.word, '', new.notes);
+		end;
+
+		create trigger word_search_update after update of word, notes on word begin
+			update word_search
+			set word = new.word, notes = new.notes
+			where rowid = new.rowid;
+		end;
+
+		create trigger word_search_delete after delete on word begin
+			delete from word_search where rowid = old.rowid;
+		end;
+
+		create trigger word_search_translation_insert after insert on word_translation begin
+			update word_search
+			set translations = coalesce((
+				select group_concat(translation, ' ')
+				from word_translation
+				where word_id = new.word_id
+			), '')
+			where rowid = (select rowid from word where word_id = new.word_id);
+		end;
+
+		create trigger word_search_translation_delete after delete on word_translation begin
+			update word_search
+			set translations = coalesce((
+				select group_concat(translation, ' ')
+				from word_translation
+				where word_id = old.word_id
+			), '')
+			where rowid = (select rowid from word where word_id = old.word_id);
+		end;
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-8", "ivartj-9", `
+
+		-- The word store now writes the index itself, with text folded in
+		-- the language it is in. InitSchema reindexes the words, since the
+		-- index is left empty.
+		drop trigger word_search_insert;
+		drop trigger word_search_update;
+		drop trigger word_search_translation_insert;
+		drop trigger word_search_translation_delete;
+
+		delete from word_search;
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-9", "ivartj-10", `
+
+		create table quiz_result (
+			quiz_result_id text not null
+				primary key,
+			user_id text not null
+				references user(user_id)
+				on delete cascade,
+			word_id text not null
+				references word(word_id)
+				on delete cascade,
+			mode text not null,
+			correct boolean not null,
+			answered_at datetime not null
+		);
+
+		create index quiz_result_user_index
+			on quiz_result(user_id, mode, answered_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	err = m.RegisterMigration("ivartj-10", "ivartj-11", `
+
+		create table study_session (
+			study_session_id text not null
+				primary key,
+			user_id text not null
+				references user(user_id)
+				on delete cascade,
+			query text not null,
+			direction text not null,
+			position integer not null,
+			size integer not null,
+			created_at datetime not null
+		);
+
+		create index study_session_user_index
+			on study_session(user_id, created_at);
+
+		create table study_session_word (
+			study_session_id text not null
+				references study_session(study_session_id)
+				on delete cascade,
+			position integer not null,
+			word_id text not null
+				references word(word_id)
+				on delete cascade,
+			result text not null
+				default '',
+			primary key (study_session_id, position)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Words are drawn at random by a random key kept for each word, with
+	// an index to look up the next key from any point. The view is
+	// flattened so that a condition on word_id is pushed down into it and
+	// looks up a single word rather than aggregating all of them.
+	err = m.RegisterMigration("ivartj-11", "ivartj-12", `
+
+		alter table word add column random_key integer;
+
+		update word set random_key = random() & 9223372036854775807;
+
+		create index word_random_key_index
+			on word(random_key);
+
+		create index word_translation_word_index
+			on word_translation(word_id);
+
+		create index word_tag_word_index
+			on word_tag(word_id);
+
+		drop view word_view;
+
+		create view word_view as
+		select
+			word.*,
+			coalesce((
+				select group_concat(word_tag.tag, ' ')
+				from word_tag
+				where word_tag.word_id is word.word_id
+			), ' ') as tags,
+			group_concat(word_translation.language_code, ' ') as translation_codes,
+			json_group_array(json_object(
+				'word_id', json_quote(word_translation.word_id),
+				'language_code', json_quote(word_translation.language_code),
+				'translation', json_quote(word_translation.translation)
+			)) filter ( where word_translation.language_code is not null ) as translations,
+			user.username
+		from
+			word
+			left outer join word_translation on word.word_id is word_translation.word_id
+			natural join user
+		group by word.word_id;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Tags and translation languages are matched by looking them up in
+	// their tables rather than in text concatenated by the view, and tags
+	// are given as a JSON array.
+	err = m.RegisterMigration("ivartj-12", "ivartj-13", `
+
+		drop index word_tag_word_index;
+
+		create index word_tag_word_index
+			on word_tag(word_id, tag);
+
+		create index word_tag_tag_index
+			on word_tag(tag);
+
+		drop index word_translation_word_index;
+
+		create index word_translation_word_index
+			on word_translation(word_id, language_code);
+
+		drop view word_view;
+
+		create view word_view as
+		select
+			word.*,
+			(
+				select json_group_array(word_tag.tag)
+				from word_tag
+				where word_tag.word_id is word.word_id
+			) as tags,
+			json_group_array(json_object(
+				'word_id', json_quote(word_translation.word_id),
+				'language_code', json_quote(word_translation.language_code),
+				'translation', json_quote(word_translation.translation)
+			)) filter ( where word_translation.language_code is not null ) as translations,
+			user.username
+		from
+			word
+			left outer join word_translation on word.word_id is word_translation.word_id
+			natural join user
+		group by word.word_id;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Reviews of a word at the same time, as from submitting a review
+	// twice, are told apart by the order they were added in, so that only
+	// one of them is the latest.
+	err = m.RegisterMigration("ivartj-13", "ivartj-14", `
+
+		drop view review_latest;
+
+		create view review_latest as
+		select
+			review.*
+		from
+			review
+		where
+			review.rowid = (
+				select previous.rowid
+				from review previous
+				where
+					previous.user_id = review.user_id
+					and previous.word_id = review.word_id
+				order by previous.reviewed_at desc, previous.rowid desc
+				limit 1
+			);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Rows of the full-text index are found by word_id through
+	// word_search_row rather than by sharing rowid with the word, which
+	// VACUUM may change. InitSchema reindexes the words, since the index is
+	// left empty.
+	err = m.RegisterMigration("ivartj-14", "ivartj-15", `
+
+		create table word_search_row (
+			word_id text not null
+				primary key,
+			search_rowid integer not null
+				unique
+		);
+
+		drop trigger word_search_delete;
+
+		create trigger word_search_delete after delete on word begin
+			delete from word_search
+			where rowid = (
+				select search_rowid
+				from word_search_row
+				where word_id = old.word_id
+			);
+			delete from word_search_row where word_id = old.word_id;
+		end;
+
+		delete from word_search;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Text is indexed once for each way it may be folded, so the words are
+	// indexed anew.
+	err = m.RegisterMigration("ivartj-15", "ivartj-16", `
+
+		delete from word_search;
+
+		delete from word_search_row;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// The translations of a word are indexed apart, so the words are
+	// indexed anew.
+	err = m.RegisterMigration("ivartj-16", "ivartj-17", `
+
+		delete from word_search;
+
+		delete from word_search_row;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// The ways a text is folded are indexed apart, so the words are indexed
+	// anew.
+	err = m.RegisterMigration("ivartj-17", "ivartj-18", `
+
+		delete from word_search;
+
+		delete from word_search_row;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Deleting a word deletes its quiz results, which are looked up by word.
+	err = m.RegisterMigration("ivartj-18", "ivartj-19", `
+
+		create index quiz_result_word_index
+			on quiz_result(word_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Deleting a word takes it out of study sessions, which are looked up by
+	// word.
+	err = m.RegisterMigration("ivartj-19", "ivartj-20", `
+
+		create index study_session_word_word_index
+			on study_session_word(word_id);
+	`)
+	if err != nil {
+		return err
+	}
+
 	err = m.MigrateTo(currentSchema)
 	if err != nil {
 		return err
 	}
 
+	// Words are missing from the full-text index after the migrations that
+	// empty it, or whenever it has been emptied otherwise.
+	var wordCount, indexedCount, rowCount int
+	err = db.QueryRow(`
+		select
+			(select count(*) from word),
+			(select count(*) from word_search),
+			(select count(*) from word_search_row natural join word);`).Scan(&wordCount, &indexedCount, &rowCount)
+	if err != nil {
+		return err
+	}
+	if wordCount != indexedCount || wordCount != rowCount {
+		err = rebuildSearchIndex(db)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/util/sqlutil"
+	"time"
+)
+
+type SessionStore struct {
+	db core.DB
+}
+
+func NewSessionStore(db core.DB) *SessionStore {
+	return &SessionStore{
+		db: db,
+	}
+}
+
+func (store *SessionStore) Add(session *entity.Session) error {
+	session.CreatedAt = session.CreatedAt.UTC()
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	return sqlutil.DB{store.db}.InsertEntity("session", session)
+}
+
+func (store *SessionStore) Get(tokenHash string) (*entity.Session, error) {
+	rows, err := store.db.Query("select * from session where token_hash = ?;", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, core.ErrNotFound
+	}
+	var session entity.Session
+	err = sqlutil.Rows{rows}.ScanEntity("", &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (store *SessionStore) Delete(tokenHash string) error {
+	_, err := store.db.Exec("delete from session where token_hash = ?;", tokenHash)
+	return err
+}
+
+func (store *SessionStore) DeleteByUser(userID entity.UserID) error {
+	_, err := store.db.Exec("delete from session where user_id = ?;", userID)
+	return err
+}
+
+func (store *SessionStore) DeleteExpired(now time.Time) error {
+	_, err := store.db.Exec("delete from session where expires_at <= ?;", now.UTC())
+	return err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreBasic(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	sessionStore := NewSessionStore(ctx.db)
+
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	sessions := []*entity.Session{
+		&entity.Session{
+			TokenHash: "expired",
+			UserID:    ctx.bobID,
+			CreatedAt: now.Add(-48 * time.Hour),
+			ExpiresAt: now.Add(-24 * time.Hour),
+		},
+		&entity.Session{
+			TokenHash: "current",
+			UserID:    ctx.bobID,
+			CreatedAt: now.Add(-1 * time.Hour),
+			ExpiresAt: now.Add(24 * time.Hour),
+		},
+	}
+	for _, session := range sessions {
+		err := sessionStore.Add(session)
+		if err != nil {
+			t.Fatalf("Failed to add session: %s", err)
+		}
+	}
+
+	err := sessionStore.DeleteExpired(now)
+	if err != nil {
+		t.Fatalf("Failed to delete expired sessions: %s", err)
+	}
+	_, err = sessionStore.Get("expired")
+	assert.Equal(t, core.ErrNotFound, err)
+
+	session, err := sessionStore.Get("current")
+	if err != nil {
+		t.Fatalf("Failed to get session: %s", err)
+	}
+	assert.Equal(t, ctx.bobID, session.UserID)
+	assert.True(t, sessions[1].ExpiresAt.Equal(session.ExpiresAt))
+
+	err = sessionStore.Delete("current")
+	if err != nil {
+		t.Fatalf("Failed to delete session: %s", err)
+	}
+	_, err = sessionStore.Get("current")
+	assert.Equal(t, core.ErrNotFound, err)
+}
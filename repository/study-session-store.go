@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	sqlutil "github.com/ivartj/kartoteka/util/sqlutil"
+)
+
+type StudySessionStore struct {
+	db core.DB
+}
+
+func NewStudySessionStore(db core.DB) *StudySessionStore {
+	return &StudySessionStore{
+		db: db,
+	}
+}
+
+func (store *StudySessionStore) Add(session *entity.StudySession, wordIDs []entity.WordID) error {
+	session.CreatedAt = session.CreatedAt.UTC()
+	err := sqlutil.DB{store.db}.InsertEntity("study_session", session)
+	if err != nil {
+		return err
+	}
+	for position, wordID := range wordIDs {
+		err = sqlutil.DB{store.db}.InsertEntity("study_session_word", &entity.StudySessionWord{
+			StudySessionID: session.ID,
+			Position:       position,
+			WordID:         wordID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *StudySessionStore) Get(id entity.StudySessionID) (*entity.StudySession, error) {
+	rows, err := store.db.Query("SELECT * FROM study_session WHERE study_session_id = ?;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, core.ErrNotFound
+	}
+	var session entity.StudySession
+	err = sqlutil.Rows{rows}.ScanEntity("", &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (store *StudySessionStore) Update(session *entity.StudySession) error {
+	_, err := store.db.Exec("UPDATE study_session SET position = ? WHERE study_session_id = ?;",
+		session.Position, session.ID)
+	return err
+}
+
+func (store *StudySessionStore) ListUnfinished(userID entity.UserID) ([]*entity.StudySession, error) {
+	rows, err := store.db.Query(`
+		SELECT * FROM study_session
+		WHERE user_id = ? AND position < size
+		ORDER BY created_at DESC;`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*entity.StudySession{}
+	for rows.Next() {
+		session := new(entity.StudySession)
+		err = sqlutil.Rows{rows}.ScanEntity("", session)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (store *StudySessionStore) ListWords(id entity.StudySessionID) ([]*entity.StudySessionWord, error) {
+	rows, err := store.db.Query("SELECT * FROM study_session_word WHERE study_session_id = ? ORDER BY position;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	words := []*entity.StudySessionWord{}
+	for rows.Next() {
+		word := new(entity.StudySessionWord)
+		err = sqlutil.Rows{rows}.ScanEntity("", word)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+	return words, rows.Err()
+}
+
+func (store *StudySessionStore) SetResult(id entity.StudySessionID, position int, result entity.StudyResult) error {
+	_, err := store.db.Exec("UPDATE study_session_word SET result = ? WHERE study_session_id = ? AND position = ?;",
+		result, id, position)
+	return err
+}
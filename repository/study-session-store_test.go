@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStudySessionStore(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	store := NewStudySessionStore(ctx.db)
+
+	wordIDs := []entity.WordID{}
+	for _, w := range []string{"et eple", "en gulrot", "en banan"} {
+		word := &entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         w,
+			LanguageCode: "no",
+			UserID:       ctx.bobID,
+		}
+		err := ctx.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+		wordIDs = append(wordIDs, word.ID)
+	}
+
+	session := &entity.StudySession{
+		ID:        entity.StudySessionID(entity.NewID()),
+		UserID:    ctx.bobID,
+		Query:     "lang:no",
+		Size:      len(wordIDs),
+		CreatedAt: time.Now(),
+	}
+	err := store.Add(session, []entity.WordID{wordIDs[2], wordIDs[0], wordIDs[1]})
+	if err != nil {
+		t.Fatalf("Failed to add a study session: %s", err)
+	}
+
+	unfinished, err := store.ListUnfinished(ctx.bobID)
+	assert.NoError(t, err)
+	assert.Len(t, unfinished, 1)
+
+	err = store.SetResult(session.ID, 0, entity.StudyResultMissed)
+	assert.NoError(t, err)
+	session.Position = 1
+	err = store.Update(session)
+	assert.NoError(t, err)
+
+	retSession, err := store.Get(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retSession.Position)
+	assert.Equal(t, "lang:no", retSession.Query)
+	assert.False(t, retSession.Finished())
+
+	// Deleted words drop out of the session
+	err = ctx.wordStore.Delete(wordIDs[0])
+	assert.NoError(t, err)
+	words, err := store.ListWords(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []*entity.StudySessionWord{
+		{StudySessionID: session.ID, Position: 0, WordID: wordIDs[2], Result: entity.StudyResultMissed},
+		{StudySessionID: session.ID, Position: 2, WordID: wordIDs[1], Result: entity.StudyResultNone},
+	}, words)
+
+	session.Position = session.Size
+	err = store.Update(session)
+	assert.NoError(t, err)
+	unfinished, err = store.ListUnfinished(ctx.bobID)
+	assert.NoError(t, err)
+	assert.Len(t, unfinished, 0)
+
+	_, err = store.Get(entity.StudySessionID(entity.NewID()))
+	assert.ErrorIs(t, err, core.ErrNotFound)
+}
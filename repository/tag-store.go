@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/util/sqlutil"
+)
+
+type TagStore struct {
+	db core.DB
+}
+
+func NewTagStore(db core.DB) *TagStore {
+	return &TagStore{
+		db: db,
+	}
+}
+
+func (store *TagStore) ListAll() ([]*entity.Tag, error) {
+	rows, err := store.db.Query(`
+		select tag, count(distinct word_id) as word_count
+		from word_tag
+		group by tag
+		order by tag;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []*entity.Tag{}
+	for rows.Next() {
+		tag := new(entity.Tag)
+		err = sqlutil.Rows{rows}.ScanEntity("", tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// ListNodes lists every tag and every level above a tag, as food for
+// food/fruit, with the number of words having the tag or a tag under it.
+func (store *TagStore) ListNodes() ([]*entity.Tag, error) {
+	// Each step takes the next level of the tag from what remains of it
+	rows, err := store.db.Query(`
+		with recursive node(word_id, tag, rest) as (
+			select word_id, '', tag || '/'
+			from word_tag
+			union
+			select word_id,
+				tag || (case when tag = '' then '' else '/' end) || substr(rest, 1, instr(rest, '/') - 1),
+				substr(rest, instr(rest, '/') + 1)
+			from node
+			where rest != ''
+		)
+		select tag, count(distinct word_id) as word_count
+		from node
+		where tag != ''
+		group by tag
+		order by tag;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []*entity.Tag{}
+	for rows.Next() {
+		tag := new(entity.Tag)
+		err = sqlutil.Rows{rows}.ScanEntity("", tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
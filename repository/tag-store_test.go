@@ -0,0 +1,82 @@
+package repository
+
+import (
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTagStoreListAll(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	tagStore := NewTagStore(ctx.db)
+
+	words := []*entity.Word{
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "et eple",
+			LanguageCode: "no",
+			UserID:       ctx.bobID,
+			Tags:         []string{"a1", "mat"},
+		},
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "en skjorte",
+			LanguageCode: "no",
+			UserID:       ctx.bobID,
+			Tags:         []string{"a1", "klær"},
+		},
+	}
+	for _, word := range words {
+		err := ctx.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	tags, err := tagStore.ListAll()
+	if err != nil {
+		t.Fatalf("Failed to list tags: %s", err)
+	}
+	assert.Equal(t, []*entity.Tag{
+		&entity.Tag{Tag: "a1", WordCount: 2},
+		&entity.Tag{Tag: "klær", WordCount: 1},
+		&entity.Tag{Tag: "mat", WordCount: 1},
+	}, tags)
+}
+
+func TestTagStoreListNodes(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	tagStore := NewTagStore(ctx.db)
+
+	for _, tags := range [][]string{
+		{"a1", "mat/frukt"},
+		{"a1", "mat/frukt", "mat/grønnsak/rot"},
+		{"mat/grønnsak"},
+		{"mat"},
+	} {
+		err := ctx.wordStore.Add(&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "x",
+			LanguageCode: "no",
+			UserID:       ctx.bobID,
+			Tags:         tags,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	tags, err := tagStore.ListNodes()
+	if err != nil {
+		t.Fatalf("Failed to list tags: %s", err)
+	}
+	assert.Equal(t, []*entity.Tag{
+		&entity.Tag{Tag: "a1", WordCount: 2},
+		&entity.Tag{Tag: "mat", WordCount: 4},
+		&entity.Tag{Tag: "mat/frukt", WordCount: 2},
+		&entity.Tag{Tag: "mat/grønnsak", WordCount: 2},
+		&entity.Tag{Tag: "mat/grønnsak/rot", WordCount: 1},
+	}, tags)
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/util/sqlutil"
+	"time"
+)
+
+type TokenStore struct {
+	db core.DB
+}
+
+func NewTokenStore(db core.DB) *TokenStore {
+	return &TokenStore{
+		db: db,
+	}
+}
+
+func (store *TokenStore) Add(token *entity.Token) error {
+	token.CreatedAt = token.CreatedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	return sqlutil.DB{store.db}.InsertEntity("token", token)
+}
+
+func (store *TokenStore) Get(tokenHash string) (*entity.Token, error) {
+	rows, err := store.db.Query("select * from token where token_hash = ?;", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, core.ErrNotFound
+	}
+	var token entity.Token
+	err = sqlutil.Rows{rows}.ScanEntity("", &token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (store *TokenStore) Delete(tokenHash string) error {
+	_, err := store.db.Exec("delete from token where token_hash = ?;", tokenHash)
+	return err
+}
+
+func (store *TokenStore) DeleteByUser(userID entity.UserID, purpose entity.TokenPurpose) error {
+	_, err := store.db.Exec("delete from token where user_id = ? and purpose = ?;", userID, purpose)
+	return err
+}
+
+func (store *TokenStore) DeleteExpired(now time.Time) error {
+	_, err := store.db.Exec("delete from token where expires_at <= ?;", now.UTC())
+	return err
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTokenStoreBasic(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	tokenStore := NewTokenStore(ctx.db)
+
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	tokens := []*entity.Token{
+		&entity.Token{
+			TokenHash: "expired",
+			UserID:    ctx.bobID,
+			Purpose:   entity.TokenPurposeResetPassword,
+			CreatedAt: now.Add(-2 * time.Hour),
+			ExpiresAt: now.Add(-1 * time.Hour),
+		},
+		&entity.Token{
+			TokenHash: "verify",
+			UserID:    ctx.bobID,
+			Purpose:   entity.TokenPurposeVerifyEmail,
+			Email:     "bob@example.com",
+			CreatedAt: now,
+			ExpiresAt: now.Add(24 * time.Hour),
+		},
+		&entity.Token{
+			TokenHash: "reset",
+			UserID:    ctx.bobID,
+			Purpose:   entity.TokenPurposeResetPassword,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+		},
+	}
+	for _, token := range tokens {
+		err := tokenStore.Add(token)
+		if err != nil {
+			t.Fatalf("Failed to add token: %s", err)
+		}
+	}
+
+	err := tokenStore.DeleteExpired(now)
+	if err != nil {
+		t.Fatalf("Failed to delete expired tokens: %s", err)
+	}
+	_, err = tokenStore.Get("expired")
+	assert.Equal(t, core.ErrNotFound, err)
+
+	token, err := tokenStore.Get("verify")
+	if err != nil {
+		t.Fatalf("Failed to get token: %s", err)
+	}
+	assert.Equal(t, ctx.bobID, token.UserID)
+	assert.Equal(t, entity.TokenPurposeVerifyEmail, token.Purpose)
+	assert.Equal(t, "bob@example.com", token.Email)
+	assert.True(t, tokens[1].ExpiresAt.Equal(token.ExpiresAt))
+
+	err = tokenStore.DeleteByUser(ctx.bobID, entity.TokenPurposeResetPassword)
+	if err != nil {
+		t.Fatalf("Failed to delete tokens: %s", err)
+	}
+	_, err = tokenStore.Get("reset")
+	assert.Equal(t, core.ErrNotFound, err)
+	_, err = tokenStore.Get("verify")
+	assert.Nil(t, err)
+}
@@ -18,33 +18,66 @@ func NewUserStore(db core.DB) *UserStore {
 }
 
 func (store *UserStore) Get(id entity.UserID) (*entity.User, error) {
-	row := store.db.QueryRow("select * from user where user_id = ?;", id)
-	var user entity.User
-	err := sqlutil.Row{row}.ScanEntity(&user)
-	if err == sql.ErrNoRows {
-		return nil, core.ErrNotFound
+	return store.getBy("user_id", id)
+}
+
+func (store *UserStore) GetByUsername(username string) (*entity.User, error) {
+	return store.getBy("username", username)
+}
+
+// Finds a user by either a verified or an unverified e-mail address
+func (store *UserStore) GetByEmail(email string) (*entity.User, error) {
+	user, err := store.getBy("email", email)
+	if err == core.ErrNotFound {
+		return store.getBy("email_unverified", email)
 	}
+	return user, err
+}
+
+func (store *UserStore) getBy(column string, value interface{}) (*entity.User, error) {
+	// Scanning through a map, since NULL e-mail columns cannot be scanned
+	// directly into strings
+	rows, err := store.db.Query("select * from user where "+column+" = ?;", value)
 	if err != nil {
 		return nil, err
 	}
-	return &user, nil
-}
-
-func (store *UserStore) GetByUsername(username string) (*entity.User, error) {
-	row := store.db.QueryRow("select * from user where username = ?;", username)
-	var user entity.User
-	err := sqlutil.Row{row}.ScanEntity(&user)
-	if err == sql.ErrNoRows {
+	defer rows.Close()
+	if !rows.Next() {
 		return nil, core.ErrNotFound
 	}
+	var user entity.User
+	err = sqlutil.Rows{rows}.ScanEntity("", &user)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// Unlike INSERT OR REPLACE, this does not delete other users that happen to
+// conflict on a unique column, and empty e-mail addresses are stored as NULL
+// so that several users can be without one.
 func (store *UserStore) Update(user *entity.User) error {
-	return sqlutil.DB{store.db}.InsertOrReplaceEntity("user", user)
+	_, err := store.db.Exec(`
+		INSERT INTO user (user_id, username, email, email_unverified, password_hash)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			username = excluded.username,
+			email = excluded.email,
+			email_unverified = excluded.email_unverified,
+			password_hash = excluded.password_hash;`,
+		user.ID,
+		user.Username,
+		nullIfEmpty(user.Email),
+		nullIfEmpty(user.EmailUnverified),
+		user.PasswordHash)
+	return err
+}
+
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{
+		String: s,
+		Valid:  s != "",
+	}
 }
 
 func (store *UserStore) Delete(id entity.UserID) error {
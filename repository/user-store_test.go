@@ -0,0 +1,63 @@
+package repository
+
+import (
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUserStoreUpdateWithoutEmail(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	userStore := NewUserStore(ctx.db)
+
+	for _, username := range []string{"carol", "dave"} {
+		err := userStore.Update(&entity.User{
+			ID:       entity.UserID(entity.NewID()),
+			Username: username,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add user %s: %s", username, err)
+		}
+	}
+
+	for _, username := range []string{"carol", "dave"} {
+		user, err := userStore.GetByUsername(username)
+		if err != nil {
+			t.Fatalf("Failed to get user %s: %s", username, err)
+		}
+		assert.Equal(t, "", user.Email)
+	}
+}
+
+func TestUserStoreUpdateExisting(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	userStore := NewUserStore(ctx.db)
+
+	err := ctx.wordStore.Add(&entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         "et eple",
+		LanguageCode: "no",
+		UserID:       ctx.bobID,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	user, err := userStore.Get(ctx.bobID)
+	if err != nil {
+		panic(err)
+	}
+	user.Email = "robert@example.com"
+	err = userStore.Update(user)
+	if err != nil {
+		t.Fatalf("Failed to update user: %s", err)
+	}
+
+	user, err = userStore.Get(ctx.bobID)
+	if err != nil {
+		t.Fatalf("Failed to get updated user: %s", err)
+	}
+	assert.Equal(t, "robert@example.com", user.Email)
+}
@@ -3,11 +3,13 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ivartj/kartoteka/core"
 	entity "github.com/ivartj/kartoteka/core/entity"
 	util "github.com/ivartj/kartoteka/util"
 	sqlutil "github.com/ivartj/kartoteka/util/sqlutil"
+	"math"
 	"strings"
 )
 
@@ -36,6 +38,16 @@ func (repo *WordStore) Add(word *entity.Word) error {
 		return err
 	}
 
+	err = repo.assignRandomKey(word)
+	if err != nil {
+		return err
+	}
+
+	err = repo.indexWord(word)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -86,8 +98,24 @@ func (repo *WordStore) deleteTagsAndTranslations(word *entity.Word) error {
 	return nil
 }
 
+// Unlike INSERT OR REPLACE, this does not delete the word first, which
+// would cascade to its reviews.
 func (repo *WordStore) Update(word *entity.Word) error {
-	err := sqlutil.DB{repo.db}.InsertOrReplaceEntity("word", word)
+	_, err := repo.db.Exec(`
+		INSERT INTO word (word_id, word, language_code, user_id, image_id, notes)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (word_id) DO UPDATE SET
+			word = excluded.word,
+			language_code = excluded.language_code,
+			user_id = excluded.user_id,
+			image_id = excluded.image_id,
+			notes = excluded.notes;`,
+		word.ID,
+		word.Word,
+		word.LanguageCode,
+		word.UserID,
+		word.ImageID,
+		word.Notes)
 	if err != nil {
 		return err
 	}
@@ -99,6 +127,14 @@ func (repo *WordStore) Update(word *entity.Word) error {
 	if err != nil {
 		return err
 	}
+	err = repo.assignRandomKey(word)
+	if err != nil {
+		return err
+	}
+	err = repo.indexWord(word)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -143,16 +179,26 @@ func scanWord(rows *sql.Rows, columnPrefix string, word *entity.Word) error {
 	if err != nil {
 		return err
 	}
-	tagString, ok := rowMap["tags"].(string)
+	tagsJSON, ok := rowMap["tags"].(string)
 	if !ok {
 		return fmt.Errorf("Failed to cast %s to string", rowMap["tags"])
 	}
-	word.Tags = strings.Split(tagString, " ")
+	err = json.Unmarshal([]byte(tagsJSON), &word.Tags)
+	if err != nil {
+		return err
+	}
+	if username, ok := rowMap["username"].(string); ok {
+		word.UserUsername = username
+	}
 	return nil
 }
 
 func (repo *WordStore) List(query *core.WordQuery) ([]*entity.Word, error) {
-	querySql, args := wordQuerySql(query, "*")
+	querySql, args := wordQuerySql(query, "word_view.*")
+	return repo.listWords(querySql, args...)
+}
+
+func (repo *WordStore) listWords(querySql string, args ...interface{}) ([]*entity.Word, error) {
 	rows, err := repo.db.Query(querySql, args...)
 	if err != nil {
 		return nil, err
@@ -171,6 +217,25 @@ func (repo *WordStore) List(query *core.WordQuery) ([]*entity.Word, error) {
 	return words, nil
 }
 
+func (repo *WordStore) ListIDs(query *core.WordQuery) ([]entity.WordID, error) {
+	querySql, args := wordQuerySql(query, "word_view.word_id")
+	rows, err := repo.db.Query(querySql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	wordIDs := []entity.WordID{}
+	for rows.Next() {
+		var wordID entity.WordID
+		err = rows.Scan(&wordID)
+		if err != nil {
+			return nil, err
+		}
+		wordIDs = append(wordIDs, wordID)
+	}
+	return wordIDs, rows.Err()
+}
+
 func (repo *WordStore) Count(query *core.WordQuery) (int, error) {
 	querySql, args := wordQuerySql(query, "count(*)")
 	row := repo.db.QueryRow(querySql, args...)
@@ -179,34 +244,154 @@ func (repo *WordStore) Count(query *core.WordQuery) (int, error) {
 	return count, err
 }
 
-func escapeSqlLikeString(s string, escape rune) string {
-	var sb strings.Builder
-	for _, r := range s {
-		switch r {
-		case escape:
-			sb.WriteRune(escape)
-			sb.WriteRune(escape)
-		case '%':
-			sb.WriteRune(escape)
-			sb.WriteRune('%')
-		case '_':
-			sb.WriteRune(escape)
-			sb.WriteRune('_')
-		default:
-			sb.WriteRune(r)
+const (
+	// How many words are first looked up by random key at a time when
+	// sampling, twice as many each time none of them match
+	sampleBatchSize = 16
+	// How many words are looked at by random key before sampling falls back
+	// to going through all words matching the spec, which is faster when
+	// they are few
+	sampleLimit = 1024
+)
+
+// Returned by sampleRange when more than sampleLimit words have been looked at
+var errSampleLimit = errors.New("Sample limit reached")
+
+// assignRandomKey gives a newly inserted word a random key uniformly
+// distributed over the non-negative 64-bit integers.
+func (repo *WordStore) assignRandomKey(word *entity.Word) error {
+	_, err := repo.db.Exec(`
+		UPDATE word SET random_key = random() & 9223372036854775807
+		WHERE word_id = ? AND random_key IS NULL;`,
+		word.ID)
+	return err
+}
+
+// Sample returns the word matching spec with the least random key at or
+// after key, or the least key of all if there is none after it. With key
+// drawn uniformly at random, each word is drawn with a probability
+// proportional to the gap between its key and the one before it, which is
+// close to uniform. Where a fair share of the words match the spec, this
+// takes a few index lookups however many words there are.
+func (repo *WordStore) Sample(spec core.WordSpec, key int) (*entity.Word, error) {
+	looked := 0
+	word, err := repo.sampleRange(spec, int64(key), math.MaxInt64, &looked)
+	if err == core.ErrNotFound && key != 0 {
+		word, err = repo.sampleRange(spec, 0, int64(key)-1, &looked)
+	}
+	if err == errSampleLimit {
+		return repo.sampleScan(spec, int64(key))
+	}
+	return word, err
+}
+
+// sampleRange looks at words with random keys from from to to, inclusive,
+// in batches in order of their keys, until one matches spec.
+func (repo *WordStore) sampleRange(spec core.WordSpec, from, to int64, looked *int) (*entity.Word, error) {
+	for batchSize := sampleBatchSize; ; batchSize *= 2 {
+		if *looked >= sampleLimit {
+			return nil, errSampleLimit
+		}
+		rows, err := repo.db.Query(`
+			SELECT word_id, random_key FROM word
+			WHERE random_key BETWEEN ? AND ?
+			ORDER BY random_key
+			LIMIT ?;`,
+			from, to, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		wordIDs := []interface{}{}
+		var lastKey int64
+		for rows.Next() {
+			var wordID entity.WordID
+			err = rows.Scan(&wordID, &lastKey)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			wordIDs = append(wordIDs, wordID)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
 		}
+		if len(wordIDs) == 0 {
+			return nil, core.ErrNotFound
+		}
+		*looked += len(wordIDs)
+
+		// Conditions on word_id are pushed down into the view, so that
+		// only the words of the batch are aggregated
+		var b util.FormatBuilder
+		b.Add("SELECT word_view.* FROM word_view WHERE word_id IN (")
+		for i, wordID := range wordIDs {
+			if i != 0 {
+				b.Add(",")
+			}
+			b.Add(" ?", wordID)
+		}
+		b.Add(" ) AND")
+		wordQuerySqlWhereClause(&b, spec)
+		b.Add(" ORDER BY random_key LIMIT 1;")
+		words, err := repo.listWords(b.Format(), b.Args()...)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) != 0 {
+			return words[0], nil
+		}
+
+		if len(wordIDs) < batchSize || lastKey >= to {
+			return nil, core.ErrNotFound
+		}
+		from = lastKey + 1
+	}
+}
+
+// sampleScan does what Sample does by going through all words matching
+// spec.
+func (repo *WordStore) sampleScan(spec core.WordSpec, key int64) (*entity.Word, error) {
+	var b util.FormatBuilder
+	b.Add("SELECT word_view.* FROM word_view WHERE")
+	wordQuerySqlWhereClause(&b, spec)
+	b.Add(" ORDER BY random_key < ?, random_key LIMIT 1;", key)
+	words, err := repo.listWords(b.Format(), b.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, core.ErrNotFound
 	}
-	return sb.String()
+	return words[0], nil
 }
 
 func wordQuerySql(query *core.WordQuery, projection string) (string, []interface{}) {
 	var b util.FormatBuilder
 
 	b.Add("SELECT \n").Add(projection).Add(" FROM word_view\n")
+
+	rankMatch := ""
+	if query.OrderByRelevance {
+		rankMatch = textSearchRankMatch(query.Spec)
+	}
+	if rankMatch != "" {
+		// Weighs matches in the word itself over matches in translations,
+		// and those over matches in notes
+		b.Add(" LEFT OUTER JOIN (SELECT word_id AS ranked_word_id, bm25(word_search, 0, 10, 5, 1) AS search_rank \n")
+		b.Add("  FROM word_search WHERE word_search MATCH ?) ON ranked_word_id = word_view.word_id \n", rankMatch)
+	}
+
 	b.Add(" WHERE \n")
 
 	wordQuerySqlWhereClause(&b, query.Spec)
 
+	if rankMatch != "" {
+		b.Add(" ORDER BY search_rank IS NULL, search_rank, word_view.word_id \n")
+	} else if query.HasRange() {
+		// Ordered so that consecutive ranges page through the words
+		b.Add(" ORDER BY word_id \n")
+	}
 	if query.HasRange() {
 		b.Add(" LIMIT ? OFFSET ? \n", query.Length, query.Offset)
 	}
@@ -214,6 +399,147 @@ func wordQuerySql(query *core.WordQuery, projection string) (string, []interface
 	return b.Format(), b.Args()
 }
 
+// tagGlobPattern returns the GLOB pattern for the tag of a TagWordSpec,
+// keeping its '*' and escaping the characters GLOB otherwise treats as
+// special.
+func tagGlobPattern(tag string) string {
+	var b strings.Builder
+	for _, r := range tag {
+		switch r {
+		case '?', '[':
+			b.WriteRune('[')
+			b.WriteRune(r)
+			b.WriteRune(']')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// textSearchMatch returns the FTS5 query matching the words of spec, or the
+// empty string if its text has no words. The text is folded as in each
+// language, since the index holds text folded in its own language, as well
+// as without the spellings of any language.
+func textSearchMatch(spec *core.TextWordSpec) string {
+	var phrases []string
+	for _, variant := range core.FoldTextVariants(spec.Text) {
+		tokens := core.TextTokens(variant)
+		if len(tokens) == 0 {
+			return ""
+		}
+		// Tokens are letters, digits and marks only, and need no escaping
+		phrase := `"` + strings.Join(tokens, " ") + `"`
+		if spec.Prefix {
+			phrase += " *"
+		}
+		phrases = append(phrases, phrase)
+	}
+	match := strings.Join(phrases, " OR ")
+	if spec.Field != core.TextFieldAny {
+		match = string(spec.Field) + " : (" + match + ")"
+	}
+	return match
+}
+
+// searchIndexSeparator is put between the translations of a word in the
+// full-text index, and between the ways a text is folded, so that a phrase
+// does not match across two of them. It is a private use character, which
+// FTS5 takes as a token of its own, but which is never among the tokens of
+// a search.
+const searchIndexSeparator = " \ue000 "
+
+// searchIndexText returns text folded and split into words for the full-text
+// index, once for each way it may be folded in its language, so that it is
+// found with and without the spellings of the language.
+func searchIndexText(text, languageCode string) string {
+	variants := []string{}
+	for _, variant := range core.FoldTextVariants(text, languageCode) {
+		variants = append(variants, strings.Join(core.TextTokens(variant), " "))
+	}
+	return strings.Join(variants, searchIndexSeparator)
+}
+
+// indexWord writes the text of the word to the full-text index, replacing
+// its earlier row. The rows are found through word_search_row by word_id,
+// as the rowid of a table with a text primary key, like word, may change on
+// VACUUM, and the word_id column of the index itself is not indexed.
+func (repo *WordStore) indexWord(word *entity.Word) error {
+	_, err := repo.db.Exec(`
+		DELETE FROM word_search
+		WHERE rowid = (SELECT search_rowid FROM word_search_row WHERE word_id = ?);`,
+		word.ID)
+	if err != nil {
+		return err
+	}
+	translations := make([]string, 0, len(word.Translations))
+	for _, tr := range word.Translations {
+		translations = append(translations, searchIndexText(tr.Translation, tr.LanguageCode))
+	}
+	result, err := repo.db.Exec(`
+		INSERT INTO word_search (word_id, word, translations, notes)
+		VALUES (?, ?, ?, ?);`,
+		word.ID,
+		searchIndexText(word.Word, word.LanguageCode),
+		strings.Join(translations, searchIndexSeparator),
+		searchIndexText(word.Notes, word.LanguageCode))
+	if err != nil {
+		return err
+	}
+	searchRowid, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = repo.db.Exec(`
+		INSERT OR REPLACE INTO word_search_row (word_id, search_rowid)
+		VALUES (?, ?);`,
+		word.ID, searchRowid)
+	return err
+}
+
+// rebuildSearchIndex indexes all words anew
+func rebuildSearchIndex(db core.DB) error {
+	_, err := db.Exec("DELETE FROM word_search; DELETE FROM word_search_row;")
+	if err != nil {
+		return err
+	}
+	wordStore := NewWordStore(db)
+	words, err := wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		return err
+	}
+	for _, word := range words {
+		err = wordStore.indexWord(word)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textSearchRankMatch returns an FTS5 query matching any of the text
+// searched for in spec outside of negations, to rank words by.
+func textSearchRankMatch(spec core.WordSpec) string {
+	var matches []string
+	var collect func(core.WordSpec)
+	collect = func(spec core.WordSpec) {
+		switch s := spec.(type) {
+		case *core.AndWordSpec:
+			collect(s.Left)
+			collect(s.Right)
+		case *core.OrWordSpec:
+			collect(s.Left)
+			collect(s.Right)
+		case *core.TextWordSpec:
+			if match := textSearchMatch(s); match != "" {
+				matches = append(matches, "("+match+")")
+			}
+		}
+	}
+	collect(spec)
+	return strings.Join(matches, " OR ")
+}
+
 func wordQuerySqlWhereClause(b *util.FormatBuilder, spec core.WordSpec) {
 	b.Add(" (")
 	switch s := spec.(type) {
@@ -236,15 +562,25 @@ func wordQuerySqlWhereClause(b *util.FormatBuilder, spec core.WordSpec) {
 		wordQuerySqlWhereClause(b, s.Spec)
 		b.Add(" )")
 	case core.TagWordSpec:
-		likePattern := fmt.Sprintf("%% %s %%", escapeSqlLikeString(string(s), '\\'))
-		b.Add(" (' ' || tags || ' ') LIKE ? ESCAPE '\\'", likePattern)
+		pattern := tagGlobPattern(string(s))
+		b.Add(" EXISTS (SELECT 1 FROM word_tag WHERE word_tag.word_id = word_view.word_id AND (word_tag.tag GLOB ? OR word_tag.tag GLOB ?))",
+			pattern, pattern+core.TagSeparator+"*")
 	case core.TranslationWordSpec:
-		likePattern := fmt.Sprintf("%% %s %%", escapeSqlLikeString(string(s), '\\'))
-		b.Add(" (' ' || translation_codes || ' ') LIKE ? ESCAPE '\\'", likePattern)
+		b.Add(" EXISTS (SELECT 1 FROM word_translation WHERE word_translation.word_id = word_view.word_id AND word_translation.language_code = ?)", string(s))
 	case core.LanguageWordSpec:
 		b.Add(" language_code is ?", string(s))
 	case core.UserWordSpec:
 		b.Add(" username is ?", string(s))
+	case core.DirectionWordSpec:
+		// Only chooses how words are shown
+		b.Add(" true")
+	case *core.TextWordSpec:
+		match := textSearchMatch(s)
+		if match == "" {
+			b.Add(" false")
+			break
+		}
+		b.Add(" word_view.word_id IN (SELECT word_id FROM word_search WHERE word_search MATCH ?)", match)
 	}
 	b.Add(" )")
 }
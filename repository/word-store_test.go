@@ -2,11 +2,15 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/ivartj/kartoteka/core"
 	entity "github.com/ivartj/kartoteka/core/entity"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
 	"testing"
+	"time"
 )
 
 type testContext struct {
@@ -129,6 +133,7 @@ func TestWordStoreBasic(t *testing.T) {
 	assert.Equal(t, words[0].ID, retWords[0].ID)
 	assert.Equal(t, words[0].ImageID, retWords[0].ImageID)
 	assert.Equal(t, words[0].UserID, retWords[0].UserID)
+	assert.Equal(t, "bob", retWords[0].UserUsername)
 }
 
 func TestWordStoreQueryLogicalOperators(t *testing.T) {
@@ -194,6 +199,126 @@ func TestWordStoreQueryLogicalOperators(t *testing.T) {
 	assert.NotEqual(t, retWords[0].ID, retWords[1].ID)
 }
 
+// Queries in SQL select the same words as matching specs against the words
+// in Go does.
+func TestWordStoreQueryMatchesSpec(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+
+	translation := func(languageCode string) *entity.WordTranslation {
+		return &entity.WordTranslation{
+			LanguageCode: languageCode,
+			Translation:  "x",
+		}
+	}
+	words := []*entity.Word{
+		{Word: "et eple", LanguageCode: "no", UserID: ctx.bobID,
+			Tags:         []string{"a1", "mat"},
+			Translations: []*entity.WordTranslation{translation("pl"), translation("en")}},
+		{Word: "en gulrot", LanguageCode: "no", UserID: ctx.aliceID,
+			Tags:         []string{"a1"},
+			Translations: []*entity.WordTranslation{translation("en")}},
+		{Word: "jabłko", LanguageCode: "pl", UserID: ctx.bobID,
+			Tags:         []string{"mat", "a1_mat"},
+			Translations: []*entity.WordTranslation{translation("no")}},
+		// Tags that LIKE patterns or concatenated tags would confuse
+		{Word: "pomarańcza", LanguageCode: "pl", UserID: ctx.aliceID,
+			Tags: []string{"a%", "ma_t"}},
+		{Word: "en banan", LanguageCode: "no", UserID: ctx.bobID,
+			Tags: []string{"mat/frukt", "b1"}},
+		{Word: "en kålrot", LanguageCode: "no", UserID: ctx.bobID,
+			Tags: []string{"mat/grønnsak/rot"}},
+		// Tags that GLOB patterns would confuse
+		{Word: "en kiwi", LanguageCode: "no", UserID: ctx.aliceID,
+			Tags: []string{"a[1]?"}},
+		{Word: "et hus", LanguageCode: "no", UserID: ctx.aliceID},
+	}
+	for _, word := range words {
+		word.ID = entity.WordID(entity.NewID())
+		err := ctx.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	retWords, err := ctx.wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		t.Fatalf("Word query failed: %s", err)
+	}
+	for _, word := range retWords {
+		assert.NotNil(t, word.Tags)
+		if word.Word == "et hus" {
+			assert.Equal(t, []string{}, word.Tags)
+		}
+		if word.Word == "pomarańcza" {
+			assert.ElementsMatch(t, []string{"a%", "ma_t"}, word.Tags)
+		}
+	}
+
+	for _, spec := range []core.WordSpec{
+		core.TagWordSpec("a1"),
+		core.TagWordSpec("mat"),
+		core.TagWordSpec("a"),
+		core.TagWordSpec("a%"),
+		core.TagWordSpec("ma_t"),
+		core.TagWordSpec("a1 mat"),
+		core.TagWordSpec(""),
+		core.TagWordSpec("mat/frukt"),
+		core.TagWordSpec("mat/*"),
+		core.TagWordSpec("mat/grønnsak"),
+		core.TagWordSpec("a*"),
+		core.TagWordSpec("*/frukt"),
+		core.TagWordSpec("*"),
+		core.TagWordSpec("a[1]?"),
+		core.TagWordSpec("a[1]*"),
+		core.TranslationWordSpec("en"),
+		core.TranslationWordSpec("pl"),
+		core.TranslationWordSpec("e"),
+		&core.NotWordSpec{Spec: core.TagWordSpec("a1")},
+		&core.NotWordSpec{Spec: core.TranslationWordSpec("en")},
+		&core.AndWordSpec{
+			Left:  core.TagWordSpec("a1"),
+			Right: core.TranslationWordSpec("pl"),
+		},
+		&core.OrWordSpec{
+			Left:  core.TagWordSpec("mat"),
+			Right: &core.NotWordSpec{Spec: core.LanguageWordSpec("no")},
+		},
+		// Directions only choose how cards are shown
+		&core.AndWordSpec{
+			Left: &core.AndWordSpec{
+				Left:  core.DirectionWordSpec(core.CardDirectionReverse),
+				Right: core.TagWordSpec("mat"),
+			},
+			Right: core.DirectionWordSpec(core.CardDirectionBoth),
+		},
+	} {
+		expected := []string{}
+		for _, word := range retWords {
+			if spec.Match(word) {
+				expected = append(expected, word.Word)
+			}
+		}
+		matches, err := ctx.wordStore.List(&core.WordQuery{Spec: spec})
+		if err != nil {
+			t.Fatalf("Word query failed: %s", err)
+		}
+		actual := []string{}
+		actualIDs := []entity.WordID{}
+		for _, word := range matches {
+			actual = append(actual, word.Word)
+			actualIDs = append(actualIDs, word.ID)
+		}
+		assert.ElementsMatch(t, expected, actual, "%#v", spec)
+
+		wordIDs, err := ctx.wordStore.ListIDs(&core.WordQuery{Spec: spec})
+		if err != nil {
+			t.Fatalf("Word ID query failed: %s", err)
+		}
+		assert.ElementsMatch(t, actualIDs, wordIDs, "%#v", spec)
+	}
+}
+
 func TestWordStoreListWithTranslations(t *testing.T) {
 	ctx := newTestContext()
 	defer ctx.db.Close()
@@ -317,3 +442,454 @@ func TestWordStoreUpdate(t *testing.T) {
 
 	assert.Equal(t, 3, len(word.Translations))
 }
+
+func TestWordStoreUpdateKeepsReviews(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	wordStore := ctx.wordStore
+	reviewStore := NewReviewStore(ctx.db)
+
+	word := &entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         "et eple",
+		LanguageCode: "no",
+		UserID:       ctx.bobID,
+	}
+	err := wordStore.Add(word)
+	if err != nil {
+		t.Fatalf("Failed to add a word: %s", err)
+	}
+	now := time.Date(2020, time.January, 10, 12, 0, 0, 0, time.UTC)
+	err = reviewStore.Add(&entity.Review{
+		ID:         entity.ReviewID(entity.NewID()),
+		UserID:     ctx.bobID,
+		WordID:     word.ID,
+		Grade:      entity.GradeGood,
+		ReviewedAt: now,
+		DueAt:      now.Add(24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a review: %s", err)
+	}
+
+	word.Notes = "A fruit"
+	err = wordStore.Update(word)
+	if err != nil {
+		t.Fatalf("Failed to update word: %s", err)
+	}
+
+	_, err = reviewStore.GetLatest(ctx.bobID, word.ID)
+	assert.Nil(t, err)
+}
+
+func TestWordStoreTextSearch(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	wordStore := ctx.wordStore
+
+	words := []*entity.Word{
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "jabłko",
+			LanguageCode: "pl",
+			UserID:       ctx.aliceID,
+			Translations: []*entity.WordTranslation{
+				{LanguageCode: "en", Translation: "apple"},
+			},
+		},
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "jabłoń",
+			LanguageCode: "pl",
+			UserID:       ctx.aliceID,
+			Notes:        "Drzewo, na którym rośnie jabłko.",
+			Translations: []*entity.WordTranslation{
+				{LanguageCode: "en", Translation: "apple tree"},
+			},
+		},
+		&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         "et eple",
+			LanguageCode: "no",
+			UserID:       ctx.bobID,
+		},
+	}
+	for _, word := range words {
+		err := wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	search := func(spec core.WordSpec) []string {
+		retWords, err := wordStore.List(&core.WordQuery{Spec: spec, OrderByRelevance: true})
+		if err != nil {
+			t.Fatalf("Failed to search words: %s", err)
+		}
+		result := []string{}
+		for _, word := range retWords {
+			result = append(result, word.Word)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"jabłko", "jabłoń"}, search(&core.TextWordSpec{Text: "Jabłko"}))
+	assert.Equal(t, []string{"jabłko"}, search(&core.TextWordSpec{Field: core.TextFieldWord, Text: "jabłko"}))
+	assert.ElementsMatch(t, []string{"jabłko", "jabłoń"}, search(&core.TextWordSpec{Field: core.TextFieldWord, Text: "jabł", Prefix: true}))
+	assert.Equal(t, []string{"jabłoń"}, search(&core.TextWordSpec{Field: core.TextFieldTranslations, Text: "apple tree"}))
+	assert.Equal(t, []string{"jabłoń"}, search(&core.TextWordSpec{Field: core.TextFieldNotes, Text: "drzewo"}))
+	assert.Equal(t, []string{}, search(&core.TextWordSpec{Text: "?!"}))
+	assert.Equal(t, []string{"jabłko"}, search(&core.AndWordSpec{
+		Left:  &core.TextWordSpec{Text: "apple"},
+		Right: &core.NotWordSpec{Spec: &core.TextWordSpec{Text: "tree"}},
+	}))
+
+	// The index follows changes to words and their translations
+	words[2].Translations = []*entity.WordTranslation{
+		{LanguageCode: "en", Translation: "an apple"},
+	}
+	err := wordStore.Update(words[2])
+	if err != nil {
+		t.Fatalf("Failed to update a word: %s", err)
+	}
+	assert.ElementsMatch(t, []string{"jabłko", "jabłoń", "et eple"}, search(&core.TextWordSpec{Field: core.TextFieldTranslations, Text: "apple"}))
+	err = wordStore.Delete(words[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to delete a word: %s", err)
+	}
+	assert.ElementsMatch(t, []string{"jabłoń", "et eple"}, search(&core.TextWordSpec{Text: "apple"}))
+
+	count, err := wordStore.Count(&core.WordQuery{Spec: &core.TextWordSpec{Text: "apple"}, OrderByRelevance: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// Text is folded in its own language, so that it is found with and
+	// without diacritics
+	assert.Equal(t, []string{"jabłoń"}, search(&core.TextWordSpec{Field: core.TextFieldWord, Text: "JABLON"}))
+	assert.Equal(t, []string{"jabłoń"}, search(&core.TextWordSpec{Field: core.TextFieldNotes, Text: "ktorym rosnie"}))
+	words[2].Word = "et blåbær"
+	err = wordStore.Update(words[2])
+	if err != nil {
+		t.Fatalf("Failed to update a word: %s", err)
+	}
+	assert.Equal(t, []string{"et blåbær"}, search(&core.TextWordSpec{Field: core.TextFieldWord, Text: "blabaer"}))
+	assert.Equal(t, []string{"et blåbær"}, search(&core.TextWordSpec{Field: core.TextFieldWord, Text: "blåbæ", Prefix: true}))
+	assert.Equal(t, []string{"et blåbær"}, search(&core.TextWordSpec{Field: core.TextFieldWord, Text: "blabar"}))
+
+	// Letters spelled the way of the language are also found without their
+	// diacritics
+	err = NewLanguageStore(ctx.db).Update(&entity.Language{Code: "de", NativeName: "Deutsch"})
+	if err != nil {
+		t.Fatalf("Failed to add a language: %s", err)
+	}
+	for _, word := range []*entity.Word{
+		{Word: "ein Mädchen", LanguageCode: "de"},
+		{Word: "Ærlig", LanguageCode: "no"},
+	} {
+		word.ID = entity.WordID(entity.NewID())
+		word.UserID = ctx.bobID
+		err = wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+	for text, expected := range map[string][]string{
+		"madchen":     {"ein Mädchen"},
+		"maedchen":    {"ein Mädchen"},
+		"ein madchen": {"ein Mädchen"},
+		"arlig":       {"Ærlig"},
+		"aerlig":      {"Ærlig"},
+		"ærlig":       {"Ærlig"},
+	} {
+		assert.Equal(t, expected, search(&core.AndWordSpec{
+			Left:  &core.TextWordSpec{Text: text},
+			Right: core.UserWordSpec("bob"),
+		}), text)
+	}
+}
+
+// The full-text index finds the same words as matching them one by one
+func TestWordStoreTextSearchMatchesSpec(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	err := NewLanguageStore(ctx.db).Update(&entity.Language{Code: "de", NativeName: "Deutsch"})
+	if err != nil {
+		t.Fatalf("Failed to add a language: %s", err)
+	}
+
+	words := []*entity.Word{
+		{Word: "a big dog", LanguageCode: "en", Translations: []*entity.WordTranslation{
+			{LanguageCode: "pl", Translation: "duży pies"},
+		}},
+		// Phrases do not match across translations
+		{Word: "big", LanguageCode: "en", Translations: []*entity.WordTranslation{
+			{LanguageCode: "pl", Translation: "duży"},
+			{LanguageCode: "pl", Translation: "pies"},
+		}},
+		// Nor across the ways a text is folded
+		{Word: "Mädchen Junge", LanguageCode: "de"},
+	}
+	for _, word := range words {
+		word.ID = entity.WordID(entity.NewID())
+		word.UserID = ctx.bobID
+		err = ctx.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	for _, spec := range []*core.TextWordSpec{
+		{Text: "duży pies"},
+		{Text: "duzy pies"},
+		{Field: core.TextFieldTranslations, Text: "duży pies"},
+		{Text: "duży pi", Prefix: true},
+		{Text: "pies duży"},
+		{Text: "duży"},
+		{Text: "pies"},
+		{Text: "big dog"},
+		{Text: "madchen junge"},
+		{Text: "maedchen junge"},
+		{Text: "junge maedchen"},
+		{Text: "junge madchen"},
+		{Text: "junge"},
+	} {
+		expected := []string{}
+		for _, word := range words {
+			if spec.Match(word) {
+				expected = append(expected, word.Word)
+			}
+		}
+		matches, err := ctx.wordStore.List(&core.WordQuery{Spec: spec})
+		if err != nil {
+			t.Fatalf("Word query failed: %s", err)
+		}
+		actual := []string{}
+		for _, word := range matches {
+			actual = append(actual, word.Word)
+		}
+		assert.ElementsMatch(t, expected, actual, "%#v", spec)
+	}
+}
+
+func TestSearchIndexRebuild(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+
+	err := ctx.wordStore.Add(&entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         "źródło",
+		LanguageCode: "pl",
+		UserID:       ctx.aliceID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to add a word: %s", err)
+	}
+	_, err = ctx.db.Exec("DELETE FROM word_search;")
+	if err != nil {
+		panic(err)
+	}
+	err = InitSchema(ctx.db)
+	if err != nil {
+		t.Fatalf("Failed to initialize schema: %s", err)
+	}
+	count, err := ctx.wordStore.Count(&core.WordQuery{Spec: &core.TextWordSpec{Text: "zrodlo"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// The rowids of words may change, as on VACUUM, without the full-text index
+// pointing at the wrong words.
+func TestSearchIndexRowidChange(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+
+	words := []*entity.Word{}
+	for _, text := range []string{"źródło", "jabłko"} {
+		word := &entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         text,
+			LanguageCode: "pl",
+			UserID:       ctx.aliceID,
+		}
+		err := ctx.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+		words = append(words, word)
+	}
+	_, err := ctx.db.Exec("UPDATE word SET rowid = rowid + 100;")
+	if err != nil {
+		panic(err)
+	}
+	count := func(text string) int {
+		count, err := ctx.wordStore.Count(&core.WordQuery{Spec: &core.TextWordSpec{Text: text}})
+		assert.NoError(t, err)
+		return count
+	}
+
+	words[0].Word = "woda"
+	err = ctx.wordStore.Update(words[0])
+	if err != nil {
+		t.Fatalf("Failed to update a word: %s", err)
+	}
+	assert.Equal(t, 0, count("zrodlo"))
+	assert.Equal(t, 1, count("woda"))
+	assert.Equal(t, 1, count("jablko"))
+
+	err = ctx.wordStore.Delete(words[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to delete a word: %s", err)
+	}
+	assert.Equal(t, 0, count("jablko"))
+	assert.Equal(t, 1, count("woda"))
+	var indexed int
+	err = ctx.db.QueryRow("SELECT count(*) FROM word_search;").Scan(&indexed)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, indexed)
+}
+
+func TestWordStoreSample(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+
+	words := map[string][]string{
+		"et eple":   {"a1", "mat"},
+		"en gulrot": {"a1", "mat"},
+		"en banan":  {"a2", "mat"},
+		"et hus":    {"a1"},
+	}
+	for word, tags := range words {
+		err := ctx.wordStore.Add(&entity.Word{
+			ID:           entity.WordID(entity.NewID()),
+			Word:         word,
+			LanguageCode: "no",
+			UserID:       ctx.bobID,
+			Tags:         tags,
+		})
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(0))
+	drawn := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		word, err := ctx.wordStore.Sample(core.TagWordSpec("mat"), rng.Int())
+		if err != nil {
+			t.Fatalf("Failed to sample a word: %s", err)
+		}
+		assert.Contains(t, word.Tags, "mat")
+		drawn[word.Word] = true
+	}
+	assert.Equal(t, map[string]bool{"et eple": true, "en gulrot": true, "en banan": true}, drawn)
+
+	// Keys after the last word come back around to the first
+	for _, key := range []int{0, math.MaxInt64} {
+		word, err := ctx.wordStore.Sample(core.AnyWordSpec{}, key)
+		assert.NoError(t, err)
+		assert.NotNil(t, word)
+	}
+
+	_, err := ctx.wordStore.Sample(core.TagWordSpec("b1"), rng.Int())
+	assert.ErrorIs(t, err, core.ErrNotFound)
+}
+
+func TestWordStoreSampleFewMatches(t *testing.T) {
+	ctx := newTestContext()
+	defer ctx.db.Close()
+	addGeneratedWords(ctx.db, ctx.bobID, 3*sampleLimit)
+
+	rare := &entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         "et ekorn",
+		LanguageCode: "no",
+		UserID:       ctx.bobID,
+		Tags:         []string{"sjelden"},
+	}
+	err := ctx.wordStore.Add(rare)
+	if err != nil {
+		t.Fatalf("Failed to add a word: %s", err)
+	}
+
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 10; i++ {
+		word, err := ctx.wordStore.Sample(core.TagWordSpec("sjelden"), rng.Int())
+		if err != nil {
+			t.Fatalf("Failed to sample a word: %s", err)
+		}
+		assert.Equal(t, rare.ID, word.ID)
+	}
+}
+
+// addGeneratedWords adds n Norwegian words with English translations, a
+// tenth of them tagged a1 and the rest b1, in bulk rather than through a
+// word store.
+func addGeneratedWords(db *sql.DB, userID entity.UserID, n int) {
+	_, err := db.Exec(`
+		WITH RECURSIVE seq(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM seq WHERE i < ?)
+		INSERT INTO word (word_id, word, language_code, user_id, notes, random_key)
+		SELECT 'generated-' || i, 'ord ' || i, 'no', ?, '', random() & 9223372036854775807
+		FROM seq;`,
+		n, userID)
+	if err != nil {
+		panic(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO word_translation (word_id, language_code, translation)
+		SELECT word_id, 'en', 'word ' || substr(word, 5) FROM word WHERE word_id LIKE 'generated-%';`)
+	if err != nil {
+		panic(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO word_tag (word_id, tag)
+		SELECT word_id, CASE WHEN rowid % 10 = 0 THEN 'a1' ELSE 'b1' END
+		FROM word WHERE word_id LIKE 'generated-%';`)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Drawing a word takes about as long with a hundred thousand words as with
+// a thousand, unlike counting the matches and listing one at a random
+// offset, which takes time in proportion to the number of words.
+func BenchmarkWordStoreSample(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		ctx := newTestContext()
+		addGeneratedWords(ctx.db, ctx.bobID, n)
+		rng := rand.New(rand.NewSource(0))
+		for _, spec := range []core.WordSpec{core.AnyWordSpec{}, core.TagWordSpec("a1")} {
+			b.Run(fmt.Sprintf("words=%d/spec=%T", n, spec), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := ctx.wordStore.Sample(spec, rng.Int())
+					if err != nil {
+						b.Fatalf("Failed to sample a word: %s", err)
+					}
+				}
+			})
+		}
+		ctx.db.Close()
+	}
+}
+
+func BenchmarkWordStoreCountAndOffset(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		ctx := newTestContext()
+		addGeneratedWords(ctx.db, ctx.bobID, n)
+		rng := rand.New(rand.NewSource(0))
+		b.Run(fmt.Sprintf("words=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				query := core.WordQuery{Spec: core.AnyWordSpec{}}
+				count, err := ctx.wordStore.Count(&query)
+				if err != nil {
+					b.Fatalf("Failed to count words: %s", err)
+				}
+				query.SetRange(rng.Int()%count, 1)
+				_, err = ctx.wordStore.List(&query)
+				if err != nil {
+					b.Fatalf("Failed to list a word: %s", err)
+				}
+			}
+		})
+		ctx.db.Close()
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"golang.org/x/crypto/bcrypt"
+	"net/mail"
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	minimumPasswordLength = 8
+	// bcrypt ignores anything past 72 bytes
+	maximumPasswordLength = 72
+)
+
+var ErrInvalidCredentials = errors.New("Invalid username or password")
+
+var validUsername = regexp.MustCompile(`^[\p{L}\p{N}_.-]{1,32}$`)
+
+type AccountService struct {
+	userStore core.UserStore
+}
+
+func NewAccountService(userStore core.UserStore) *AccountService {
+	return &AccountService{
+		userStore: userStore,
+	}
+}
+
+// The e-mail address is stored as unverified.
+func (service *AccountService) Register(username, email, password string) (*entity.User, error) {
+	if !validUsername.MatchString(username) {
+		return nil, fmt.Errorf("%w: usernames may only contain letters, digits, '_', '.' and '-', and be at most 32 characters long", core.ErrInvalid)
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return nil, fmt.Errorf("%w: '%s' is not a valid e-mail address", core.ErrInvalid, email)
+	}
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = service.userStore.GetByUsername(username)
+	if err == nil {
+		return nil, fmt.Errorf("%w: the username '%s' is taken", core.ErrAlreadyExists, username)
+	} else if err != core.ErrNotFound {
+		return nil, err
+	}
+	_, err = service.userStore.GetByEmail(email)
+	if err == nil {
+		return nil, fmt.Errorf("%w: the e-mail address '%s' is already registered", core.ErrAlreadyExists, email)
+	} else if err != core.ErrNotFound {
+		return nil, err
+	}
+
+	user := &entity.User{
+		ID:              entity.UserID(entity.NewID()),
+		Username:        username,
+		EmailUnverified: email,
+		PasswordHash:    passwordHash,
+	}
+	err = service.userStore.Update(user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (service *AccountService) Authenticate(username, password string) (*entity.User, error) {
+	user, err := service.userStore.GetByUsername(username)
+	if err == core.ErrNotFound {
+		// Spend the same time as for an existing user, so that response
+		// times do not reveal which usernames exist
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if user.PasswordHash == "" {
+		return nil, ErrInvalidCredentials
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (service *AccountService) SetPassword(user *entity.User, password string) error {
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = passwordHash
+	return service.userStore.Update(user)
+}
+
+// Makes the address verified, provided it is still the unverified address
+// of the user.
+func (service *AccountService) VerifyEmail(user *entity.User, email string) error {
+	if user.EmailUnverified != email {
+		return fmt.Errorf("%w: '%s' is no longer the e-mail address of the account", core.ErrInvalid, email)
+	}
+	other, err := service.userStore.GetByEmail(email)
+	if err == nil && other.ID != user.ID {
+		return fmt.Errorf("%w: the e-mail address '%s' is already registered", core.ErrAlreadyExists, email)
+	} else if err != nil && err != core.ErrNotFound {
+		return err
+	}
+	user.Email = email
+	user.EmailUnverified = ""
+	return service.userStore.Update(user)
+}
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func hashPassword(password string) (string, error) {
+	if utf8.RuneCountInString(password) < minimumPasswordLength {
+		return "", fmt.Errorf("%w: passwords need to be at least %d characters long", core.ErrInvalid, minimumPasswordLength)
+	}
+	if len(password) > maximumPasswordLength {
+		return "", fmt.Errorf("%w: passwords can be at most %d bytes long", core.ErrInvalid, maximumPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The longest answer, in characters, that is graded. Grading takes time and
+// memory in proportion to the length of the answer times that of the
+// expected answer.
+const MaximumAnswerLength = 200
+
+type AnswerGrade int
+
+const (
+	AnswerWrong AnswerGrade = iota
+	// Within a few typing mistakes of the expected answer
+	AnswerTypo
+	// Differs from the expected answer only in diacritics or in how letters
+	// are spelled without them
+	AnswerAccentMismatch
+	// Equal to the expected answer, ignoring case and extra whitespace
+	AnswerExact
+)
+
+func (grade AnswerGrade) String() string {
+	switch grade {
+	case AnswerExact:
+		return "exact"
+	case AnswerAccentMismatch:
+		return "accent-mismatch"
+	case AnswerTypo:
+		return "typo"
+	default:
+		return "wrong"
+	}
+}
+
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	// Text in the expected answer missing from the given one
+	DiffInsert
+	// Text in the given answer not in the expected one
+	DiffDelete
+)
+
+type DiffSpan struct {
+	Op   DiffOp
+	Text string
+}
+
+func (span DiffSpan) IsEqual() bool  { return span.Op == DiffEqual }
+func (span DiffSpan) IsInsert() bool { return span.Op == DiffInsert }
+func (span DiffSpan) IsDelete() bool { return span.Op == DiffDelete }
+
+type AcceptedAnswer struct {
+	Text         string
+	LanguageCode string
+}
+
+type AnswerResult struct {
+	Grade AnswerGrade
+	// The expected answer closest to the given one
+	Expected             string
+	ExpectedLanguageCode string
+	// Turns the given answer into the expected one
+	Diff []DiffSpan
+}
+
+// GradeAnswer grades answer against the accepted answers. Each accepted
+// answer may list alternatives separated by commas, semicolons or slashes, as
+// in "lustro, lusterko", any of which is accepted. The difference is left out
+// when the answer or the expected answer is longer than MaximumAnswerLength.
+func GradeAnswer(answer string, accepted []AcceptedAnswer) *AnswerResult {
+	answer = normalizeAnswer(answer)
+	var best *AnswerResult
+	bestDistance := 0
+	for _, acceptedAnswer := range accepted {
+		for _, expected := range answerAlternatives(acceptedAnswer.Text) {
+			grade, distance := gradeAlternative(answer, expected, acceptedAnswer.LanguageCode)
+			if best == nil || grade > best.Grade || (grade == best.Grade && distance < bestDistance) {
+				best = &AnswerResult{
+					Grade:                grade,
+					Expected:             expected,
+					ExpectedLanguageCode: acceptedAnswer.LanguageCode,
+				}
+				bestDistance = distance
+			}
+		}
+	}
+	if best == nil {
+		return &AnswerResult{Grade: AnswerWrong}
+	}
+	if utf8.RuneCountInString(answer) <= MaximumAnswerLength &&
+		utf8.RuneCountInString(best.Expected) <= MaximumAnswerLength {
+		best.Diff = diffAnswer(answer, best.Expected)
+	}
+	return best
+}
+
+func gradeAlternative(answer, expected, languageCode string) (AnswerGrade, int) {
+	if strings.EqualFold(answer, expected) {
+		return AnswerExact, 0
+	}
+	// Answers leaving out diacritics are accepted whether or not letters
+	// are spelled the way of the language, as both "madchen" and
+	// "maedchen" for German "Mädchen"
+	answerVariants := core.FoldTextVariants(answer, languageCode)
+	expectedVariants := core.FoldTextVariants(expected, languageCode)
+	for _, answerVariant := range answerVariants {
+		for _, expectedVariant := range expectedVariants {
+			if answerVariant == expectedVariant {
+				return AnswerAccentMismatch, 0
+			}
+		}
+	}
+	foldedExpected := []rune(core.FoldText(expected, languageCode))
+	distance := damerauLevenshtein([]rune(core.FoldText(answer, languageCode)), foldedExpected)
+	if distance <= typoThreshold(len(foldedExpected)) {
+		return AnswerTypo, distance
+	}
+	return AnswerWrong, distance
+}
+
+// typoThreshold returns how many typing mistakes are allowed in an answer of
+// the given length, none for short words where one letter is often the
+// difference between two words.
+func typoThreshold(length int) int {
+	threshold := length / 5
+	if threshold > 3 {
+		threshold = 3
+	}
+	return threshold
+}
+
+func normalizeAnswer(answer string) string {
+	return strings.Join(strings.Fields(answer), " ")
+}
+
+func answerAlternatives(accepted string) []string {
+	alternatives := []string{}
+	for _, alternative := range strings.FieldsFunc(accepted, func(r rune) bool {
+		return r == ',' || r == ';' || r == '/'
+	}) {
+		alternative = normalizeAnswer(alternative)
+		if alternative != "" {
+			alternatives = append(alternatives, alternative)
+		}
+	}
+	return alternatives
+}
+
+// damerauLevenshtein returns the optimal string alignment distance between a
+// and b, counting insertions, deletions, substitutions and transpositions of
+// adjacent characters. Only the last three rows of the distances are kept.
+func damerauLevenshtein(a, b []rune) int {
+	previous2 := make([]int, len(b)+1)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				current[j] = minInt(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	min := first
+	for _, n := range rest {
+		if n < min {
+			min = n
+		}
+	}
+	return min
+}
+
+// diffAnswer returns the character-level difference from answer to expected
+// by their longest common subsequence, ignoring case.
+func diffAnswer(answer, expected string) []DiffSpan {
+	a := []rune(answer)
+	b := []rune(expected)
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if equalFoldRune(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	spans := []DiffSpan{}
+	add := func(op DiffOp, r rune) {
+		if len(spans) != 0 && spans[len(spans)-1].Op == op {
+			spans[len(spans)-1].Text += string(r)
+		} else {
+			spans = append(spans, DiffSpan{Op: op, Text: string(r)})
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && equalFoldRune(a[i], b[j]):
+			add(DiffEqual, b[j])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			add(DiffDelete, a[i])
+			i++
+		default:
+			add(DiffInsert, b[j])
+			j++
+		}
+	}
+	return spans
+}
+
+func equalFoldRune(a, b rune) bool {
+	return unicode.ToLower(a) == unicode.ToLower(b)
+}
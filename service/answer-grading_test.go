@@ -0,0 +1,80 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestGradeAnswer(t *testing.T) {
+	for _, c := range []struct {
+		answer   string
+		accepted []string
+		language string
+		grade    AnswerGrade
+		expected string
+	}{
+		{"jabłko", []string{"jabłko"}, "pl", AnswerExact, "jabłko"},
+		{"  Jabłko ", []string{"jabłko"}, "pl", AnswerExact, "jabłko"},
+		{"jablko", []string{"jabłko"}, "pl", AnswerAccentMismatch, "jabłko"},
+		{"blabaer", []string{"blåbær"}, "no", AnswerAccentMismatch, "blåbær"},
+		{"Madchen", []string{"Mädchen"}, "de", AnswerAccentMismatch, "Mädchen"},
+		{"Maedchen", []string{"Mädchen"}, "de", AnswerAccentMismatch, "Mädchen"},
+		{"arlig", []string{"ærlig"}, "no", AnswerAccentMismatch, "ærlig"},
+		{"Medchen", []string{"Mädchen"}, "de", AnswerTypo, "Mädchen"},
+		{"jabkło", []string{"jabłko"}, "pl", AnswerTypo, "jabłko"},
+		{"samochud", []string{"samochód"}, "pl", AnswerTypo, "samochód"},
+		{"kit", []string{"kot"}, "pl", AnswerWrong, "kot"},
+		{"gruszka", []string{"jabłko"}, "pl", AnswerWrong, "jabłko"},
+		{"lusterko", []string{"lustro, lusterko"}, "pl", AnswerExact, "lusterko"},
+		{"en sykel", []string{"et eple", "en sykkel"}, "no", AnswerTypo, "en sykkel"},
+	} {
+		accepted := []AcceptedAnswer{}
+		for _, text := range c.accepted {
+			accepted = append(accepted, AcceptedAnswer{Text: text, LanguageCode: c.language})
+		}
+		result := GradeAnswer(c.answer, accepted)
+		assert.Equal(t, c.grade, result.Grade, c.answer)
+		assert.Equal(t, c.expected, result.Expected, c.answer)
+	}
+
+	assert.Equal(t, AnswerWrong, GradeAnswer("anything", nil).Grade)
+
+	result := GradeAnswer("maedchen", []AcceptedAnswer{
+		{Text: "girl", LanguageCode: "en"},
+		{Text: "Mädchen", LanguageCode: "de"},
+	})
+	assert.Equal(t, AnswerAccentMismatch, result.Grade)
+	assert.Equal(t, "de", result.ExpectedLanguageCode)
+
+	result = GradeAnswer(strings.Repeat("jabłko ", MaximumAnswerLength), []AcceptedAnswer{
+		{Text: "jabłko", LanguageCode: "pl"},
+	})
+	assert.Equal(t, AnswerWrong, result.Grade)
+	assert.Nil(t, result.Diff)
+}
+
+func TestDiffAnswer(t *testing.T) {
+	assert.Equal(t, []DiffSpan{
+		{DiffEqual, "jab"},
+		{DiffDelete, "l"},
+		{DiffInsert, "ł"},
+		{DiffEqual, "ko"},
+	}, diffAnswer("jablko", "jabłko"))
+	assert.Equal(t, []DiffSpan{
+		{DiffEqual, "Kot"},
+		{DiffInsert, "ek"},
+	}, diffAnswer("KOT", "Kotek"))
+	assert.Equal(t, []DiffSpan{
+		{DiffDelete, "abc"},
+	}, diffAnswer("abc", ""))
+}
+
+func TestDamerauLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, damerauLevenshtein([]rune("kot"), []rune("kot")))
+	assert.Equal(t, 1, damerauLevenshtein([]rune("kto"), []rune("kot")))
+	assert.Equal(t, 1, damerauLevenshtein([]rune("kott"), []rune("kot")))
+	assert.Equal(t, 3, damerauLevenshtein([]rune(""), []rune("kot")))
+	assert.Equal(t, 3, damerauLevenshtein([]rune("kot"), []rune("")))
+	assert.Equal(t, 2, damerauLevenshtein([]rune("abcdef"), []rune("bacdfe")))
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+)
+
+// How many words are drawn before giving up on finding one with a
+// translation to ask for
+const choiceQuizWordDraws = 10
+
+type QuizChoice struct {
+	Text    string
+	Correct bool
+}
+
+type ChoiceQuestion struct {
+	Word           *entity.Word
+	AnswerLanguage string
+	// The right translation among distractors, in random order
+	Choices []*QuizChoice
+}
+
+// Makes multiple-choice questions out of words matching a spec, with the
+// wrong choices taken from the translations of other words matching the
+// spec, preferably those sharing a tag with the word asked for, so that they
+// are plausible answers.
+type ChoiceQuiz struct {
+	wordStore core.WordStore
+	spec      core.WordSpec
+	rng       core.Rand
+}
+
+func NewChoiceQuiz(wordStore core.WordStore, spec core.WordSpec, rng core.Rand) *ChoiceQuiz {
+	return &ChoiceQuiz{
+		wordStore: wordStore,
+		spec:      spec,
+		rng:       rng,
+	}
+}
+
+// NewQuestion draws a word and up to choiceCount choices of translations
+// into answerLanguage, or into the language of one of the word's
+// translations if answerLanguage is empty. There are fewer choices if too few
+// words have other translations.
+func (quiz *ChoiceQuiz) NewQuestion(answerLanguage string, choiceCount int) (*ChoiceQuestion, error) {
+	spec := quiz.spec
+	if answerLanguage != "" {
+		spec = &core.AndWordSpec{
+			Left:  spec,
+			Right: core.TranslationWordSpec(answerLanguage),
+		}
+	}
+	lottery := NewWordLottery(quiz.wordStore, spec, quiz.rng)
+	var word *entity.Word
+	for i := 0; i < choiceQuizWordDraws && word == nil; i++ {
+		drawn, err := lottery.DrawWord()
+		if err != nil {
+			return nil, err
+		}
+		if len(drawn.Translations) != 0 {
+			word = drawn
+		}
+	}
+	if word == nil {
+		return nil, core.ErrNotFound
+	}
+	if answerLanguage == "" {
+		answerLanguage = word.Translations[quiz.rng.Int()%len(word.Translations)].LanguageCode
+	}
+
+	answers := translationsInLanguage(word, answerLanguage)
+	question := &ChoiceQuestion{
+		Word:           word,
+		AnswerLanguage: answerLanguage,
+		Choices: []*QuizChoice{{
+			Text:    answers[quiz.rng.Int()%len(answers)].Translation,
+			Correct: true,
+		}},
+	}
+	seenTexts := map[string]bool{}
+	for _, answer := range answers {
+		seenTexts[core.FoldText(answer.Translation, answerLanguage)] = true
+	}
+	seenWords := map[entity.WordID]bool{word.ID: true}
+
+	// The wider pools are only drawn from when the narrower ones run out
+	pools := []core.WordSpec{}
+	similar := core.WordSpec(&core.AndWordSpec{
+		Left: &core.AndWordSpec{
+			Left:  quiz.spec,
+			Right: core.LanguageWordSpec(word.LanguageCode),
+		},
+		Right: core.TranslationWordSpec(answerLanguage),
+	})
+	if tags := tagsSpec(word.Tags); tags != nil {
+		pools = append(pools, &core.AndWordSpec{
+			Left:  similar,
+			Right: tags,
+		})
+	}
+	pools = append(pools, similar)
+
+	for _, pool := range pools {
+		if len(question.Choices) >= choiceCount {
+			break
+		}
+		err := quiz.addDistractors(question, pool, choiceCount, seenWords, seenTexts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := len(question.Choices) - 1; i > 0; i-- {
+		j := quiz.rng.Int() % (i + 1)
+		question.Choices[i], question.Choices[j] = question.Choices[j], question.Choices[i]
+	}
+	return question, nil
+}
+
+// addDistractors adds choices from words at random offsets among those
+// matching pool until there are choiceCount choices or a bounded number of
+// words have been tried.
+func (quiz *ChoiceQuiz) addDistractors(question *ChoiceQuestion, pool core.WordSpec, choiceCount int, seenWords map[entity.WordID]bool, seenTexts map[string]bool) error {
+	query := core.WordQuery{
+		Spec: pool,
+	}
+	count, err := quiz.wordStore.Count(&query)
+	if err != nil {
+		return fmt.Errorf("Error getting a count of words for distractors: %w", err)
+	}
+	// Words already taken or with the same translations are skipped, so a
+	// few more are tried than choices are missing
+	tries := 3 * choiceCount
+	if tries > count {
+		tries = count
+	}
+	triedOffsets := map[int]bool{}
+	for len(triedOffsets) < tries && len(question.Choices) < choiceCount {
+		offset := quiz.rng.Int() % count
+		if triedOffsets[offset] {
+			continue
+		}
+		triedOffsets[offset] = true
+		query.SetRange(offset, 1)
+		words, err := quiz.wordStore.List(&query)
+		if err != nil {
+			return fmt.Errorf("Error getting a word for distractors at a random offset: %w", err)
+		}
+		if len(words) == 0 || seenWords[words[0].ID] {
+			continue
+		}
+		seenWords[words[0].ID] = true
+		translations := translationsInLanguage(words[0], question.AnswerLanguage)
+		if len(translations) == 0 {
+			continue
+		}
+		text := translations[quiz.rng.Int()%len(translations)].Translation
+		foldedText := core.FoldText(text, question.AnswerLanguage)
+		if seenTexts[foldedText] {
+			continue
+		}
+		seenTexts[foldedText] = true
+		question.Choices = append(question.Choices, &QuizChoice{
+			Text: text,
+		})
+	}
+	return nil
+}
+
+// IsCorrectChoice reports whether choice is one of the word's translations
+// into answerLanguage.
+func IsCorrectChoice(word *entity.Word, answerLanguage, choice string) bool {
+	for _, translation := range translationsInLanguage(word, answerLanguage) {
+		if translation.Translation == choice {
+			return true
+		}
+	}
+	return false
+}
+
+// tagsSpec returns a spec matching words with any of the tags, or nil if
+// there are none.
+func tagsSpec(tags []string) core.WordSpec {
+	var spec core.WordSpec
+	for _, tag := range tags {
+		if spec == nil {
+			spec = core.TagWordSpec(tag)
+		} else {
+			spec = &core.OrWordSpec{
+				Left:  spec,
+				Right: core.TagWordSpec(tag),
+			}
+		}
+	}
+	return spec
+}
+
+func translationsInLanguage(word *entity.Word, languageCode string) []*entity.WordTranslation {
+	translations := []*entity.WordTranslation{}
+	for _, translation := range word.Translations {
+		if translation.LanguageCode == languageCode {
+			translations = append(translations, translation)
+		}
+	}
+	return translations
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// A word store listing words in memory by matching specs against them
+type memoryWordStore struct {
+	words []*entity.Word
+}
+
+func (store *memoryWordStore) Get(id entity.WordID) (*entity.Word, error) {
+	for _, word := range store.words {
+		if word.ID == id {
+			return word, nil
+		}
+	}
+	return nil, core.ErrNotFound
+}
+
+func (store *memoryWordStore) Add(word *entity.Word) error {
+	store.words = append(store.words, word)
+	return nil
+}
+
+func (store *memoryWordStore) Update(word *entity.Word) error {
+	return nil
+}
+
+func (store *memoryWordStore) Delete(id entity.WordID) error {
+	return nil
+}
+
+func (store *memoryWordStore) List(query *core.WordQuery) ([]*entity.Word, error) {
+	words := []*entity.Word{}
+	for _, word := range store.words {
+		if query.Spec.Match(word) {
+			words = append(words, word)
+		}
+	}
+	if query.HasRange() {
+		if query.Offset >= len(words) {
+			return []*entity.Word{}, nil
+		}
+		words = words[query.Offset:]
+		if query.Length < len(words) {
+			words = words[:query.Length]
+		}
+	}
+	return words, nil
+}
+
+func (store *memoryWordStore) Count(query *core.WordQuery) (int, error) {
+	words, err := store.List(&core.WordQuery{Spec: query.Spec})
+	return len(words), err
+}
+
+func (store *memoryWordStore) ListIDs(query *core.WordQuery) ([]entity.WordID, error) {
+	words, err := store.List(query)
+	if err != nil {
+		return nil, err
+	}
+	wordIDs := []entity.WordID{}
+	for _, word := range words {
+		wordIDs = append(wordIDs, word.ID)
+	}
+	return wordIDs, nil
+}
+
+func (store *memoryWordStore) Sample(spec core.WordSpec, key int) (*entity.Word, error) {
+	words, err := store.List(&core.WordQuery{Spec: spec})
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, core.ErrNotFound
+	}
+	return words[key%len(words)], nil
+}
+
+func choiceQuizWord(word string, tags []string, translations ...string) *entity.Word {
+	w := &entity.Word{
+		ID:           entity.WordID(entity.NewID()),
+		Word:         word,
+		LanguageCode: "pl",
+		Tags:         tags,
+	}
+	for _, translation := range translations {
+		w.Translations = append(w.Translations, &entity.WordTranslation{
+			WordID:       w.ID,
+			LanguageCode: "en",
+			Translation:  translation,
+		})
+	}
+	return w
+}
+
+func TestChoiceQuizDistractors(t *testing.T) {
+	store := &memoryWordStore{}
+	store.Add(choiceQuizWord("jabłko", []string{"a1", "food"}, "apple"))
+	store.Add(choiceQuizWord("gruszka", []string{"a1", "food"}, "pear"))
+	store.Add(choiceQuizWord("śliwka", []string{"a1", "food"}, "plum"))
+	// The same translation as another word is never a second choice
+	store.Add(choiceQuizWord("jabłuszko", []string{"a1", "food"}, "Apple"))
+	store.Add(choiceQuizWord("samochód", []string{"b1"}, "car"))
+	store.Add(choiceQuizWord("dom", []string{"b1"}, "house"))
+	// Words without a translation into the answer language are skipped
+	store.Add(choiceQuizWord("kot", []string{"a1", "food"}))
+
+	for seed := int64(0); seed < 20; seed++ {
+		quiz := NewChoiceQuiz(store, core.TagWordSpec("food"), rand.New(rand.NewSource(seed)))
+		question, err := quiz.NewQuestion("en", 4)
+		if err != nil {
+			t.Fatalf("Failed to make a question: %s", err)
+		}
+		assert.Equal(t, "en", question.AnswerLanguage)
+		assert.Contains(t, question.Word.Tags, "food")
+		texts := map[string]bool{}
+		correct := 0
+		for _, choice := range question.Choices {
+			folded := core.FoldText(choice.Text, "en")
+			assert.False(t, texts[folded], "Duplicate choice %s", choice.Text)
+			texts[folded] = true
+			assert.NotContains(t, []string{"car", "house"}, choice.Text)
+			assert.Equal(t, choice.Correct, IsCorrectChoice(question.Word, "en", choice.Text))
+			if choice.Correct {
+				correct++
+			}
+		}
+		assert.Equal(t, 1, correct)
+		assert.Len(t, question.Choices, 3)
+	}
+}
+
+func TestChoiceQuizPrefersSharedTags(t *testing.T) {
+	store := &memoryWordStore{}
+	store.Add(choiceQuizWord("jabłko", []string{"a1", "food"}, "apple"))
+	store.Add(choiceQuizWord("gruszka", []string{"a1", "food"}, "pear"))
+	store.Add(choiceQuizWord("śliwka", []string{"a1", "food"}, "plum"))
+	store.Add(choiceQuizWord("samochód", []string{"b1"}, "car"))
+	store.Add(choiceQuizWord("dom", []string{"b1"}, "house"))
+
+	for seed := int64(0); seed < 20; seed++ {
+		quiz := NewChoiceQuiz(store, core.LanguageWordSpec("pl"), rand.New(rand.NewSource(seed)))
+		question, err := quiz.NewQuestion("", 3)
+		if err != nil {
+			t.Fatalf("Failed to make a question: %s", err)
+		}
+		assert.Len(t, question.Choices, 3)
+		if len(question.Word.Tags) != 0 && question.Word.Tags[0] == "a1" {
+			for _, choice := range question.Choices {
+				assert.NotContains(t, []string{"car", "house"}, choice.Text)
+			}
+		}
+	}
+}
+
+func TestChoiceQuizNoMatches(t *testing.T) {
+	store := &memoryWordStore{}
+	store.Add(choiceQuizWord("kot", nil))
+	quiz := NewChoiceQuiz(store, core.AnyWordSpec{}, rand.New(rand.NewSource(0)))
+	_, err := quiz.NewQuestion("", 4)
+	assert.ErrorIs(t, err, core.ErrNotFound)
+	_, err = quiz.NewQuestion("en", 4)
+	assert.ErrorIs(t, err, core.ErrNotFound)
+}
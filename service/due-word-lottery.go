@@ -0,0 +1,27 @@
+package service
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"time"
+)
+
+// A word lottery that, instead of drawing uniformly at random, draws the
+// word whose review is the most overdue according to the user's scheduler,
+// so that words are shown when their predicted retention has dropped to
+// the desired level.
+type DueWordLottery struct {
+	reviewQueue core.ReviewQueue
+	now         time.Time
+}
+
+func NewDueWordLottery(reviewQueue core.ReviewQueue, now time.Time) *DueWordLottery {
+	return &DueWordLottery{
+		reviewQueue: reviewQueue,
+		now:         now,
+	}
+}
+
+func (lot *DueWordLottery) DrawWord() (*entity.Word, error) {
+	return lot.reviewQueue.NextWord(lot.now)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"math"
+)
+
+// Fits FSRS weights to a user's review history by minimizing the log loss
+// of the predicted probability of recall at each review, using Adam with
+// numerically estimated gradients.
+type FSRSOptimizer struct {
+	Epochs       int
+	LearningRate float64
+}
+
+func NewFSRSOptimizer() *FSRSOptimizer {
+	return &FSRSOptimizer{
+		Epochs:       100,
+		LearningRate: 0.05,
+	}
+}
+
+const fsrsMinimumTrainingItems = 16
+
+var ErrNotEnoughReviews = errors.New("Not enough reviews to optimize scheduling parameters")
+
+var fsrsWeightBounds = [][2]float64{
+	{0.01, 100}, {0.01, 100}, {0.01, 100}, {0.01, 100},
+	{1, 10}, {0.1, 5}, {0.1, 5}, {0, 0.75},
+	{0, 4}, {0, 0.8}, {0.01, 3}, {0.5, 5},
+	{0.01, 0.2}, {0.01, 0.9}, {0.01, 2}, {0, 1},
+	{1, 6},
+}
+
+// Reviews are expected ordered by word and then by time, as returned by
+// ReviewStore.ListByUser. Returns the fitted weights and their loss.
+func (optimizer *FSRSOptimizer) Optimize(reviews []*entity.Review, initialWeights []float64) ([]float64, float64, error) {
+	if initialWeights == nil {
+		initialWeights = FSRSDefaultWeights
+	}
+	histories := fsrsSplitHistories(reviews)
+	itemCount := 0
+	for _, history := range histories {
+		itemCount += len(history) - 1
+	}
+	if itemCount < fsrsMinimumTrainingItems {
+		return nil, 0, ErrNotEnoughReviews
+	}
+
+	weights := make([]float64, len(initialWeights))
+	copy(weights, initialWeights)
+	m := make([]float64, len(weights))
+	v := make([]float64, len(weights))
+	gradient := make([]float64, len(weights))
+	const (
+		beta1   = 0.9
+		beta2   = 0.999
+		epsilon = 1e-8
+		h       = 1e-4
+	)
+
+	for epoch := 1; epoch <= optimizer.Epochs; epoch++ {
+		for i := range weights {
+			original := weights[i]
+			weights[i] = original + h
+			lossUp := fsrsLoss(weights, histories)
+			weights[i] = original - h
+			lossDown := fsrsLoss(weights, histories)
+			weights[i] = original
+			gradient[i] = (lossUp - lossDown) / (2 * h)
+		}
+		for i := range weights {
+			m[i] = beta1*m[i] + (1-beta1)*gradient[i]
+			v[i] = beta2*v[i] + (1-beta2)*gradient[i]*gradient[i]
+			mHat := m[i] / (1 - math.Pow(beta1, float64(epoch)))
+			vHat := v[i] / (1 - math.Pow(beta2, float64(epoch)))
+			weights[i] -= optimizer.LearningRate * mHat / (math.Sqrt(vHat) + epsilon)
+			weights[i] = math.Min(math.Max(weights[i], fsrsWeightBounds[i][0]), fsrsWeightBounds[i][1])
+		}
+	}
+
+	return weights, fsrsLoss(weights, histories), nil
+}
+
+func fsrsSplitHistories(reviews []*entity.Review) [][]*entity.Review {
+	histories := [][]*entity.Review{}
+	var history []*entity.Review
+	for _, review := range reviews {
+		if len(history) != 0 && history[0].WordID != review.WordID {
+			histories = append(histories, history)
+			history = nil
+		}
+		history = append(history, review)
+	}
+	if len(history) != 0 {
+		histories = append(histories, history)
+	}
+	return histories
+}
+
+// The mean binary cross-entropy between predicted retrievability and
+// whether the word was recalled (graded anything but again).
+func fsrsLoss(w []float64, histories [][]*entity.Review) float64 {
+	const epsilon = 1e-6
+	total := 0.0
+	count := 0
+	for _, history := range histories {
+		stability := fsrsInitialStability(w, history[0].Grade)
+		difficulty := fsrsInitialDifficulty(w, history[0].Grade)
+		for i := 1; i < len(history); i++ {
+			elapsedDays := math.Max(0, history[i].ReviewedAt.Sub(history[i-1].ReviewedAt).Hours()/24)
+			r := fsrsRetrievability(elapsedDays, stability)
+			r = math.Min(math.Max(r, epsilon), 1-epsilon)
+			if history[i].Grade == entity.GradeAgain {
+				total -= math.Log(1 - r)
+			} else {
+				total -= math.Log(r)
+			}
+			count++
+			stability, difficulty = fsrsNextState(w, stability, difficulty, elapsedDays, history[i].Grade)
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
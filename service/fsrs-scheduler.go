@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"math"
+	"time"
+)
+
+// Implements version 4.5 of the Free Spaced Repetition Scheduler memory
+// model, where each word has a stability, the number of days until the
+// probability of recall falls to 90%, and a difficulty between 1 and 10.
+type FSRSScheduler struct {
+	weights          []float64
+	desiredRetention float64
+}
+
+const (
+	fsrsDecay                   = -0.5
+	fsrsFactor                  = 19.0 / 81.0
+	fsrsDefaultDesiredRetention = 0.9
+	fsrsMinimumStability        = 0.01
+	fsrsMaximumInterval         = 36500
+)
+
+var FSRSDefaultWeights = []float64{
+	0.4872, 1.4003, 3.7145, 13.8206,
+	5.1618, 1.2298, 0.8975, 0.031,
+	1.6474, 0.1367, 1.0461, 2.1072,
+	0.0793, 0.3246, 1.587, 0.2272,
+	2.8755,
+}
+
+func NewFSRSScheduler(weights []float64, desiredRetention float64) (*FSRSScheduler, error) {
+	if weights == nil {
+		weights = FSRSDefaultWeights
+	}
+	if len(weights) != len(FSRSDefaultWeights) {
+		return nil, fmt.Errorf("FSRS needs %d weights, got %d", len(FSRSDefaultWeights), len(weights))
+	}
+	if desiredRetention == 0 {
+		desiredRetention = fsrsDefaultDesiredRetention
+	}
+	if desiredRetention <= 0 || desiredRetention >= 1 {
+		return nil, fmt.Errorf("Desired retention must be between 0 and 1, got %g", desiredRetention)
+	}
+	return &FSRSScheduler{
+		weights:          weights,
+		desiredRetention: desiredRetention,
+	}, nil
+}
+
+func ParseFSRSWeights(weightsJSON string) ([]float64, error) {
+	if weightsJSON == "" {
+		return nil, nil
+	}
+	var weights []float64
+	err := json.Unmarshal([]byte(weightsJSON), &weights)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse FSRS weights: %w", err)
+	}
+	return weights, nil
+}
+
+func (scheduler *FSRSScheduler) Schedule(previous *entity.Review, review *entity.Review) {
+	if previous == nil || previous.Stability == 0 {
+		// Either a new word, or one that has only been scheduled by SM-2
+		review.Stability = fsrsInitialStability(scheduler.weights, review.Grade)
+		review.Difficulty = fsrsInitialDifficulty(scheduler.weights, review.Grade)
+	} else {
+		elapsedDays := review.ReviewedAt.Sub(previous.ReviewedAt).Hours() / 24
+		if elapsedDays < 0 {
+			elapsedDays = 0
+		}
+		review.Stability, review.Difficulty = fsrsNextState(scheduler.weights, previous.Stability, previous.Difficulty, elapsedDays, review.Grade)
+	}
+
+	if review.Grade == entity.GradeAgain {
+		review.Repetitions = 0
+	} else if previous != nil {
+		review.Repetitions = previous.Repetitions + 1
+	} else {
+		review.Repetitions = 1
+	}
+	if previous != nil {
+		review.EaseFactor = previous.EaseFactor
+	} else {
+		review.EaseFactor = sm2InitialEaseFactor
+	}
+
+	if review.Grade == entity.GradeAgain {
+		review.Interval = 0
+		review.DueAt = review.ReviewedAt.Add(sm2AgainDelay)
+		return
+	}
+	review.Interval = fsrsInterval(review.Stability, scheduler.desiredRetention)
+	review.DueAt = review.ReviewedAt.Add(time.Duration(review.Interval * float64(day)))
+}
+
+func fsrsRetrievability(elapsedDays, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsedDays/stability, fsrsDecay)
+}
+
+func fsrsInterval(stability, desiredRetention float64) float64 {
+	interval := math.Round(stability / fsrsFactor * (math.Pow(desiredRetention, 1/fsrsDecay) - 1))
+	return math.Max(1, math.Min(interval, fsrsMaximumInterval))
+}
+
+func fsrsInitialStability(w []float64, grade entity.Grade) float64 {
+	return math.Max(w[grade-1], fsrsMinimumStability)
+}
+
+func fsrsInitialDifficulty(w []float64, grade entity.Grade) float64 {
+	return fsrsClampDifficulty(w[4] - float64(grade-3)*w[5])
+}
+
+func fsrsClampDifficulty(difficulty float64) float64 {
+	return math.Min(math.Max(difficulty, 1), 10)
+}
+
+func fsrsNextState(w []float64, stability, difficulty, elapsedDays float64, grade entity.Grade) (float64, float64) {
+	r := fsrsRetrievability(elapsedDays, stability)
+
+	nextDifficulty := difficulty - w[6]*float64(grade-3)
+	// Mean reversion towards the initial difficulty of a word graded good
+	nextDifficulty = fsrsClampDifficulty(w[7]*w[4] + (1-w[7])*nextDifficulty)
+
+	var nextStability float64
+	if grade == entity.GradeAgain {
+		nextStability = w[11] * math.Pow(difficulty, -w[12]) * (math.Pow(stability+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+		nextStability = math.Min(nextStability, stability)
+	} else {
+		hardPenalty := 1.0
+		if grade == entity.GradeHard {
+			hardPenalty = w[15]
+		}
+		easyBonus := 1.0
+		if grade == entity.GradeEasy {
+			easyBonus = w[16]
+		}
+		nextStability = stability * (math.Exp(w[8])*(11-difficulty)*math.Pow(stability, -w[9])*(math.Exp(w[10]*(1-r))-1)*hardPenalty*easyBonus + 1)
+	}
+	return math.Max(nextStability, fsrsMinimumStability), nextDifficulty
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestFSRSSchedulerFirstReview(t *testing.T) {
+	scheduler, err := NewFSRSScheduler(nil, 0.9)
+	if err != nil {
+		panic(err)
+	}
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	review := &entity.Review{
+		Grade:      entity.GradeGood,
+		ReviewedAt: now,
+	}
+	scheduler.Schedule(nil, review)
+	assert.Equal(t, FSRSDefaultWeights[2], review.Stability)
+	assert.Equal(t, FSRSDefaultWeights[4], review.Difficulty)
+	// With a desired retention of 90% the interval is the stability
+	assert.Equal(t, 4.0, review.Interval)
+	assert.Equal(t, now.Add(4*day), review.DueAt)
+}
+
+func TestFSRSSchedulerStability(t *testing.T) {
+	scheduler, err := NewFSRSScheduler(nil, 0.9)
+	if err != nil {
+		panic(err)
+	}
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	first := &entity.Review{
+		Grade:      entity.GradeGood,
+		ReviewedAt: now,
+	}
+	scheduler.Schedule(nil, first)
+
+	good := &entity.Review{
+		Grade:      entity.GradeGood,
+		ReviewedAt: first.DueAt,
+	}
+	scheduler.Schedule(first, good)
+	assert.Greater(t, good.Stability, first.Stability)
+	assert.Greater(t, good.Interval, first.Interval)
+
+	again := &entity.Review{
+		Grade:      entity.GradeAgain,
+		ReviewedAt: first.DueAt,
+	}
+	scheduler.Schedule(first, again)
+	assert.Less(t, again.Stability, first.Stability)
+	assert.Greater(t, again.Difficulty, first.Difficulty)
+	assert.Equal(t, first.DueAt.Add(sm2AgainDelay), again.DueAt)
+}
+
+func TestFSRSSchedulerDesiredRetention(t *testing.T) {
+	strict, err := NewFSRSScheduler(nil, 0.95)
+	if err != nil {
+		panic(err)
+	}
+	lenient, err := NewFSRSScheduler(nil, 0.8)
+	if err != nil {
+		panic(err)
+	}
+	previous := &entity.Review{
+		Grade:      entity.GradeGood,
+		Stability:  20,
+		Difficulty: 5,
+	}
+	strictReview := &entity.Review{Grade: entity.GradeGood, ReviewedAt: previous.ReviewedAt.Add(20 * day)}
+	strict.Schedule(previous, strictReview)
+	lenientReview := &entity.Review{Grade: entity.GradeGood, ReviewedAt: previous.ReviewedAt.Add(20 * day)}
+	lenient.Schedule(previous, lenientReview)
+	assert.Less(t, strictReview.Interval, lenientReview.Interval)
+
+	_, err = NewFSRSScheduler(nil, 1.5)
+	assert.Error(t, err)
+	_, err = NewFSRSScheduler([]float64{1, 2, 3}, 0.9)
+	assert.Error(t, err)
+}
+
+func TestFSRSOptimizerReducesLoss(t *testing.T) {
+	// A learner who forgets much faster than the default weights predict
+	rng := rand.New(rand.NewSource(1))
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	reviews := []*entity.Review{}
+	for i := 0; i < 40; i++ {
+		wordID := entity.WordID(entity.NewID())
+		reviewedAt := start
+		stability := 1.0
+		for j := 0; j < 5; j++ {
+			grade := entity.GradeGood
+			if j != 0 {
+				elapsed := float64(1 + rng.Intn(10))
+				reviewedAt = reviewedAt.Add(time.Duration(elapsed * float64(day)))
+				if rng.Float64() > fsrsRetrievability(elapsed, stability) {
+					grade = entity.GradeAgain
+				} else {
+					stability *= 1.5
+				}
+			}
+			reviews = append(reviews, &entity.Review{
+				WordID:     wordID,
+				Grade:      grade,
+				ReviewedAt: reviewedAt,
+			})
+		}
+	}
+
+	optimizer := NewFSRSOptimizer()
+	optimizer.Epochs = 30
+	initialLoss := fsrsLoss(FSRSDefaultWeights, fsrsSplitHistories(reviews))
+	weights, loss, err := optimizer.Optimize(reviews, nil)
+	if err != nil {
+		t.Fatalf("Optimization failed: %s", err)
+	}
+	assert.Equal(t, len(FSRSDefaultWeights), len(weights))
+	assert.Less(t, loss, initialLoss)
+
+	_, _, err = optimizer.Optimize(reviews[:5], nil)
+	assert.Equal(t, ErrNotEnoughReviews, err)
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/imaging"
+	goimage "image"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// The types that can be decoded
+var imageMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type ImageService struct {
+	imageStore core.ImageStore
+	wordStore  core.WordStore
+	blobStore  core.BlobStore
+	maxSize    int64
+}
+
+func NewImageService(imageStore core.ImageStore, wordStore core.WordStore, blobStore core.BlobStore, maxSize int64) *ImageService {
+	return &ImageService{
+		imageStore: imageStore,
+		wordStore:  wordStore,
+		blobStore:  blobStore,
+		maxSize:    maxSize,
+	}
+}
+
+// The widths images are scaled down to. The image itself is at most as
+// wide as the last of them.
+var ImageWidths = []int{320, 640, 1280, 2048}
+
+// Stores the content as a new image with the license and attribution given
+// in image, and attaches it to the word in place of any earlier image. The
+// content is decoded and re-encoded at each of ImageWidths narrower than
+// itself, which also leaves out any metadata.
+//
+// Returns the keys of blobs that are no longer used by any image, which
+// should be deleted from the blob store once the transaction is committed.
+func (service *ImageService) Attach(word *entity.Word, image *entity.Image, content io.Reader) ([]string, error) {
+	if image.AttributionUrl != "" {
+		u, err := url.Parse(image.AttributionUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%w: the attribution URL needs to be an http or https URL", core.ErrInvalid)
+		}
+	}
+
+	data, err := ioutil.ReadAll(&sizeLimitedReader{
+		r:         content,
+		remaining: service.maxSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: the image is empty", core.ErrInvalid)
+	}
+	mimeType := http.DetectContentType(data)
+	if !imageMimeTypes[mimeType] {
+		return nil, fmt.Errorf("%w: unsupported image type '%s'", core.ErrInvalid, mimeType)
+	}
+	decoded, err := imaging.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode image: %s", core.ErrInvalid, err)
+	}
+
+	image.ID = entity.ImageID(entity.NewID())
+	full := imaging.Fit(decoded, ImageWidths[len(ImageWidths)-1])
+	image.Width = full.Bounds().Dx()
+	image.Height = full.Bounds().Dy()
+	image.MimeType, image.BlobKey, err = service.put(full)
+	if err != nil {
+		return nil, err
+	}
+	err = service.imageStore.Add(image)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, width := range ImageWidths {
+		if width >= image.Width {
+			break
+		}
+		scaled := imaging.Fit(full, width)
+		variant := &entity.ImageVariant{
+			ImageID: image.ID,
+			Width:   scaled.Bounds().Dx(),
+			Height:  scaled.Bounds().Dy(),
+		}
+		variant.MimeType, variant.BlobKey, err = service.put(scaled)
+		if err != nil {
+			return nil, err
+		}
+		err = service.imageStore.AddVariant(variant)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return service.replace(word, image.ID)
+}
+
+func (service *ImageService) put(img *goimage.NRGBA) (string, string, error) {
+	var buf bytes.Buffer
+	mimeType, err := imaging.Encode(&buf, img)
+	if err != nil {
+		return "", "", err
+	}
+	blobKey, err := service.blobStore.Put(&buf)
+	if err != nil {
+		return "", "", err
+	}
+	return mimeType, blobKey, nil
+}
+
+// Removes the image from the word. Returns the keys of blobs to delete, as
+// with Attach.
+func (service *ImageService) Detach(word *entity.Word) ([]string, error) {
+	return service.replace(word, entity.ImageID{})
+}
+
+func (service *ImageService) replace(word *entity.Word, imageID entity.ImageID) ([]string, error) {
+	previous := word.ImageID
+	word.ImageID = imageID
+	err := service.wordStore.Update(word)
+	if err != nil {
+		return nil, err
+	}
+	if !previous.Valid {
+		return nil, nil
+	}
+	return service.deleteIfUnused(previous)
+}
+
+func (service *ImageService) deleteIfUnused(id entity.ImageID) ([]string, error) {
+	count, err := service.imageStore.CountWords(id)
+	if err != nil || count != 0 {
+		return nil, err
+	}
+	image, err := service.imageStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := service.imageStore.ListVariants(id)
+	if err != nil {
+		return nil, err
+	}
+	err = service.imageStore.Delete(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blobs are shared between images with the same content
+	blobKeys := []string{image.BlobKey}
+	for _, variant := range variants {
+		blobKeys = append(blobKeys, variant.BlobKey)
+	}
+	unused := []string{}
+	for _, blobKey := range blobKeys {
+		count, err = service.imageStore.CountByBlobKey(blobKey)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			unused = append(unused, blobKey)
+		}
+	}
+	return unused, nil
+}
+
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, fmt.Errorf("%w: the image is too large", core.ErrInvalid)
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, fmt.Errorf("%w: the image is too large", core.ErrInvalid)
+	}
+	return n, err
+}
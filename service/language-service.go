@@ -1,7 +1,14 @@
 package service
 
 import (
+	"fmt"
 	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"strings"
+	"unicode/utf8"
 )
 
 type LanguageService struct {
@@ -25,3 +32,94 @@ func (service *LanguageService) GetNativeNameMap() (map[string]string, error) {
 	}
 	return m, nil
 }
+
+// Returns the canonical form of a BCP 47 language tag, such as pt-BR for
+// pt_br.
+func ParseLanguageCode(code string) (string, error) {
+	tag, err := language.Parse(strings.TrimSpace(code))
+	if err != nil || tag == language.Und {
+		return "", fmt.Errorf("%w: '%s' is not a BCP 47 language tag", core.ErrInvalid, code)
+	}
+	return tag.String(), nil
+}
+
+// Returns the name of the language in the language itself, as found in the
+// CLDR, or an empty string if it is not known.
+func SuggestNativeName(code string) string {
+	tag, err := language.Parse(code)
+	if err != nil {
+		return ""
+	}
+	name := display.Self.Name(tag)
+	if name == "" {
+		return ""
+	}
+	// CLDR names are lower case in languages that do not capitalize them
+	// in running text, but they are listed like titles here
+	first, size := utf8.DecodeRuneInString(name)
+	return cases.Upper(tag).String(string(first)) + name[size:]
+}
+
+// Suggests the native name if none is given.
+func (service *LanguageService) Add(code, nativeName string) (*entity.Language, error) {
+	code, err := ParseLanguageCode(code)
+	if err != nil {
+		return nil, err
+	}
+	nativeName = strings.TrimSpace(nativeName)
+	if nativeName == "" {
+		nativeName = SuggestNativeName(code)
+	}
+	if nativeName == "" {
+		return nil, fmt.Errorf("%w: no native name is known for '%s', so one needs to be given", core.ErrInvalid, code)
+	}
+	_, err = service.languageStore.Get(code)
+	if err == nil {
+		return nil, fmt.Errorf("%w: language '%s'", core.ErrAlreadyExists, code)
+	} else if err != core.ErrNotFound {
+		return nil, err
+	}
+	language := &entity.Language{
+		Code:       code,
+		NativeName: nativeName,
+	}
+	err = service.languageStore.Update(language)
+	if err != nil {
+		return nil, err
+	}
+	return language, nil
+}
+
+func (service *LanguageService) Rename(code, nativeName string) (*entity.Language, error) {
+	language, err := service.languageStore.Get(code)
+	if err != nil {
+		return nil, err
+	}
+	nativeName = strings.TrimSpace(nativeName)
+	if nativeName == "" {
+		return nil, fmt.Errorf("%w: the native name is empty", core.ErrInvalid)
+	}
+	language.NativeName = nativeName
+	err = service.languageStore.Update(language)
+	if err != nil {
+		return nil, err
+	}
+	return language, nil
+}
+
+// Returns an error wrapping core.ErrInUse if any words are in the language
+// or translated to it.
+func (service *LanguageService) Delete(code string) error {
+	_, err := service.languageStore.Get(code)
+	if err != nil {
+		return err
+	}
+	wordCount, translationCount, err := service.languageStore.CountUsage(code)
+	if err != nil {
+		return err
+	}
+	if wordCount != 0 || translationCount != 0 {
+		return fmt.Errorf("%w: the language '%s' is used by %d words and %d translations", core.ErrInUse, code, wordCount, translationCount)
+	}
+	return service.languageStore.Delete(code)
+}
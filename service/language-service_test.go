@@ -0,0 +1,33 @@
+package service
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseLanguageCode(t *testing.T) {
+	for input, expected := range map[string]string{
+		"pl":      "pl",
+		"pt_br":   "pt-BR",
+		"zh-hant": "zh-Hant",
+		" nb ":    "nb",
+	} {
+		code, err := ParseLanguageCode(input)
+		if err != nil {
+			t.Fatalf("Failed to parse '%s': %s", input, err)
+		}
+		assert.Equal(t, expected, code)
+	}
+
+	for _, input := range []string{"", "und", "not a tag", "x"} {
+		_, err := ParseLanguageCode(input)
+		assert.ErrorIs(t, err, core.ErrInvalid, input)
+	}
+}
+
+func TestSuggestNativeName(t *testing.T) {
+	assert.Equal(t, "Polski", SuggestNativeName("pl"))
+	assert.Equal(t, "Norsk bokmål", SuggestNativeName("nb"))
+	assert.Equal(t, "English", SuggestNativeName("en"))
+}
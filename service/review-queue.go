@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"time"
+)
+
+type ReviewQueue struct {
+	reviewStore core.ReviewStore
+	scheduler   core.Scheduler
+	userID      entity.UserID
+	spec        core.WordSpec
+}
+
+func NewReviewQueue(reviewStore core.ReviewStore, scheduler core.Scheduler, userID entity.UserID, spec core.WordSpec) *ReviewQueue {
+	return &ReviewQueue{
+		reviewStore: reviewStore,
+		scheduler:   scheduler,
+		userID:      userID,
+		spec:        spec,
+	}
+}
+
+func (queue *ReviewQueue) NextWord(now time.Time) (*entity.Word, error) {
+	query := core.WordQuery{
+		Spec: queue.spec,
+	}
+	query.SetRange(0, 1)
+	words, err := queue.reviewStore.ListDue(queue.userID, &query, now)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the next due word: %w", err)
+	}
+	if len(words) == 0 {
+		return nil, core.ErrNotFound
+	}
+	return words[0], nil
+}
+
+func (queue *ReviewQueue) Grade(wordID entity.WordID, grade entity.Grade, now time.Time) (*entity.Review, error) {
+	if !grade.Valid() {
+		return nil, fmt.Errorf("Invalid grade %d", grade)
+	}
+	previous, err := queue.reviewStore.GetLatest(queue.userID, wordID)
+	if err == core.ErrNotFound {
+		previous = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error getting the previous review: %w", err)
+	}
+	review := &entity.Review{
+		ID:         entity.ReviewID(entity.NewID()),
+		UserID:     queue.userID,
+		WordID:     wordID,
+		Grade:      grade,
+		ReviewedAt: now,
+	}
+	queue.scheduler.Schedule(previous, review)
+	err = queue.reviewStore.Add(review)
+	if err != nil {
+		return nil, fmt.Errorf("Error saving review: %w", err)
+	}
+	return review, nil
+}
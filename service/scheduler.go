@@ -0,0 +1,37 @@
+package service
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+)
+
+func NewScheduler(settings *entity.SchedulerSettings) (core.Scheduler, error) {
+	if settings == nil {
+		return NewSM2Scheduler(), nil
+	}
+	switch settings.Algorithm {
+	case entity.SchedulerAlgorithmSM2:
+		return NewSM2Scheduler(), nil
+	case entity.SchedulerAlgorithmFSRS:
+		weights, err := ParseFSRSWeights(settings.Weights)
+		if err != nil {
+			return nil, err
+		}
+		return NewFSRSScheduler(weights, settings.DesiredRetention)
+	default:
+		return nil, fmt.Errorf("Unrecognized scheduling algorithm '%s'", settings.Algorithm)
+	}
+}
+
+// Returns the scheduler chosen by the user, which is SM-2 unless the user
+// has chosen otherwise.
+func GetUserScheduler(settingsStore core.SchedulerSettingsStore, userID entity.UserID) (core.Scheduler, error) {
+	settings, err := settingsStore.Get(userID)
+	if err == core.ErrNotFound {
+		settings = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error getting scheduler settings: %w", err)
+	}
+	return NewScheduler(settings)
+}
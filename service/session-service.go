@@ -0,0 +1,78 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"time"
+)
+
+const SessionLifetime = 30 * 24 * time.Hour
+
+type SessionService struct {
+	sessionStore core.SessionStore
+	userStore    core.UserStore
+}
+
+func NewSessionService(sessionStore core.SessionStore, userStore core.UserStore) *SessionService {
+	return &SessionService{
+		sessionStore: sessionStore,
+		userStore:    userStore,
+	}
+}
+
+// Returns the token to give to the client, of which only a hash is stored.
+func (service *SessionService) Start(userID entity.UserID, now time.Time) (string, *entity.Session, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+	session := &entity.Session{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(SessionLifetime),
+	}
+	err = service.sessionStore.DeleteExpired(now)
+	if err != nil {
+		return "", nil, err
+	}
+	err = service.sessionStore.Add(session)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, session, nil
+}
+
+// Returns core.ErrNotFound if the token does not belong to a current session.
+func (service *SessionService) Resolve(token string, now time.Time) (*entity.User, error) {
+	session, err := service.sessionStore.Get(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(session.ExpiresAt) {
+		return nil, core.ErrNotFound
+	}
+	return service.userStore.Get(session.UserID)
+}
+
+func (service *SessionService) End(token string) error {
+	return service.sessionStore.Delete(hashToken(token))
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"math"
+	"time"
+)
+
+const (
+	sm2InitialEaseFactor = 2.5
+	sm2MinimumEaseFactor = 1.3
+	sm2AgainDelay        = 10 * time.Minute
+	day                  = 24 * time.Hour
+)
+
+// Implements the SuperMemo 2 algorithm, with the four grades mapped onto
+// the quality scale from 0 to 5.
+type SM2Scheduler struct{}
+
+func NewSM2Scheduler() *SM2Scheduler {
+	return &SM2Scheduler{}
+}
+
+func sm2Quality(grade entity.Grade) float64 {
+	switch grade {
+	case entity.GradeAgain:
+		return 1
+	case entity.GradeHard:
+		return 3
+	case entity.GradeGood:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func (scheduler *SM2Scheduler) Schedule(previous *entity.Review, review *entity.Review) {
+	easeFactor := sm2InitialEaseFactor
+	repetitions := 0
+	interval := 0.0
+	if previous != nil {
+		easeFactor = previous.EaseFactor
+		repetitions = previous.Repetitions
+		interval = previous.Interval
+	}
+
+	q := sm2Quality(review.Grade)
+	easeFactor += 0.1 - (5-q)*(0.08+(5-q)*0.02)
+	if easeFactor < sm2MinimumEaseFactor {
+		easeFactor = sm2MinimumEaseFactor
+	}
+
+	if q < 3 {
+		review.Repetitions = 0
+		review.Interval = 0
+		review.DueAt = review.ReviewedAt.Add(sm2AgainDelay)
+	} else {
+		switch repetitions {
+		case 0:
+			interval = 1
+		case 1:
+			interval = 6
+		default:
+			interval = math.Round(interval * easeFactor)
+		}
+		review.Repetitions = repetitions + 1
+		review.Interval = interval
+		review.DueAt = review.ReviewedAt.Add(time.Duration(interval * float64(day)))
+	}
+	review.EaseFactor = easeFactor
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSM2SchedulerIntervals(t *testing.T) {
+	scheduler := NewSM2Scheduler()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var previous *entity.Review
+	expectedIntervals := []float64{1, 6, 15, 38}
+	for _, expectedInterval := range expectedIntervals {
+		review := &entity.Review{
+			Grade:      entity.GradeGood,
+			ReviewedAt: now,
+		}
+		scheduler.Schedule(previous, review)
+		assert.Equal(t, expectedInterval, review.Interval)
+		assert.Equal(t, now.Add(time.Duration(expectedInterval)*day), review.DueAt)
+		previous = review
+		now = review.DueAt
+	}
+	assert.Equal(t, 2.5, previous.EaseFactor)
+	assert.Equal(t, 4, previous.Repetitions)
+}
+
+func TestSM2SchedulerAgain(t *testing.T) {
+	scheduler := NewSM2Scheduler()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	previous := &entity.Review{
+		Grade:       entity.GradeGood,
+		Interval:    16,
+		EaseFactor:  2.5,
+		Repetitions: 3,
+	}
+	review := &entity.Review{
+		Grade:      entity.GradeAgain,
+		ReviewedAt: now,
+	}
+	scheduler.Schedule(previous, review)
+	assert.Equal(t, 0, review.Repetitions)
+	assert.Equal(t, now.Add(sm2AgainDelay), review.DueAt)
+	assert.InDelta(t, 1.96, review.EaseFactor, 1e-9)
+}
+
+func TestSM2SchedulerMinimumEaseFactor(t *testing.T) {
+	scheduler := NewSM2Scheduler()
+	previous := &entity.Review{
+		EaseFactor: 1.35,
+	}
+	review := &entity.Review{
+		Grade: entity.GradeHard,
+	}
+	scheduler.Schedule(previous, review)
+	assert.Equal(t, sm2MinimumEaseFactor, review.EaseFactor)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"time"
+)
+
+// The most words a study session can be started with
+const StudySessionMaxSize = 200
+
+type StudySummary struct {
+	Known  int
+	Missed int
+	// Words that were missed, in the order they were shown
+	MissedWords []*entity.Word
+}
+
+// Runs study sessions, in which a sample of the words matching a query is
+// drawn up front and each shown once, unlike with a word lottery, where the
+// same word can come up again right away.
+type StudySessionService struct {
+	studyStore core.StudySessionStore
+	wordStore  core.WordStore
+	rng        core.Rand
+}
+
+func NewStudySessionService(studyStore core.StudySessionStore, wordStore core.WordStore, rng core.Rand) *StudySessionService {
+	return &StudySessionService{
+		studyStore: studyStore,
+		wordStore:  wordStore,
+		rng:        rng,
+	}
+}
+
+// Start starts a session for the user with up to size words matching spec,
+// in random order.
+func (service *StudySessionService) Start(userID entity.UserID, query string, spec core.WordSpec, direction core.CardDirection, size int, now time.Time) (*entity.StudySession, error) {
+	if size < 1 || size > StudySessionMaxSize {
+		return nil, fmt.Errorf("%w: Session size must be between 1 and %d", core.ErrInvalid, StudySessionMaxSize)
+	}
+	// The IDs of the matching words are listed at once, as drawing each
+	// word by its own query would take as many queries as there are words
+	// in the session
+	matching, err := service.wordStore.ListIDs(&core.WordQuery{Spec: spec})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing matching words: %w", err)
+	}
+	if len(matching) == 0 {
+		return nil, core.ErrNotFound
+	}
+	if size > len(matching) {
+		size = len(matching)
+	}
+	wordIDs := make([]entity.WordID, 0, size)
+	for _, offset := range sampleOffsets(len(matching), size, service.rng) {
+		wordIDs = append(wordIDs, matching[offset])
+	}
+	session := &entity.StudySession{
+		ID:        entity.StudySessionID(entity.NewID()),
+		UserID:    userID,
+		Query:     query,
+		Direction: string(direction),
+		Size:      len(wordIDs),
+		CreatedAt: now,
+	}
+	err = service.studyStore.Add(session, wordIDs)
+	if err != nil {
+		return nil, fmt.Errorf("Error adding study session: %w", err)
+	}
+	return session, nil
+}
+
+// NextWord returns the word to show next and its position in the session,
+// moving the session past words deleted since it was started. It returns
+// core.ErrNotFound when the session is finished.
+func (service *StudySessionService) NextWord(session *entity.StudySession) (*entity.Word, int, error) {
+	if session.Finished() {
+		return nil, 0, core.ErrNotFound
+	}
+	sessionWords, err := service.studyStore.ListWords(session.ID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error listing the words of the study session: %w", err)
+	}
+	for _, sessionWord := range sessionWords {
+		if sessionWord.Position < session.Position {
+			continue
+		}
+		word, err := service.wordStore.Get(sessionWord.WordID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error getting word of the study session: %w", err)
+		}
+		if sessionWord.Position != session.Position {
+			session.Position = sessionWord.Position
+			err = service.studyStore.Update(session)
+			if err != nil {
+				return nil, 0, fmt.Errorf("Error updating study session: %w", err)
+			}
+		}
+		return word, sessionWord.Position, nil
+	}
+	session.Position = session.Size
+	err = service.studyStore.Update(session)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error updating study session: %w", err)
+	}
+	return nil, 0, core.ErrNotFound
+}
+
+// Answer records the result for the word at the position and moves on to
+// the next one. Answers for any other word than the one to be shown next,
+// as when a form is sent twice, are refused with core.ErrInvalid.
+func (service *StudySessionService) Answer(session *entity.StudySession, position int, result entity.StudyResult) error {
+	if !result.Valid() {
+		return fmt.Errorf("%w: Unrecognized study result '%s'", core.ErrInvalid, result)
+	}
+	if session.Finished() || position != session.Position {
+		return fmt.Errorf("%w: The word at position %d is not the next one in the session", core.ErrInvalid, position)
+	}
+	err := service.studyStore.SetResult(session.ID, position, result)
+	if err != nil {
+		return fmt.Errorf("Error recording study result: %w", err)
+	}
+	session.Position = position + 1
+	err = service.studyStore.Update(session)
+	if err != nil {
+		return fmt.Errorf("Error updating study session: %w", err)
+	}
+	return nil
+}
+
+func (service *StudySessionService) Summarize(session *entity.StudySession) (*StudySummary, error) {
+	sessionWords, err := service.studyStore.ListWords(session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the words of the study session: %w", err)
+	}
+	summary := &StudySummary{
+		MissedWords: []*entity.Word{},
+	}
+	for _, sessionWord := range sessionWords {
+		switch sessionWord.Result {
+		case entity.StudyResultKnown:
+			summary.Known++
+		case entity.StudyResultMissed:
+			summary.Missed++
+			word, err := service.wordStore.Get(sessionWord.WordID)
+			if err != nil {
+				return nil, fmt.Errorf("Error getting word of the study session: %w", err)
+			}
+			summary.MissedWords = append(summary.MissedWords, word)
+		}
+	}
+	return summary, nil
+}
+
+// sampleOffsets returns k distinct offsets below n in random order, by a
+// Fisher-Yates shuffle of which only the first k steps are taken and only
+// the swapped elements are stored.
+func sampleOffsets(n, k int, rng core.Rand) []int {
+	swapped := map[int]int{}
+	at := func(i int) int {
+		if offset, ok := swapped[i]; ok {
+			return offset
+		}
+		return i
+	}
+	sample := make([]int, k)
+	for i := 0; i < k; i++ {
+		j := i + rng.Int()%(n-i)
+		sample[i] = at(j)
+		swapped[j] = at(i)
+	}
+	return sample
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+type memoryStudySessionStore struct {
+	sessions map[entity.StudySessionID]*entity.StudySession
+	words    map[entity.StudySessionID][]*entity.StudySessionWord
+}
+
+func newMemoryStudySessionStore() *memoryStudySessionStore {
+	return &memoryStudySessionStore{
+		sessions: map[entity.StudySessionID]*entity.StudySession{},
+		words:    map[entity.StudySessionID][]*entity.StudySessionWord{},
+	}
+}
+
+func (store *memoryStudySessionStore) Add(session *entity.StudySession, wordIDs []entity.WordID) error {
+	stored := *session
+	store.sessions[session.ID] = &stored
+	for position, wordID := range wordIDs {
+		store.words[session.ID] = append(store.words[session.ID], &entity.StudySessionWord{
+			StudySessionID: session.ID,
+			Position:       position,
+			WordID:         wordID,
+		})
+	}
+	return nil
+}
+
+func (store *memoryStudySessionStore) Get(id entity.StudySessionID) (*entity.StudySession, error) {
+	session, ok := store.sessions[id]
+	if !ok {
+		return nil, core.ErrNotFound
+	}
+	stored := *session
+	return &stored, nil
+}
+
+func (store *memoryStudySessionStore) Update(session *entity.StudySession) error {
+	store.sessions[session.ID].Position = session.Position
+	return nil
+}
+
+func (store *memoryStudySessionStore) ListUnfinished(userID entity.UserID) ([]*entity.StudySession, error) {
+	return nil, nil
+}
+
+func (store *memoryStudySessionStore) ListWords(id entity.StudySessionID) ([]*entity.StudySessionWord, error) {
+	return store.words[id], nil
+}
+
+func (store *memoryStudySessionStore) SetResult(id entity.StudySessionID, position int, result entity.StudyResult) error {
+	for _, word := range store.words[id] {
+		if word.Position == position {
+			word.Result = result
+		}
+	}
+	return nil
+}
+
+func TestSampleOffsets(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	for _, n := range []int{1, 5, 20, 1000} {
+		for _, k := range []int{1, n / 2, n} {
+			if k == 0 {
+				continue
+			}
+			sample := sampleOffsets(n, k, rng)
+			assert.Len(t, sample, k)
+			seen := map[int]bool{}
+			for _, offset := range sample {
+				assert.True(t, offset >= 0 && offset < n)
+				assert.False(t, seen[offset], "Offset %d drawn twice", offset)
+				seen[offset] = true
+			}
+		}
+	}
+}
+
+func TestStudySession(t *testing.T) {
+	wordStore := &memoryWordStore{}
+	for _, word := range []string{"jabłko", "gruszka", "śliwka", "dom", "kot"} {
+		wordStore.Add(choiceQuizWord(word, []string{"a1"}, word))
+	}
+	studyStore := newMemoryStudySessionStore()
+	studySessions := NewStudySessionService(studyStore, wordStore, rand.New(rand.NewSource(1)))
+
+	_, err := studySessions.Start(entity.UserID(entity.NewID()), "#a1", core.TagWordSpec("a1"), "", 0, time.Now())
+	assert.ErrorIs(t, err, core.ErrInvalid)
+	_, err = studySessions.Start(entity.UserID(entity.NewID()), "#b1", core.TagWordSpec("b1"), "", 3, time.Now())
+	assert.ErrorIs(t, err, core.ErrNotFound)
+
+	// Asking for more words than match gives each of them once
+	session, err := studySessions.Start(entity.UserID(entity.NewID()), "#a1", core.TagWordSpec("a1"), "", 20, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to start a study session: %s", err)
+	}
+	assert.Equal(t, 5, session.Size)
+
+	shown := []string{}
+	for i := 0; ; i++ {
+		word, position, err := studySessions.NextWord(session)
+		if err == core.ErrNotFound {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to get the next word: %s", err)
+		}
+		assert.Equal(t, i, position)
+		shown = append(shown, word.Word)
+		result := entity.StudyResultKnown
+		if word.Word == "dom" || word.Word == "kot" {
+			result = entity.StudyResultMissed
+		}
+		err = studySessions.Answer(session, position, result)
+		assert.NoError(t, err)
+		// Sending the same answer twice is refused
+		err = studySessions.Answer(session, position, result)
+		assert.ErrorIs(t, err, core.ErrInvalid)
+	}
+	assert.True(t, session.Finished())
+	sort.Strings(shown)
+	assert.Equal(t, []string{"dom", "gruszka", "jabłko", "kot", "śliwka"}, shown)
+
+	summary, err := studySessions.Summarize(session)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, summary.Known)
+	assert.Equal(t, 2, summary.Missed)
+	assert.Len(t, summary.MissedWords, 2)
+}
+
+func TestStudySessionSkipsDeletedWords(t *testing.T) {
+	wordStore := &memoryWordStore{}
+	for _, word := range []string{"jabłko", "gruszka", "śliwka"} {
+		wordStore.Add(choiceQuizWord(word, nil, word))
+	}
+	studyStore := newMemoryStudySessionStore()
+	studySessions := NewStudySessionService(studyStore, wordStore, rand.New(rand.NewSource(1)))
+	session, err := studySessions.Start(entity.UserID(entity.NewID()), "", core.AnyWordSpec{}, "", 3, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to start a study session: %s", err)
+	}
+	// Deleting a word takes it out of the session, as the database does
+	studyStore.words[session.ID] = studyStore.words[session.ID][1:]
+
+	_, position, err := studySessions.NextWord(session)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, position)
+	assert.Equal(t, 1, session.Position)
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"sort"
+	"strings"
+)
+
+// A tag in the tree of hierarchical tags, such as fruit under food
+type TagNode struct {
+	// The last level of the tag, as fruit for food/fruit
+	Name string
+	Tag  string
+	// Words with the tag or a tag under it
+	WordCount int
+	Children  []*TagNode
+}
+
+// Lists tags and changes them across the collection. The changes return how
+// many words they changed, so that a caller can report it before committing.
+type TagService struct {
+	tagStore  core.TagStore
+	wordStore core.WordStore
+}
+
+func NewTagService(tagStore core.TagStore, wordStore core.WordStore) *TagService {
+	return &TagService{
+		tagStore:  tagStore,
+		wordStore: wordStore,
+	}
+}
+
+// Tree returns the top-level tags with the tags under them, each level
+// sorted by name.
+func (service *TagService) Tree() ([]*TagNode, error) {
+	tags, err := service.tagStore.ListNodes()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing tags: %w", err)
+	}
+	nodes := make(map[string]*TagNode, len(tags))
+	for _, tag := range tags {
+		nodes[tag.Tag] = &TagNode{
+			Name:      tag.Tag[strings.LastIndex(tag.Tag, core.TagSeparator)+1:],
+			Tag:       tag.Tag,
+			WordCount: tag.WordCount,
+			Children:  []*TagNode{},
+		}
+	}
+	roots := []*TagNode{}
+	for _, node := range nodes {
+		var parent *TagNode
+		if i := strings.LastIndex(node.Tag, core.TagSeparator); i != -1 {
+			parent = nodes[node.Tag[:i]]
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	sortTagNodes(roots)
+	return roots, nil
+}
+
+func sortTagNodes(nodes []*TagNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, node := range nodes {
+		sortTagNodes(node.Children)
+	}
+}
+
+// Rename renames the tag on every word having it, along with the tags under
+// it, so that renaming food to meal also renames food/fruit to meal/fruit.
+func (service *TagService) Rename(from, to string) (int, error) {
+	return service.Merge([]string{from}, to)
+}
+
+// Merge renames each of the tags to one tag, as Rename does. Words that had
+// several of them end up with the tag once.
+func (service *TagService) Merge(from []string, to string) (int, error) {
+	if len(from) == 0 {
+		return 0, fmt.Errorf("%w: no tags to merge", core.ErrInvalid)
+	}
+	err := ValidateTag(to)
+	if err != nil {
+		return 0, err
+	}
+	var spec core.WordSpec
+	for _, tag := range from {
+		err = ValidateTag(tag)
+		if err != nil {
+			return 0, err
+		}
+		if tag == to {
+			return 0, fmt.Errorf("%w: the tag '%s' would be renamed to itself", core.ErrInvalid, tag)
+		}
+		if spec == nil {
+			spec = core.TagWordSpec(tag)
+		} else {
+			spec = &core.OrWordSpec{Left: spec, Right: core.TagWordSpec(tag)}
+		}
+	}
+	return service.retag(spec, func(tags []string) []string {
+		renamed := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			for _, fromTag := range from {
+				if core.TagWordSpec(fromTag).MatchTag(tag) {
+					tag = to + tag[len(fromTag):]
+					break
+				}
+			}
+			renamed = append(renamed, tag)
+		}
+		return renamed
+	})
+}
+
+// Delete removes the tag and the tags under it from every word.
+func (service *TagService) Delete(tag string) (int, error) {
+	return service.RemoveFromMatching(core.AnyWordSpec{}, tag)
+}
+
+// AddToMatching adds the tag to every word matching spec that does not have
+// it.
+func (service *TagService) AddToMatching(spec core.WordSpec, tag string) (int, error) {
+	err := ValidateTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	return service.retag(spec, func(tags []string) []string {
+		return append(tags, tag)
+	})
+}
+
+// RemoveFromMatching removes the tag and the tags under it from every word
+// matching spec.
+func (service *TagService) RemoveFromMatching(spec core.WordSpec, tag string) (int, error) {
+	err := ValidateTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	return service.retag(&core.AndWordSpec{Left: spec, Right: core.TagWordSpec(tag)}, func(tags []string) []string {
+		kept := make([]string, 0, len(tags))
+		for _, t := range tags {
+			if !core.TagWordSpec(tag).MatchTag(t) {
+				kept = append(kept, t)
+			}
+		}
+		return kept
+	})
+}
+
+// retag updates the words matching spec whose tags the rewrite changes, and
+// returns how many there were.
+func (service *TagService) retag(spec core.WordSpec, rewrite func(tags []string) []string) (int, error) {
+	words, err := service.wordStore.List(&core.WordQuery{Spec: spec})
+	if err != nil {
+		return 0, fmt.Errorf("Error listing words: %w", err)
+	}
+	count := 0
+	for _, word := range words {
+		tags := uniqueTags(rewrite(append([]string{}, word.Tags...)))
+		if equalTags(tags, word.Tags) {
+			continue
+		}
+		word.Tags = tags
+		err = service.wordStore.Update(word)
+		if err != nil {
+			return 0, fmt.Errorf("Error updating the tags of '%s': %w", word.Word, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func uniqueTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	unique := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	return unique
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
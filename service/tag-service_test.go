@@ -0,0 +1,121 @@
+package service
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type memoryTagStore struct {
+	nodes []*entity.Tag
+}
+
+func (store *memoryTagStore) ListAll() ([]*entity.Tag, error) {
+	return nil, nil
+}
+
+func (store *memoryTagStore) ListNodes() ([]*entity.Tag, error) {
+	return store.nodes, nil
+}
+
+func TestTagServiceTree(t *testing.T) {
+	tagStore := &memoryTagStore{
+		nodes: []*entity.Tag{
+			{Tag: "mat", WordCount: 4},
+			{Tag: "mat/grønnsak/rot", WordCount: 1},
+			{Tag: "a1", WordCount: 2},
+			{Tag: "mat/grønnsak", WordCount: 2},
+			{Tag: "mat/frukt", WordCount: 2},
+		},
+	}
+	tree, err := NewTagService(tagStore, &memoryWordStore{}).Tree()
+	if err != nil {
+		t.Fatalf("Failed to get the tag tree: %s", err)
+	}
+	assert.Equal(t, []*TagNode{
+		{Name: "a1", Tag: "a1", WordCount: 2, Children: []*TagNode{}},
+		{Name: "mat", Tag: "mat", WordCount: 4, Children: []*TagNode{
+			{Name: "frukt", Tag: "mat/frukt", WordCount: 2, Children: []*TagNode{}},
+			{Name: "grønnsak", Tag: "mat/grønnsak", WordCount: 2, Children: []*TagNode{
+				{Name: "rot", Tag: "mat/grønnsak/rot", WordCount: 1, Children: []*TagNode{}},
+			}},
+		}},
+	}, tree)
+}
+
+func tagServiceWords() *memoryWordStore {
+	store := &memoryWordStore{}
+	store.Add(choiceQuizWord("jabłko", []string{"a1", "food/fruit"}, "apple"))
+	store.Add(choiceQuizWord("marchew", []string{"a1", "food/vegetables"}, "carrot"))
+	store.Add(choiceQuizWord("jedzenie", []string{"food", "jedzenie"}, "food"))
+	store.Add(choiceQuizWord("dom", []string{"b1"}, "house"))
+	return store
+}
+
+func wordTags(store *memoryWordStore) map[string][]string {
+	tags := map[string][]string{}
+	for _, word := range store.words {
+		tags[word.Word] = word.Tags
+	}
+	return tags
+}
+
+func TestTagServiceRename(t *testing.T) {
+	store := tagServiceWords()
+	count, err := NewTagService(&memoryTagStore{}, store).Rename("food", "meal")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, map[string][]string{
+		"jabłko":   {"a1", "meal/fruit"},
+		"marchew":  {"a1", "meal/vegetables"},
+		"jedzenie": {"meal", "jedzenie"},
+		"dom":      {"b1"},
+	}, wordTags(store))
+
+	_, err = NewTagService(&memoryTagStore{}, store).Rename("meal", "meal")
+	assert.ErrorIs(t, err, core.ErrInvalid)
+	_, err = NewTagService(&memoryTagStore{}, store).Rename("meal", "a*")
+	assert.ErrorIs(t, err, core.ErrInvalid)
+}
+
+func TestTagServiceMerge(t *testing.T) {
+	store := tagServiceWords()
+	count, err := NewTagService(&memoryTagStore{}, store).Merge([]string{"food", "jedzenie"}, "meal")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []string{"meal"}, wordTags(store)["jedzenie"])
+}
+
+func TestTagServiceDelete(t *testing.T) {
+	store := tagServiceWords()
+	count, err := NewTagService(&memoryTagStore{}, store).Delete("food")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, map[string][]string{
+		"jabłko":   {"a1"},
+		"marchew":  {"a1"},
+		"jedzenie": {"jedzenie"},
+		"dom":      {"b1"},
+	}, wordTags(store))
+}
+
+func TestTagServiceAddAndRemoveMatching(t *testing.T) {
+	store := tagServiceWords()
+	tagService := NewTagService(&memoryTagStore{}, store)
+	count, err := tagService.AddToMatching(core.TagWordSpec("a1"), "food")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"a1", "food/fruit", "food"}, wordTags(store)["jabłko"])
+
+	// Words that already have the tag are not counted
+	count, err = tagService.AddToMatching(core.TagWordSpec("food"), "food")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	count, err = tagService.RemoveFromMatching(core.TagWordSpec("a1"), "food/fruit")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"a1", "food"}, wordTags(store)["jabłko"])
+	assert.Equal(t, []string{"food", "jedzenie"}, wordTags(store)["jedzenie"])
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"time"
+)
+
+const (
+	EmailVerificationLifetime = 7 * 24 * time.Hour
+	PasswordResetLifetime     = time.Hour
+)
+
+// Issues and redeems the single-use tokens that are sent by e-mail to
+// verify addresses and reset passwords.
+type TokenService struct {
+	tokenStore core.TokenStore
+}
+
+func NewTokenService(tokenStore core.TokenStore) *TokenService {
+	return &TokenService{
+		tokenStore: tokenStore,
+	}
+}
+
+// Replaces any earlier token the user has for the same purpose, so that
+// only the most recently sent link works.
+func (service *TokenService) Issue(userID entity.UserID, purpose entity.TokenPurpose, email string, now time.Time) (string, error) {
+	lifetime := EmailVerificationLifetime
+	if purpose == entity.TokenPurposeResetPassword {
+		lifetime = PasswordResetLifetime
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	err = service.tokenStore.DeleteExpired(now)
+	if err != nil {
+		return "", err
+	}
+	err = service.tokenStore.DeleteByUser(userID, purpose)
+	if err != nil {
+		return "", err
+	}
+	err = service.tokenStore.Add(&entity.Token{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Deletes the token so that it cannot be used again. Returns
+// core.ErrNotFound if the token is unknown, expired or issued for another
+// purpose.
+func (service *TokenService) Redeem(token string, purpose entity.TokenPurpose, now time.Time) (*entity.Token, error) {
+	issued, err := service.tokenStore.Get(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if issued.Purpose != purpose || !now.Before(issued.ExpiresAt) {
+		return nil, core.ErrNotFound
+	}
+	err = service.tokenStore.Delete(issued.TokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
@@ -21,21 +21,11 @@ func NewWordLottery(wordStore core.WordStore, spec core.WordSpec, rng core.Rand)
 }
 
 func (lot *WordLottery) DrawWord() (*entity.Word, error) {
-	query := core.WordQuery{
-		Spec: lot.spec,
+	word, err := lot.wordStore.Sample(lot.spec, lot.rng.Int())
+	if err == core.ErrNotFound {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Error sampling a matching word: %w", err)
 	}
-	numberOfCards, err := lot.wordStore.Count(&query)
-	if err != nil {
-		return nil, fmt.Errorf("Error getting a count of matching words: %w", err)
-	}
-	if numberOfCards == 0 {
-		return nil, core.ErrNotFound
-	}
-	drawnCardNumber := lot.rng.Int() % numberOfCards
-	query.SetRange(drawnCardNumber, 1)
-	cards, err := lot.wordStore.List(&query)
-	if err != nil {
-		return nil, fmt.Errorf("Error getting a word at a random offset: %w", err)
-	}
-	return cards[0], nil
+	return word, nil
 }
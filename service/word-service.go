@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"strings"
+)
+
+type WordService struct {
+	wordStore     core.WordStore
+	languageStore core.LanguageStore
+}
+
+func NewWordService(wordStore core.WordStore, languageStore core.LanguageStore) *WordService {
+	return &WordService{
+		wordStore:     wordStore,
+		languageStore: languageStore,
+	}
+}
+
+func (service *WordService) Add(word *entity.Word) error {
+	err := service.Validate(word)
+	if err != nil {
+		return err
+	}
+	return service.wordStore.Add(word)
+}
+
+func (service *WordService) Update(word *entity.Word) error {
+	err := service.Validate(word)
+	if err != nil {
+		return err
+	}
+	return service.wordStore.Update(word)
+}
+
+// Returns an error wrapping core.ErrInvalid if the word cannot be stored.
+func (service *WordService) Validate(word *entity.Word) error {
+	if strings.TrimSpace(word.Word) == "" {
+		return fmt.Errorf("%w: the word is empty", core.ErrInvalid)
+	}
+	err := service.validateLanguage(word.LanguageCode)
+	if err != nil {
+		return err
+	}
+	for _, translation := range word.Translations {
+		err = service.validateLanguage(translation.LanguageCode)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(translation.Translation) == "" {
+			return fmt.Errorf("%w: the translation to '%s' is empty", core.ErrInvalid, translation.LanguageCode)
+		}
+	}
+	for _, tag := range word.Tags {
+		err = ValidateTag(tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns an error wrapping core.ErrInvalid if words cannot be tagged with
+// the tag.
+func ValidateTag(tag string) error {
+	// A '*' would be read as a wildcard in queries, and each level of a
+	// hierarchical tag needs a name
+	if tag == "" || strings.ContainsAny(tag, " \t\n*") ||
+		strings.HasPrefix(tag, core.TagSeparator) || strings.HasSuffix(tag, core.TagSeparator) ||
+		strings.Contains(tag, core.TagSeparator+core.TagSeparator) {
+		return fmt.Errorf("%w: invalid tag '%s'", core.ErrInvalid, tag)
+	}
+	return nil
+}
+
+func (service *WordService) validateLanguage(languageCode string) error {
+	_, err := service.languageStore.Get(languageCode)
+	if err == core.ErrNotFound {
+		return fmt.Errorf("%w: unknown language '%s'", core.ErrInvalid, languageCode)
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package syntax
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -15,9 +16,11 @@ const (
 const (
 	itemError itemType = iota
 	itemEOF
-	itemTag        // #a1, #mat
+	itemTag        // #a1, #mat, #mat/frukt, #a*
 	itemOp         // lang:no, tr:pl
 	itemOr         // |, OR
+	itemAnd        // AND
+	itemNot        // -, NOT
 	itemParenLeft  // (
 	itemParenRight // )
 )
@@ -142,6 +145,9 @@ func startState(l *lexer) stateFn {
 	case r == '|':
 		l.emit(itemOr)
 		return startState
+	case r == '-':
+		l.emit(itemNot)
+		return startState
 	case r == '(':
 		l.emit(itemParenLeft)
 		return startState
@@ -149,7 +155,7 @@ func startState(l *lexer) stateFn {
 		l.emit(itemParenRight)
 		return startState
 	case unicode.IsLetter(r) && r <= unicode.MaxASCII:
-		return opState
+		return wordState
 	case r == eof:
 		return nil
 	default:
@@ -158,7 +164,11 @@ func startState(l *lexer) stateFn {
 }
 
 func validTagRune(r rune) bool {
-	return unicode.IsLetter(r) || r == '-' || unicode.IsNumber(r)
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) || r == '-' || r == '_' || r == '/' || r == '*'
+}
+
+func validArgRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) || r == '-' || r == '_' || r == '.' || r == '*'
 }
 
 func isTermDelimiter(r rune) bool {
@@ -167,34 +177,78 @@ func isTermDelimiter(r rune) bool {
 
 func tagState(l *lexer) stateFn {
 	switch r := l.next(); {
-	case unicode.IsLetter(r):
+	case unicode.IsLetter(r) || r == '*':
 		for r = l.next(); validTagRune(r); r = l.next() {
 		}
 		l.backup()
 		if !(isTermDelimiter(r)) {
 			return l.errorf("Unexpected symbol '%c' in tag", r)
 		}
+		tag := l.input[l.start:l.pos]
+		if strings.HasSuffix(tag, "/") || strings.Contains(tag, "//") {
+			return l.errorf("Empty level in tag '%s'", tag)
+		}
 		l.emit(itemTag)
 		return startState
 	default:
-		return l.errorf("A hashtag symbol (#) needs to be followed by a letter")
+		return l.errorf("A hashtag symbol (#) needs to be followed by a letter or '*'")
 	}
 }
 
-func opState(l *lexer) stateFn {
+var keywords = map[string]itemType{
+	"AND": itemAnd,
+	"OR":  itemOr,
+	"NOT": itemNot,
+}
+
+func wordState(l *lexer) stateFn {
 	l.acceptRun(func(r rune) bool { return unicode.IsLetter(r) && r < unicode.MaxASCII })
+	if typ, ok := keywords[l.input[l.start:l.pos]]; ok && isTermDelimiter(l.peek()) {
+		l.emit(typ)
+		return startState
+	}
+	return opState
+}
+
+func opState(l *lexer) stateFn {
 	r := l.next()
 	if r != ':' {
 		return l.errorf("Expected colon (:), got '%c'", r)
 	}
-	// TODO: Allow for arguments enclosed in quotes
-	l.acceptRun(func(r rune) bool { return unicode.IsLetter(r) })
+	if l.acceptRune('"') {
+		return quotedArgState
+	}
+	if !l.acceptRun(validArgRune) {
+		return l.errorf("Missing argument to %s", l.input[l.start:l.pos])
+	}
+	return opEndState
+}
+
+// quotedArgState lexes an argument enclosed in double quotes, in which a
+// double quote or backslash is escaped with a backslash.
+func quotedArgState(l *lexer) stateFn {
+	for {
+		switch r := l.next(); r {
+		case '"':
+			return opEndState
+		case '\\':
+			if r := l.next(); r == eof {
+				return l.errorf("Unterminated quoted argument")
+			} else if r != '"' && r != '\\' {
+				return l.errorf("Invalid escape sequence '\\%c' in quoted argument", r)
+			}
+		case eof:
+			return l.errorf("Unterminated quoted argument")
+		}
+	}
+}
+
+func opEndState(l *lexer) stateFn {
 	if r := l.peek(); !isTermDelimiter(r) {
 		return l.errorf("Unexpected symbol '%c' in search operation", r)
 	}
-	op := l.input[l.start:l.pos]
-	if _, err := opToSpec(op); err != nil {
-		return l.errorf("%s is not valid prefix operator", op)
+	if _, err := opToSpec(l.input[l.start:l.pos]); err != nil {
+		return l.errorf("%s", err)
 	}
 	l.emit(itemOp)
 	return startState
@@ -45,3 +45,88 @@ func TestLexerPrefix(t *testing.T) {
 		assert.Equal(t, expectedItem, <-items)
 	}
 }
+
+func TestLexerKeywordsAndNegation(t *testing.T) {
+	items := lex("lexer", "lang:pl -#a1 NOT (tr:en OR tr:no) AND #mat")
+	expectedItems := []item{
+		item{itemOp, "lang:pl"},
+		item{itemNot, "-"},
+		item{itemTag, "#a1"},
+		item{itemNot, "NOT"},
+		item{itemParenLeft, "("},
+		item{itemOp, "tr:en"},
+		item{itemOr, "OR"},
+		item{itemOp, "tr:no"},
+		item{itemParenRight, ")"},
+		item{itemAnd, "AND"},
+		item{itemTag, "#mat"},
+	}
+	for _, expectedItem := range expectedItems {
+		assert.Equal(t, expectedItem, <-items)
+	}
+}
+
+func TestLexerArguments(t *testing.T) {
+	items := lex("lexer", `tr:pt-BR lang:zh-Hant user:bob_42 user:"Ivar \"J\" \\ Test" #nhà `+"#cafe\u0301")
+	expectedItems := []item{
+		item{itemOp, "tr:pt-BR"},
+		item{itemOp, "lang:zh-Hant"},
+		item{itemOp, "user:bob_42"},
+		item{itemOp, `user:"Ivar \"J\" \\ Test"`},
+		item{itemTag, "#nhà"},
+		item{itemTag, "#cafe\u0301"},
+	}
+	for _, expectedItem := range expectedItems {
+		assert.Equal(t, expectedItem, <-items)
+	}
+}
+
+func TestLexerArgumentErrors(t *testing.T) {
+	for _, input := range []string{
+		`lang:`,
+		`lang:""`,
+		`lang:"no`,
+		`lang:"n\o"`,
+		`lang:"no"x`,
+		`lang:no!`,
+		`foo:bar`,
+	} {
+		var last item
+		for i := range lex("lexer", input) {
+			last = i
+		}
+		assert.Equal(t, itemError, last.typ, input)
+	}
+}
+
+func TestLexerHierarchicalTags(t *testing.T) {
+	items := lex("lexer", "#mat/frukt (#a*|#mat/*) #*/frukt")
+	expectedItems := []item{
+		item{itemTag, "#mat/frukt"},
+		item{itemParenLeft, "("},
+		item{itemTag, "#a*"},
+		item{itemOr, "|"},
+		item{itemTag, "#mat/*"},
+		item{itemParenRight, ")"},
+		item{itemTag, "#*/frukt"},
+	}
+	for _, expectedItem := range expectedItems {
+		assert.Equal(t, expectedItem, <-items)
+	}
+}
+
+func TestLexerTagErrors(t *testing.T) {
+	for _, input := range []string{
+		`#`,
+		`#/mat`,
+		`#mat/`,
+		`#mat//frukt`,
+		`#mat!`,
+	} {
+		var last item
+		for i := range lex("lexer", input) {
+			last = i
+		}
+		assert.Equal(t, itemError, last.typ, input)
+	}
+}
@@ -2,7 +2,7 @@
 	package syntax
 
 	import (
-		"github.com/ivartj/kartotek/core"
+		"github.com/ivartj/kartoteka/core"
 		"fmt"
 		"strings"
 		"errors"
@@ -15,9 +15,9 @@
 	token item
 }
 
-%type <spec> top expr expr1 expr2
+%type <spec> top expr expr1 expr2 expr3
 %token <token> TOKEN_TAG TOKEN_OP 
-%token TOKEN_ERROR
+%token TOKEN_AND TOKEN_NOT TOKEN_ERROR
 %token '|' '(' ')'
 
 %%
@@ -46,8 +46,24 @@
 				Right: $2,
 			}
 		}
-	
+	| expr1 TOKEN_AND expr2
+		{
+			$$ = &core.AndWordSpec{
+				Left: $1,
+				Right: $3,
+			}
+		}
+
 	expr2:
+		expr3
+	| TOKEN_NOT expr2
+		{
+			$$ = &core.NotWordSpec{
+				Spec: $2,
+			}
+		}
+	
+	expr3:
 		TOKEN_TAG
 		{
 			$$ = tagToSpec($1.val)
@@ -81,6 +97,10 @@ func (l *parser) Lex(lval *yySymType) int {
 		return ')'
 	case itemOr:
 		return '|'
+	case itemAnd:
+		return TOKEN_AND
+	case itemNot:
+		return TOKEN_NOT
 	case itemTag:
 		lval.token = i
 		return TOKEN_TAG
@@ -88,20 +108,34 @@ func (l *parser) Lex(lval *yySymType) int {
 		lval.token = i
 		return TOKEN_OP
 	case itemError:
+		l.Error(i.val)
 		return TOKEN_ERROR
 	default:
 		panic(fmt.Errorf("Unrecognized token type %d", i.typ))
 	}
 }
 
+// Error records the first error, so that the lexer's description of invalid
+// input is reported rather than the syntax error that follows it.
 func (l *parser) Error(s string) {
+	if l.errlog.Len() != 0 {
+		return
+	}
 	l.errlog.WriteString(s)
 	l.errlog.WriteRune('\n')
 }
 
 func ParseWordSpec(input string) (core.WordSpec, error) {
 	l := &parser{items: lex("lexer", input)}
-	if yyParse(l) != 0 {
+	status := yyParse(l)
+	// Lets the lexer finish if parsing stopped early
+	for range l.items {
+	}
+	if status != 0 {
+		return nil, errors.New(l.errlog.String())
+	}
+	if err := checkDirections(l.val); err != nil {
+		l.Error(err.Error())
 		return nil, errors.New(l.errlog.String())
 	}
 	return l.val, nil
@@ -38,3 +38,138 @@ func TestParse2(t *testing.T) {
 		},
 	}, spec)
 }
+
+func TestParseNegation(t *testing.T) {
+	input := "lang:pl -#a1 (tr:en OR tr:no)"
+	spec, err := ParseWordSpec(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	assert.Equal(t, &core.AndWordSpec{
+		Left: &core.AndWordSpec{
+			Left:  core.LanguageWordSpec("pl"),
+			Right: &core.NotWordSpec{Spec: core.TagWordSpec("a1")},
+		},
+		Right: &core.OrWordSpec{
+			Left:  core.TranslationWordSpec("en"),
+			Right: core.TranslationWordSpec("no"),
+		},
+	}, spec)
+}
+
+func TestParsePrecedence(t *testing.T) {
+	input := "NOT #a1 AND #a2 OR #a3 | NOT NOT #a4"
+	spec, err := ParseWordSpec(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	assert.Equal(t, &core.OrWordSpec{
+		Left: &core.OrWordSpec{
+			Left: &core.AndWordSpec{
+				Left:  &core.NotWordSpec{Spec: core.TagWordSpec("a1")},
+				Right: core.TagWordSpec("a2"),
+			},
+			Right: core.TagWordSpec("a3"),
+		},
+		Right: &core.NotWordSpec{
+			Spec: &core.NotWordSpec{Spec: core.TagWordSpec("a4")},
+		},
+	}, spec)
+}
+
+func TestParseNegatedGroup(t *testing.T) {
+	input := "-(#a1 | #a2)"
+	spec, err := ParseWordSpec(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	assert.Equal(t, &core.NotWordSpec{
+		Spec: &core.OrWordSpec{
+			Left:  core.TagWordSpec("a1"),
+			Right: core.TagWordSpec("a2"),
+		},
+	}, spec)
+}
+
+func TestParseDanglingOperator(t *testing.T) {
+	for _, input := range []string{"#a1 AND", "OR #a1", "#a1 -", "NOT"} {
+		_, err := ParseWordSpec(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseQuotedArguments(t *testing.T) {
+	input := `tr:"pt-BR" | user:"a \"b\" \\ c"`
+	spec, err := ParseWordSpec(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	assert.Equal(t, &core.OrWordSpec{
+		Left:  core.TranslationWordSpec("pt-BR"),
+		Right: core.UserWordSpec(`a "b" \ c`),
+	}, spec)
+}
+
+func TestParseBareArguments(t *testing.T) {
+	input := "lang:zh-Hant user:bob_42 -#ciência"
+	spec, err := ParseWordSpec(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	assert.Equal(t, &core.AndWordSpec{
+		Left: &core.AndWordSpec{
+			Left:  core.LanguageWordSpec("zh-Hant"),
+			Right: core.UserWordSpec("bob_42"),
+		},
+		Right: &core.NotWordSpec{Spec: core.TagWordSpec("ciência")},
+	}, spec)
+}
+
+func TestParseTextSearch(t *testing.T) {
+	input := `word:jabł* | text:"an apple" notes:drzewo`
+	spec, err := ParseWordSpec(input)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	assert.Equal(t, &core.OrWordSpec{
+		Left: &core.TextWordSpec{Field: core.TextFieldWord, Text: "jabł", Prefix: true},
+		Right: &core.AndWordSpec{
+			Left:  &core.TextWordSpec{Field: core.TextFieldAny, Text: "an apple"},
+			Right: &core.TextWordSpec{Field: core.TextFieldNotes, Text: "drzewo"},
+		},
+	}, spec)
+}
+
+func TestParseDirection(t *testing.T) {
+	spec, err := ParseWordSpec("dir:reverse lang:pl")
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	assert.Equal(t, &core.AndWordSpec{
+		Left:  core.DirectionWordSpec(core.CardDirectionReverse),
+		Right: core.LanguageWordSpec("pl"),
+	}, spec)
+
+	_, err = ParseWordSpec("dir:sideways")
+	assert.Error(t, err)
+
+	// Directions match every word, so negating them or offering them as
+	// alternatives would match no word or every word
+	spec, err = ParseWordSpec("(dir:both #a1) lang:pl")
+	assert.NoError(t, err)
+	_, err = ParseWordSpec("-dir:reverse")
+	assert.EqualError(t, err, "The dir: operator cannot be negated\n")
+	_, err = ParseWordSpec("lang:pl -(#a1 dir:reverse)")
+	assert.EqualError(t, err, "The dir: operator cannot be negated\n")
+	_, err = ParseWordSpec("dir:reverse | #a1")
+	assert.EqualError(t, err, "The dir: operator cannot be one of the alternatives of '|'\n")
+	_, err = ParseWordSpec("#a2 | (#a1 dir:reverse)")
+	assert.EqualError(t, err, "The dir: operator cannot be one of the alternatives of '|'\n")
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	_, err := ParseWordSpec("lang:pl dir:sideways")
+	assert.EqualError(t, err, "Unrecognized card direction 'sideways'\n")
+	_, err = ParseWordSpec("lang:pl)")
+	assert.EqualError(t, err, "syntax error\n")
+}
@@ -13,13 +13,100 @@ func tagToSpec(tag string) core.TagWordSpec {
 func opToSpec(opString string) (core.WordSpec, error) {
 	colon := strings.IndexRune(opString, ':')
 	op := opString[:colon]
-	arg := opString[colon+1:]
+	arg := unquoteArg(opString[colon+1:])
+	if arg == "" {
+		return nil, fmt.Errorf("Missing argument to %s:", op)
+	}
 	switch op {
 	case "lang":
 		return core.LanguageWordSpec(arg), nil
 	case "tr":
 		return core.TranslationWordSpec(arg), nil
+	case "user":
+		return core.UserWordSpec(arg), nil
+	case "text":
+		return textToSpec(core.TextFieldAny, arg), nil
+	case "word":
+		return textToSpec(core.TextFieldWord, arg), nil
+	case "translation":
+		return textToSpec(core.TextFieldTranslations, arg), nil
+	case "notes":
+		return textToSpec(core.TextFieldNotes, arg), nil
+	case "dir":
+		if !core.CardDirection(arg).Valid() {
+			return nil, fmt.Errorf("Unrecognized card direction '%s'", arg)
+		}
+		return core.DirectionWordSpec(arg), nil
 	default:
 		return nil, fmt.Errorf("Unrecognized search operator '%s'", op)
 	}
 }
+
+// checkDirections returns an error if a dir: operation is negated or one of
+// the alternatives of '|'. It matches every word and only chooses how cards
+// are shown, so it is only read from the operations that words must match
+// all of.
+func checkDirections(spec core.WordSpec) error {
+	switch s := spec.(type) {
+	case *core.AndWordSpec:
+		err := checkDirections(s.Left)
+		if err != nil {
+			return err
+		}
+		return checkDirections(s.Right)
+	case *core.OrWordSpec:
+		if hasDirection(s) {
+			return fmt.Errorf("The dir: operator cannot be one of the alternatives of '|'")
+		}
+	case *core.NotWordSpec:
+		if hasDirection(s) {
+			return fmt.Errorf("The dir: operator cannot be negated")
+		}
+	}
+	return nil
+}
+
+func hasDirection(spec core.WordSpec) bool {
+	switch s := spec.(type) {
+	case core.DirectionWordSpec:
+		return true
+	case *core.AndWordSpec:
+		return hasDirection(s.Left) || hasDirection(s.Right)
+	case *core.OrWordSpec:
+		return hasDirection(s.Left) || hasDirection(s.Right)
+	case *core.NotWordSpec:
+		return hasDirection(s.Spec)
+	default:
+		return false
+	}
+}
+
+// textToSpec makes a text search, matching words beginning with the last word
+// of the text if it ends with an asterisk.
+func textToSpec(field core.TextField, text string) *core.TextWordSpec {
+	prefix := strings.HasSuffix(text, "*")
+	return &core.TextWordSpec{
+		Field:  field,
+		Text:   strings.TrimSuffix(text, "*"),
+		Prefix: prefix,
+	}
+}
+
+// unquoteArg strips the quotes and escapes from an argument the lexer has
+// accepted as quoted, and returns other arguments as they are.
+func unquoteArg(arg string) string {
+	if !strings.HasPrefix(arg, `"`) {
+		return arg
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range arg[1 : len(arg)-1] {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -23,7 +23,9 @@ type yySymType struct {
 
 const TOKEN_TAG = 57346
 const TOKEN_OP = 57347
-const TOKEN_ERROR = 57348
+const TOKEN_AND = 57348
+const TOKEN_NOT = 57349
+const TOKEN_ERROR = 57350
 
 var yyToknames = [...]string{
 	"$end",
@@ -31,18 +33,21 @@ var yyToknames = [...]string{
 	"$unk",
 	"TOKEN_TAG",
 	"TOKEN_OP",
+	"TOKEN_AND",
+	"TOKEN_NOT",
 	"TOKEN_ERROR",
 	"'|'",
 	"'('",
 	"')'",
 }
+
 var yyStatenames = [...]string{}
 
 const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line parser.y:64
+//line parser.y:80
 
 type parser struct {
 	items  <-chan item
@@ -62,6 +67,10 @@ func (l *parser) Lex(lval *yySymType) int {
 		return ')'
 	case itemOr:
 		return '|'
+	case itemAnd:
+		return TOKEN_AND
+	case itemNot:
+		return TOKEN_NOT
 	case itemTag:
 		lval.token = i
 		return TOKEN_TAG
@@ -69,27 +78,41 @@ func (l *parser) Lex(lval *yySymType) int {
 		lval.token = i
 		return TOKEN_OP
 	case itemError:
+		l.Error(i.val)
 		return TOKEN_ERROR
 	default:
 		panic(fmt.Errorf("Unrecognized token type %d", i.typ))
 	}
 }
 
+// Error records the first error, so that the lexer's description of invalid
+// input is reported rather than the syntax error that follows it.
 func (l *parser) Error(s string) {
+	if l.errlog.Len() != 0 {
+		return
+	}
 	l.errlog.WriteString(s)
 	l.errlog.WriteRune('\n')
 }
 
 func ParseWordSpec(input string) (core.WordSpec, error) {
 	l := &parser{items: lex("lexer", input)}
-	if yyParse(l) != 0 {
+	status := yyParse(l)
+	// Lets the lexer finish if parsing stopped early
+	for range l.items {
+	}
+	if status != 0 {
+		return nil, errors.New(l.errlog.String())
+	}
+	if err := checkDirections(l.val); err != nil {
+		l.Error(err.Error())
 		return nil, errors.New(l.errlog.String())
 	}
 	return l.val, nil
 }
 
 //line yacctab:1
-var yyExca = [...]int{
+var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
@@ -97,47 +120,49 @@ var yyExca = [...]int{
 
 const yyPrivate = 57344
 
-const yyLast = 17
+const yyLast = 27
 
-var yyAct = [...]int{
-
-	4, 5, 6, 2, 9, 7, 8, 3, 12, 8,
-	1, 10, 9, 0, 0, 0, 11,
+var yyAct = [...]int8{
+	4, 10, 2, 17, 11, 10, 5, 13, 7, 8,
+	12, 6, 14, 16, 9, 3, 11, 7, 8, 1,
+	6, 0, 0, 9, 0, 0, 15,
 }
-var yyPact = [...]int{
 
-	-3, -1000, 2, -3, -1000, -1000, -1000, -3, -3, -1000,
-	-1, -3, -1000,
+var yyPact = [...]int16{
+	13, -1000, -4, 4, -1000, -1000, 13, -1000, -1000, 13,
+	13, -1000, 13, -1000, -8, 4, -1000, -1000,
 }
-var yyPgo = [...]int{
 
-	0, 10, 3, 7, 0,
+var yyPgo = [...]int8{
+	0, 19, 2, 15, 0, 6,
 }
-var yyR1 = [...]int{
 
-	0, 1, 2, 2, 3, 3, 4, 4, 4,
+var yyR1 = [...]int8{
+	0, 1, 2, 2, 3, 3, 3, 4, 4, 5,
+	5, 5,
 }
-var yyR2 = [...]int{
 
-	0, 1, 1, 3, 1, 2, 1, 1, 3,
+var yyR2 = [...]int8{
+	0, 1, 1, 3, 1, 2, 3, 1, 2, 1,
+	1, 3,
 }
-var yyChk = [...]int{
 
-	-1000, -1, -2, -3, -4, 4, 5, 8, 7, -4,
-	-2, -3, 9,
+var yyChk = [...]int16{
+	-1000, -1, -2, -3, -4, -5, 7, 4, 5, 10,
+	9, -4, 6, -4, -2, -3, -4, 11,
 }
-var yyDef = [...]int{
 
-	0, -2, 1, 2, 4, 6, 7, 0, 0, 5,
-	0, 3, 8,
+var yyDef = [...]int8{
+	0, -2, 1, 2, 4, 7, 0, 9, 10, 0,
+	0, 5, 0, 8, 0, 3, 6, 11,
 }
-var yyTok1 = [...]int{
 
+var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	8, 9, 3, 3, 3, 3, 3, 3, 3, 3,
+	10, 11, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
@@ -145,13 +170,14 @@ var yyTok1 = [...]int{
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 7,
+	3, 3, 3, 3, 9,
 }
-var yyTok2 = [...]int{
 
-	2, 3, 4, 5, 6,
+var yyTok2 = [...]int8{
+	2, 3, 4, 5, 6, 7, 8,
 }
-var yyTok3 = [...]int{
+
+var yyTok3 = [...]int8{
 	0,
 }
 
@@ -233,9 +259,9 @@ func yyErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := yyPact[state]
+	base := int(yyPact[state])
 	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
-		if n := base + tok; n >= 0 && n < yyLast && yyChk[yyAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -245,13 +271,13 @@ func yyErrorMessage(state, lookAhead int) string {
 
 	if yyDef[state] == -2 {
 		i := 0
-		for yyExca[i] != -1 || yyExca[i+1] != state {
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; yyExca[i] >= 0; i += 2 {
-			tok := yyExca[i]
+			tok := int(yyExca[i])
 			if tok < TOKSTART || yyExca[i+1] == 0 {
 				continue
 			}
@@ -282,30 +308,30 @@ func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = yyTok1[0]
+		token = int(yyTok1[0])
 		goto out
 	}
 	if char < len(yyTok1) {
-		token = yyTok1[char]
+		token = int(yyTok1[char])
 		goto out
 	}
 	if char >= yyPrivate {
 		if char < yyPrivate+len(yyTok2) {
-			token = yyTok2[char-yyPrivate]
+			token = int(yyTok2[char-yyPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(yyTok3); i += 2 {
-		token = yyTok3[i+0]
+		token = int(yyTok3[i+0])
 		if token == char {
-			token = yyTok3[i+1]
+			token = int(yyTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = yyTok2[1] /* unknown char */
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
@@ -360,7 +386,7 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	yyn = yyPact[yystate]
+	yyn = int(yyPact[yystate])
 	if yyn <= yyFlag {
 		goto yydefault /* simple state */
 	}
@@ -371,8 +397,8 @@ yynewstate:
 	if yyn < 0 || yyn >= yyLast {
 		goto yydefault
 	}
-	yyn = yyAct[yyn]
-	if yyChk[yyn] == yytoken { /* valid shift */
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
 		yyrcvr.char = -1
 		yytoken = -1
 		yyVAL = yyrcvr.lval
@@ -385,7 +411,7 @@ yynewstate:
 
 yydefault:
 	/* default state action */
-	yyn = yyDef[yystate]
+	yyn = int(yyDef[yystate])
 	if yyn == -2 {
 		if yyrcvr.char < 0 {
 			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
@@ -394,18 +420,18 @@ yydefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if yyExca[xi+0] == -1 && yyExca[xi+1] == yystate {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			yyn = yyExca[xi+0]
+			yyn = int(yyExca[xi+0])
 			if yyn < 0 || yyn == yytoken {
 				break
 			}
 		}
-		yyn = yyExca[xi+1]
+		yyn = int(yyExca[xi+1])
 		if yyn < 0 {
 			goto ret0
 		}
@@ -427,10 +453,10 @@ yydefault:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				yyn = yyPact[yyS[yyp].yys] + yyErrCode
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
 				if yyn >= 0 && yyn < yyLast {
-					yystate = yyAct[yyn] /* simulate a shift of "error" */
-					if yyChk[yystate] == yyErrCode {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -466,7 +492,7 @@ yydefault:
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= yyR2[yyn]
+	yyp -= int(yyR2[yyn])
 	// yyp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if yyp+1 >= len(yyS) {
@@ -477,16 +503,16 @@ yydefault:
 	yyVAL = yyS[yyp+1]
 
 	/* consult goto table to find next state */
-	yyn = yyR1[yyn]
-	yyg := yyPgo[yyn]
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
 	yyj := yyg + yyS[yyp].yys + 1
 
 	if yyj >= yyLast {
-		yystate = yyAct[yyg]
+		yystate = int(yyAct[yyg])
 	} else {
-		yystate = yyAct[yyj]
-		if yyChk[yystate] != -yyn {
-			yystate = yyAct[yyg]
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -517,21 +543,38 @@ yydefault:
 			}
 		}
 	case 6:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:50
+		{
+			yyVAL.spec = &core.AndWordSpec{
+				Left:  yyDollar[1].spec,
+				Right: yyDollar[3].spec,
+			}
+		}
+	case 8:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:60
+		{
+			yyVAL.spec = &core.NotWordSpec{
+				Spec: yyDollar[2].spec,
+			}
+		}
+	case 9:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:52
+//line parser.y:68
 		{
 			yyVAL.spec = tagToSpec(yyDollar[1].token.val)
 		}
-	case 7:
+	case 10:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:56
+//line parser.y:72
 		{
 			spec, _ := opToSpec(yyDollar[1].token.val)
 			yyVAL.spec = spec
 		}
-	case 8:
+	case 11:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:61
+//line parser.y:77
 		{
 			yyVAL.spec = yyDollar[2].spec
 		}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/ivartj/minn/args"
+	"io"
+	"os"
+)
+
+func tagUsage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: %s tag [ --database FILE ] list\n", mainProgramName)
+	fmt.Fprintf(out, "       %s tag [ --database FILE ] [ --dry-run ] rename TAG NEW-TAG\n", mainProgramName)
+	fmt.Fprintf(out, "       %s tag [ --database FILE ] [ --dry-run ] merge NEW-TAG TAG...\n", mainProgramName)
+	fmt.Fprintf(out, "       %s tag [ --database FILE ] [ --dry-run ] delete TAG\n", mainProgramName)
+	fmt.Fprintf(out, "       %s tag [ --database FILE ] [ --dry-run ] add QUERY TAG\n", mainProgramName)
+	fmt.Fprintf(out, "       %s tag [ --database FILE ] [ --dry-run ] remove QUERY TAG\n", mainProgramName)
+	fmt.Fprintf(out, "\nRenaming, merging, deleting and removing a tag also applies to the tags\n")
+	fmt.Fprintf(out, "under it. With --dry-run, the number of words that would change is shown\n")
+	fmt.Fprintf(out, "without changing them.\n")
+}
+
+// Changes tags across the collection. Like os.Args, argv starts with the
+// name of the command, "tag".
+func tagMain(argv []string, log core.Logger) {
+	database := defaultConfiguration.Database
+	dryRun := false
+	positional := []string{}
+
+	tok := args.NewTokenizer(argv)
+	for tok.Next() {
+		switch arg := tok.Arg(); arg {
+		case "-h", "-?", "--help":
+			tagUsage(os.Stdout)
+			os.Exit(0)
+		case "--database":
+			var err error
+			database, err = tok.TakeParameter()
+			if err != nil {
+				log.Fatalf("%s", err)
+			}
+		case "--dry-run":
+			dryRun = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if tok.Err() != nil {
+		log.Fatalf("Error on parsing command line arguments: %s", tok.Err())
+	}
+	if len(positional) == 0 {
+		tagUsage(os.Stderr)
+		os.Exit(1)
+	}
+	command, params := positional[0], positional[1:]
+
+	db, err := mainOpenDatabase(database)
+	if err != nil {
+		log.Fatalf("Failed to open database file: %s", err)
+	}
+	defer db.Close()
+
+	err = tagRun(db, command, params, dryRun, os.Stdout)
+	if err == errTagUsage {
+		tagUsage(os.Stderr)
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+var errTagUsage = errors.New("Invalid usage")
+
+func tagRun(db *sql.DB, command string, params []string, dryRun bool, out io.Writer) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	tagStore := repository.NewTagStore(tx)
+	tagService := service.NewTagService(tagStore, repository.NewWordStore(tx))
+
+	var count int
+	switch {
+	case command == "list" && len(params) == 0:
+		tags, err := tagStore.ListNodes()
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			fmt.Fprintf(out, "%s\t%d words\n", tag.Tag, tag.WordCount)
+		}
+		return nil
+
+	case command == "rename" && len(params) == 2:
+		count, err = tagService.Rename(params[0], params[1])
+
+	case command == "merge" && len(params) >= 2:
+		count, err = tagService.Merge(params[1:], params[0])
+
+	case command == "delete" && len(params) == 1:
+		count, err = tagService.Delete(params[0])
+
+	case (command == "add" || command == "remove") && len(params) == 2:
+		spec, err := syntax.ParseWordSpec(params[0])
+		if err != nil {
+			return fmt.Errorf("Invalid query: %w", err)
+		}
+		if command == "add" {
+			count, err = tagService.AddToMatching(spec, params[1])
+		} else {
+			count, err = tagService.RemoveFromMatching(spec, params[1])
+		}
+		if err != nil {
+			return err
+		}
+
+	default:
+		return errTagUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "%d words would be changed\n", count)
+		return nil
+	}
+	fmt.Fprintf(out, "Changed %d words\n", count)
+	return tx.Commit()
+}
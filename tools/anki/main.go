@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/anki"
+	"github.com/ivartj/kartoteka/blobstore"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/ivartj/kartoteka/wordfile"
+	"github.com/ivartj/minn/args"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"log"
+	"os"
+)
+
+// The same default as the server's
+const maxImageSize = 10 << 20
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: anki import --lang CODE [ --tr CODE ] [ --field FIELD=TARGET ]... [ --tag TAG ]...")
+	fmt.Fprintln(w, "                   [ --user USERNAME ] [ --images-directory DIR ] [ --dry-run ] <package> <database>")
+	fmt.Fprintln(w, "       anki export [ --deck NAME ] [ --tr CODE ] [ --images-directory DIR ] [ --no-images ]")
+	fmt.Fprintln(w, "                   [ --output FILE ] <database> [ QUERY ]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "A TARGET is word, notes, image or tr:CODE, and a FIELD is a field name or a")
+	fmt.Fprintln(w, "position counted from 1. Without --field, the first field is the word and the")
+	fmt.Fprintln(w, "second a translation into the --tr language, or the notes.")
+}
+
+func main() {
+	logger := log.New(os.Stderr, "anki: ", 0)
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "-h", "--help":
+		usage(os.Stdout)
+	case "import":
+		importMain(os.Args[1:], logger)
+	case "export":
+		exportMain(os.Args[1:], logger)
+	default:
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+}
+
+func importMain(argv []string, logger *log.Logger) {
+	lang := ""
+	translationLanguage := ""
+	mapping := anki.Mapping{}
+	tags := []string{}
+	username := "anki"
+	imagesDirectory := "./images"
+	dryRun := false
+	positional := []string{}
+
+	tok := args.NewTokenizer(argv)
+	for tok.Next() {
+		var err error
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "--lang":
+			lang, err = tok.TakeParameter()
+		case "--tr":
+			translationLanguage, err = tok.TakeParameter()
+		case "--field":
+			var field string
+			field, err = tok.TakeParameter()
+			if err == nil {
+				err = mapping.Set(field)
+			}
+		case "--tag":
+			var tag string
+			tag, err = tok.TakeParameter()
+			tags = append(tags, tag)
+		case "--user":
+			username, err = tok.TakeParameter()
+		case "--images-directory":
+			imagesDirectory, err = tok.TakeParameter()
+		case "--dry-run":
+			dryRun = true
+		default:
+			positional = append(positional, arg)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 2 || lang == "" {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	if len(mapping) == 0 {
+		mapping = anki.DefaultMapping(translationLanguage)
+	}
+	packageFilename := positional[0]
+	databaseFilename := positional[1]
+
+	pkg, err := anki.Open(packageFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer pkg.Close()
+
+	db, err := sql.Open("sqlite3", databaseFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("pragma foreign_keys = on;")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	user, err := wordfile.GetOrAddUser(repository.NewUserStore(tx), username)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	wordStore := repository.NewWordStore(tx)
+	// Images are only counted on a dry run, as they would be left in the
+	// images directory
+	var imageService *service.ImageService
+	if !dryRun {
+		blobStore, err := blobstore.NewFileStore(imagesDirectory)
+		if err != nil {
+			logger.Fatalf("Failed to open images directory: %s", err)
+		}
+		imageService = service.NewImageService(repository.NewImageStore(tx), wordStore, blobStore, maxImageSize)
+	}
+	importer := anki.NewImporter(wordStore, repository.NewLanguageStore(tx), imageService, user)
+	importer.Lang = lang
+	importer.Mapping = mapping
+	importer.Tags = tags
+	importer.Log = os.Stdout
+	sum, err := importer.Import(pkg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Printf("%d added, %d changed, %d unchanged, %d images", sum.Added, sum.Changed, sum.Unchanged, sum.Images)
+	if sum.Skipped != 0 {
+		fmt.Printf(", %d notes without a word skipped", sum.Skipped)
+	}
+	fmt.Println()
+	if dryRun {
+		fmt.Println("Dry run; nothing was changed")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func exportMain(argv []string, logger *log.Logger) {
+	deck := ""
+	translationLanguage := ""
+	imagesDirectory := "./images"
+	noImages := false
+	output := "-"
+	positional := []string{}
+
+	tok := args.NewTokenizer(argv)
+	for tok.Next() {
+		var err error
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "--deck":
+			deck, err = tok.TakeParameter()
+		case "--tr":
+			translationLanguage, err = tok.TakeParameter()
+		case "--images-directory":
+			imagesDirectory, err = tok.TakeParameter()
+		case "--no-images":
+			noImages = true
+		case "-o", "--output":
+			output, err = tok.TakeParameter()
+		default:
+			positional = append(positional, arg)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 1 && len(positional) != 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	databaseFilename := positional[0]
+	var spec core.WordSpec = core.AnyWordSpec{}
+	if len(positional) == 2 {
+		var err error
+		spec, err = syntax.ParseWordSpec(positional[1])
+		if err != nil {
+			logger.Fatalf("Invalid query: %s", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", databaseFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	words, err := repository.NewWordStore(tx).List(&core.WordQuery{Spec: spec})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var blobStore core.BlobStore
+	if !noImages {
+		blobStore, err = blobstore.NewFileStore(imagesDirectory)
+		if err != nil {
+			logger.Fatalf("Failed to open images directory: %s", err)
+		}
+	}
+	exporter := anki.NewExporter(repository.NewImageStore(tx), blobStore)
+	if deck != "" {
+		exporter.Deck = deck
+	}
+	exporter.TranslationLanguage = translationLanguage
+
+	out := os.Stdout
+	if output != "-" {
+		out, err = os.Create(output)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	w := bufio.NewWriter(out)
+	err = exporter.Export(w, words)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("Exported %d words", len(words))
+}
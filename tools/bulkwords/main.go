@@ -3,107 +3,111 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"github.com/BurntSushi/toml"
-	"github.com/ivartj/kartoteka/core"
-	entity "github.com/ivartj/kartoteka/core/entity"
 	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/wordfile"
+	"github.com/ivartj/minn/args"
 	_ "github.com/mattn/go-sqlite3"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
-	"regexp"
 )
 
-type word struct {
-	Word  string            `toml:"word"`
-	Lang  string            `toml:"lang"`
-	Tr    map[string]string `toml:"tr"`
-	Notes string            `toml:"notes"`
-	Tags  []string          `toml:"tags"`
-}
+const username = "bulkwords"
 
 func usage(w io.Writer) {
-	fmt.Fprintln(w, "Usage: bulkwords <word-file> <database>")
+	fmt.Fprintln(w, "Usage: bulkwords [ --dry-run ] [ --delete-missing ] <word-file> <database>")
 }
 
 func main() {
-	if len(os.Args) != 3 {
+	logger := log.New(os.Stderr, "bulkwords: ", 0)
+
+	dryRun := false
+	deleteMissing := false
+	positional := []string{}
+
+	tok := args.NewTokenizer(os.Args)
+	for tok.Next() {
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "--dry-run":
+			dryRun = true
+		case "--delete-missing":
+			deleteMissing = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 2 {
 		usage(os.Stderr)
 		os.Exit(1)
 	}
-	wordFilename := os.Args[1]
-	username := "bulkwords"
-	databaseFilename := os.Args[2]
+	wordFilename := positional[0]
+	databaseFilename := positional[1]
+
+	wordFile, err := os.Open(wordFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	sections, err := wordfile.Read(wordFile)
+	wordFile.Close()
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	db, err := sql.Open("sqlite3", databaseFilename)
 	if err != nil {
-		panic(err)
+		logger.Fatal(err)
 	}
 	defer db.Close()
+	_, err = db.Exec("pragma foreign_keys = on;")
+	if err != nil {
+		logger.Fatal(err)
+	}
 	tx, err := db.Begin()
 	if err != nil {
-		panic(err)
+		logger.Fatal(err)
 	}
-	defer func() {
-		err := recover()
-		if err != nil {
-			log.Fatal(err)
-			tx.Rollback()
-		}
-	}()
-	_, err = tx.Exec("pragma foreign_keys = on;")
+	defer tx.Rollback()
+
+	languageStore := repository.NewLanguageStore(tx)
+	problems, err := wordfile.Validate(sections, languageStore)
 	if err != nil {
-		panic(err)
+		logger.Fatal(err)
 	}
-	wordStore := repository.NewWordStore(tx)
-	userStore := repository.NewUserStore(tx)
-	user, err := userStore.GetByUsername(username)
-	if err == core.ErrNotFound {
-		user = &entity.User{
-			ID:       entity.UserID(entity.NewID()),
-			Username: "bulkwords",
+	if len(problems) != 0 {
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", wordFilename, p)
 		}
-		userStore.Update(user)
-	} else if err != nil {
-		panic(err)
+		logger.Fatalf("%d problems found; nothing was imported", len(problems))
 	}
 
-	wordFileContent, err := ioutil.ReadFile(wordFilename)
+	user, err := wordfile.GetOrAddUser(repository.NewUserStore(tx), username)
 	if err != nil {
-		panic(err)
+		logger.Fatal(err)
 	}
-
-	separator := regexp.MustCompile(`\n--\r?\n?`)
-	wordSections := separator.Split(string(wordFileContent), -1)
-	for _, wordSection := range wordSections {
-		var w word
-		err = toml.Unmarshal([]byte(wordSection), &w)
-		if err != nil {
-			panic(fmt.Errorf("Parse error '%w' when parsing: %s", err, wordSection))
-		}
-		word := &entity.Word{
-			ID:           entity.WordID(entity.NewID()),
-			Word:         w.Word,
-			UserID:       user.ID,
-			LanguageCode: w.Lang,
-			Translations: []*entity.WordTranslation{},
-			Tags:         w.Tags,
-		}
-		for key, value := range w.Tr {
-			word.Translations = append(word.Translations, &entity.WordTranslation{
-				LanguageCode: key,
-				Translation:  value,
-			})
-		}
-		err = wordStore.Add(word)
-		if err != nil {
-			panic(fmt.Errorf("Error adding word '%s': %w", word.Word, err))
-		}
+	importer := wordfile.NewImporter(repository.NewWordStore(tx), languageStore, user)
+	importer.DeleteMissing = deleteMissing
+	importer.Log = os.Stdout
+	sum, err := importer.Import(sections)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Printf("%d added, %d changed, %d removed, %d unchanged", sum.Added, sum.Changed, sum.Removed, sum.Unchanged)
+	if sum.Kept != 0 {
+		fmt.Printf(", %d not in the file kept", sum.Kept)
+	}
+	fmt.Println()
+	if dryRun {
+		fmt.Println("Dry run; nothing was changed")
+		return
 	}
-
 	err = tx.Commit()
 	if err != nil {
-		panic(err)
+		logger.Fatal(err)
 	}
 }
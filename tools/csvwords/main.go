@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/csvfile"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/ivartj/kartoteka/wordfile"
+	"github.com/ivartj/minn/args"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: csvwords import [ --delimiter CHAR | --tsv ] [ --no-quoting ] [ --lang CODE ]")
+	fmt.Fprintln(w, "                       [ --user USERNAME ] [ --dry-run ] [ --delete-missing ] <file> <database>")
+	fmt.Fprintln(w, "       csvwords export [ --delimiter CHAR | --tsv ] [ --no-quoting ] [ --quizlet [ --tr CODE ] ]")
+	fmt.Fprintln(w, "                       [ --output FILE ] <database> [ QUERY ]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The header row names the columns: id, word, lang, tags, notes and tr:CODE,")
+	fmt.Fprintln(w, "which can be repeated. Files ending in .tsv are tab-separated by default.")
+}
+
+func main() {
+	logger := log.New(os.Stderr, "csvwords: ", 0)
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "-h", "--help":
+		usage(os.Stdout)
+	case "import":
+		importMain(os.Args[1:], logger)
+	case "export":
+		exportMain(os.Args[1:], logger)
+	default:
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+}
+
+// Options of both subcommands for the format of the file
+type formatOptions struct {
+	delimiter string
+	noQuoting bool
+}
+
+func (options *formatOptions) parse(tok *args.Tokenizer) (bool, error) {
+	var err error
+	switch tok.Arg() {
+	case "--delimiter":
+		options.delimiter, err = tok.TakeParameter()
+		if err == nil && utf8.RuneCountInString(options.delimiter) != 1 {
+			err = fmt.Errorf("The delimiter needs to be a single character")
+		}
+	case "--tsv":
+		options.delimiter = "\t"
+	case "--no-quoting":
+		options.noQuoting = true
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// format returns the format given by the options, or by the extension of
+// the file if no delimiter is given.
+func (options *formatOptions) format(filename string) csvfile.Format {
+	format := csvfile.CSV
+	if strings.HasSuffix(strings.ToLower(filename), ".tsv") {
+		format = csvfile.TSV
+	}
+	if options.delimiter != "" {
+		format.Delimiter, _ = utf8.DecodeRuneInString(options.delimiter)
+	}
+	format.Quoting = !options.noQuoting
+	return format
+}
+
+func importMain(argv []string, logger *log.Logger) {
+	formatOptions := &formatOptions{}
+	lang := ""
+	username := "csvwords"
+	dryRun := false
+	deleteMissing := false
+	positional := []string{}
+
+	tok := args.NewTokenizer(argv)
+	for tok.Next() {
+		ok, err := formatOptions.parse(tok)
+		if ok {
+			if err != nil {
+				logger.Fatal(err)
+			}
+			continue
+		}
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "--lang":
+			lang, err = tok.TakeParameter()
+		case "--user":
+			username, err = tok.TakeParameter()
+		case "--dry-run":
+			dryRun = true
+		case "--delete-missing":
+			deleteMissing = true
+		default:
+			positional = append(positional, arg)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	filename := positional[0]
+	databaseFilename := positional[1]
+
+	f, err := os.Open(filename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	rows, problems, err := csvfile.Read(bufio.NewReader(f), formatOptions.format(filename), lang)
+	f.Close()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", databaseFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("pragma foreign_keys = on;")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	languageStore := repository.NewLanguageStore(tx)
+	validationProblems, err := csvfile.Validate(rows, languageStore)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	problems = append(problems, validationProblems...)
+	if len(problems) != 0 {
+		sort.SliceStable(problems, func(i, j int) bool {
+			return problems[i].Line < problems[j].Line
+		})
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", filename, p)
+		}
+		logger.Fatalf("%d problems found; nothing was imported", len(problems))
+	}
+
+	user, err := wordfile.GetOrAddUser(repository.NewUserStore(tx), username)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	importer := wordfile.NewImporter(repository.NewWordStore(tx), languageStore, user)
+	importer.DeleteMissing = deleteMissing
+	importer.Log = os.Stdout
+	sum, err := importer.Import(csvfile.Sections(rows))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Printf("%d added, %d changed, %d removed, %d unchanged", sum.Added, sum.Changed, sum.Removed, sum.Unchanged)
+	if sum.Kept != 0 {
+		fmt.Printf(", %d not in the file kept", sum.Kept)
+	}
+	fmt.Println()
+	if dryRun {
+		fmt.Println("Dry run; nothing was changed")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func exportMain(argv []string, logger *log.Logger) {
+	formatOptions := &formatOptions{}
+	quizlet := false
+	translationLanguage := ""
+	output := "-"
+	positional := []string{}
+
+	tok := args.NewTokenizer(argv)
+	for tok.Next() {
+		ok, err := formatOptions.parse(tok)
+		if ok {
+			if err != nil {
+				logger.Fatal(err)
+			}
+			continue
+		}
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "--quizlet":
+			quizlet = true
+		case "--tr":
+			translationLanguage, err = tok.TakeParameter()
+		case "-o", "--output":
+			output, err = tok.TakeParameter()
+		default:
+			positional = append(positional, arg)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 1 && len(positional) != 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	databaseFilename := positional[0]
+	var spec core.WordSpec = core.AnyWordSpec{}
+	if len(positional) == 2 {
+		var err error
+		spec, err = syntax.ParseWordSpec(positional[1])
+		if err != nil {
+			logger.Fatalf("Invalid query: %s", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", databaseFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	words, err := repository.NewWordStore(tx).List(&core.WordQuery{Spec: spec})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	out := os.Stdout
+	if output != "-" {
+		out, err = os.Create(output)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	w := bufio.NewWriter(out)
+	if quizlet {
+		err = csvfile.WriteQuizlet(w, words, translationLanguage)
+	} else {
+		err = csvfile.Write(w, words, formatOptions.format(output))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("Exported %d words", len(words))
+}
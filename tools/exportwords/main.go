@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/syntax"
+	"github.com/ivartj/kartoteka/wordfile"
+	"github.com/ivartj/minn/args"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"log"
+	"os"
+)
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: exportwords [ --output FILE ] <database> [ QUERY ]")
+}
+
+func main() {
+	logger := log.New(os.Stderr, "exportwords: ", 0)
+
+	output := "-"
+	positional := []string{}
+
+	tok := args.NewTokenizer(os.Args)
+	for tok.Next() {
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "-o", "--output":
+			var err error
+			output, err = tok.TakeParameter()
+			if err != nil {
+				logger.Fatal(err)
+			}
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 1 && len(positional) != 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	databaseFilename := positional[0]
+	var spec core.WordSpec = core.AnyWordSpec{}
+	if len(positional) == 2 {
+		var err error
+		spec, err = syntax.ParseWordSpec(positional[1])
+		if err != nil {
+			logger.Fatalf("Invalid query: %s", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", databaseFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	words, err := repository.NewWordStore(tx).List(&core.WordQuery{Spec: spec})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	out := os.Stdout
+	if output != "-" {
+		out, err = os.Create(output)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	w := bufio.NewWriter(out)
+	err = wordfile.Write(w, words)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("Exported %d words", len(words))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/service"
+	"github.com/ivartj/minn/args"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: fsrsoptimize [ --retention RETENTION ] [ --epochs N ] [ --dry-run ] <database> <username>")
+}
+
+func main() {
+	logger := log.New(os.Stderr, "fsrsoptimize: ", 0)
+
+	desiredRetention := 0.0
+	dryRun := false
+	optimizer := service.NewFSRSOptimizer()
+	positional := []string{}
+
+	tok := args.NewTokenizer(os.Args)
+	for tok.Next() {
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "--retention":
+			param, err := tok.TakeParameter()
+			if err != nil {
+				logger.Fatal(err)
+			}
+			desiredRetention, err = strconv.ParseFloat(param, 64)
+			if err != nil {
+				logger.Fatalf("Invalid retention: %s", err)
+			}
+		case "--epochs":
+			param, err := tok.TakeParameter()
+			if err != nil {
+				logger.Fatal(err)
+			}
+			optimizer.Epochs, err = strconv.Atoi(param)
+			if err != nil {
+				logger.Fatalf("Invalid number of epochs: %s", err)
+			}
+		case "--dry-run":
+			dryRun = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 2 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	databaseFilename := positional[0]
+	username := positional[1]
+
+	db, err := sql.Open("sqlite3", databaseFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("pragma foreign_keys = on;")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	user, err := repository.NewUserStore(tx).GetByUsername(username)
+	if err == core.ErrNotFound {
+		logger.Fatalf("No user named '%s'", username)
+	} else if err != nil {
+		logger.Fatal(err)
+	}
+
+	settingsStore := repository.NewSchedulerSettingsStore(tx)
+	settings, err := settingsStore.Get(user.ID)
+	if err == core.ErrNotFound {
+		settings = &entity.SchedulerSettings{
+			UserID: user.ID,
+		}
+	} else if err != nil {
+		logger.Fatal(err)
+	}
+	initialWeights, err := service.ParseFSRSWeights(settings.Weights)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	reviews, err := repository.NewReviewStore(tx).ListByUser(user.ID)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	weights, loss, err := optimizer.Optimize(reviews, initialWeights)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	weightsJSON, err := json.Marshal(weights)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Printf("Fitted %d reviews with a log loss of %.4f\n", len(reviews), loss)
+	fmt.Printf("Weights: %s\n", weightsJSON)
+	if dryRun {
+		return
+	}
+
+	settings.Algorithm = entity.SchedulerAlgorithmFSRS
+	settings.Weights = string(weightsJSON)
+	if desiredRetention != 0 {
+		settings.DesiredRetention = desiredRetention
+	}
+	if settings.DesiredRetention == 0 {
+		settings.DesiredRetention = 0.9
+	}
+	_, err = service.NewScheduler(settings)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = settingsStore.Update(settings)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Printf("Switched %s to FSRS with a desired retention of %g\n", username, settings.DesiredRetention)
+}
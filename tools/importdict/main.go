@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	"github.com/ivartj/kartoteka/dictionary"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/wordfile"
+	"github.com/ivartj/minn/args"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: importdict --lang CODE --tr CODE [ --headwords FILE ] [ --tag TAG ]")
+	fmt.Fprintln(w, "                  [ --user USERNAME ] [ --dry-run ] <dictionary> <database>")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The dictionary is a FreeDict .tei or .tei.gz file or a StarDict .ifo file.")
+	fmt.Fprintln(w, "Words are tagged source/NAME after the dictionary file unless --tag is given.")
+}
+
+func main() {
+	logger := log.New(os.Stderr, "importdict: ", 0)
+
+	lang := ""
+	translationLanguage := ""
+	headwordsFilename := ""
+	tags := []string{}
+	username := "dictionary"
+	dryRun := false
+	positional := []string{}
+
+	tok := args.NewTokenizer(os.Args)
+	for tok.Next() {
+		var err error
+		switch arg := tok.Arg(); arg {
+		case "-h", "--help":
+			usage(os.Stdout)
+			os.Exit(0)
+		case "--lang":
+			lang, err = tok.TakeParameter()
+		case "--tr":
+			translationLanguage, err = tok.TakeParameter()
+		case "--headwords":
+			headwordsFilename, err = tok.TakeParameter()
+		case "--tag":
+			var tag string
+			tag, err = tok.TakeParameter()
+			tags = append(tags, tag)
+		case "--user":
+			username, err = tok.TakeParameter()
+		case "--dry-run":
+			dryRun = true
+		default:
+			positional = append(positional, arg)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if tok.Err() != nil {
+		logger.Fatal(tok.Err())
+	}
+	if len(positional) != 2 || lang == "" || translationLanguage == "" {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	dictionaryFilename := positional[0]
+	databaseFilename := positional[1]
+
+	var headwords map[string]bool
+	if headwordsFilename != "" {
+		f, err := os.Open(headwordsFilename)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		headwords, err = dictionary.ReadHeadwords(f)
+		f.Close()
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	entries, name, err := openDictionary(dictionaryFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer entries.Close()
+	if len(tags) == 0 {
+		tags = []string{"source" + core.TagSeparator + name}
+	}
+
+	db, err := sql.Open("sqlite3", databaseFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("pragma foreign_keys = on;")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	user, err := wordfile.GetOrAddUser(repository.NewUserStore(tx), username)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	languageStore := repository.NewLanguageStore(tx)
+	for _, code := range []string{lang, translationLanguage} {
+		_, err = languageStore.Get(code)
+		if err == core.ErrNotFound {
+			logger.Fatalf("The language '%s' has not been added", code)
+		} else if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	importer := dictionary.NewImporter(repository.NewWordStore(tx), languageStore, user)
+	importer.Lang = lang
+	importer.TranslationLanguage = translationLanguage
+	importer.Headwords = headwords
+	importer.Tags = tags
+	importer.Progress = os.Stderr
+	sum, err := importer.Import(entries)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	fmt.Printf("%d entries read, %d skipped; %d words added, %d changed, %d unchanged\n",
+		sum.Entries, sum.Skipped, sum.Added, sum.Changed, sum.Unchanged)
+	if dryRun {
+		fmt.Println("Dry run; nothing was changed")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+type entryReadCloser interface {
+	dictionary.EntryReader
+	io.Closer
+}
+
+type teiFile struct {
+	*dictionary.TEIReader
+	closers []io.Closer
+}
+
+func (f *teiFile) Close() error {
+	for _, closer := range f.closers {
+		closer.Close()
+	}
+	return nil
+}
+
+// openDictionary opens the dictionary by the extension of the file, and
+// returns it with a name for it to be tagged with.
+func openDictionary(filename string) (entryReadCloser, string, error) {
+	base := filepath.Base(filename)
+	switch {
+	case strings.HasSuffix(base, ".ifo"):
+		dict, err := dictionary.OpenStarDict(filename)
+		if err != nil {
+			return nil, "", err
+		}
+		return dict, tagName(strings.TrimSuffix(base, ".ifo")), nil
+	case strings.HasSuffix(base, ".tei"), strings.HasSuffix(base, ".tei.gz"):
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, "", err
+		}
+		tei := &teiFile{closers: []io.Closer{f}}
+		var r io.Reader = bufio.NewReader(f)
+		if strings.HasSuffix(base, ".gz") {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				f.Close()
+				return nil, "", err
+			}
+			tei.closers = append(tei.closers, gz)
+			r = gz
+		}
+		tei.TEIReader = dictionary.NewTEIReader(r)
+		return tei, tagName(strings.TrimSuffix(strings.TrimSuffix(base, ".gz"), ".tei")), nil
+	default:
+		return nil, "", fmt.Errorf("Unknown kind of dictionary '%s'; expected a .tei, .tei.gz or .ifo file", filename)
+	}
+}
+
+// tagName turns a file name into a single level of a tag.
+func tagName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '*' || string(r) == core.TagSeparator {
+			return '-'
+		}
+		return r
+	}, name)
+}
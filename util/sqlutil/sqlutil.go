@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type Row struct {
@@ -145,6 +146,12 @@ func ScanEntityFromMap(m map[string]interface{}, keyPrefix string, entity interf
 				if !retValues[0].IsNil() {
 					return retValues[0].Interface().(error)
 				}
+			} else if field.typ == timeType {
+				t, err := scanTime(value)
+				if err != nil {
+					return fmt.Errorf("Failed to scan column %s: %w", columnName, err)
+				}
+				fieldValue.Set(reflect.ValueOf(t))
 			} else {
 				fieldValue.Set(reflect.ValueOf(value).Convert(field.typ))
 			}
@@ -153,6 +160,34 @@ func ScanEntityFromMap(m map[string]interface{}, keyPrefix string, entity interf
 	return nil
 }
 
+var timeType reflect.Type = reflect.TypeOf(time.Time{})
+
+// Layouts that datetime columns may come back as, depending on whether the
+// driver parsed the value itself before it was converted to a string.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+}
+
+func scanTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range timeLayouts {
+			t, err := time.Parse(layout, v)
+			if err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("Unrecognized time format '%s'", v)
+	default:
+		return time.Time{}, fmt.Errorf("Cannot convert %T to time", value)
+	}
+}
+
 type null struct{}
 
 var nullType reflect.Type = reflect.TypeOf(null{})
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type testEntity struct {
@@ -148,3 +149,44 @@ func TestDbInsertEntity(t *testing.T) {
 	assert.Equal(t, 123, user.ID)
 	assert.Equal(t, "ivartj", user.Name)
 }
+
+type testTimeEntity struct {
+	ID      int       `sqlname:"event_id"`
+	UtcTime time.Time `sqlname:"utc_time"`
+}
+
+func TestRowsScanEntityTime(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`
+		create table event (
+			event_id integer not null primary key,
+			utc_time datetime not null
+		);
+	`)
+	if err != nil {
+		panic(err)
+	}
+	utcTime := time.Date(2020, time.June, 1, 12, 30, 15, 500, time.UTC)
+	err = DB{db}.InsertEntity("event", &testTimeEntity{ID: 1, UtcTime: utcTime})
+	if err != nil {
+		t.Fatalf("Error on inserting entity: %s", err)
+	}
+	rows, err := db.Query("select * from event;")
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		panic("No row")
+	}
+	var entity testTimeEntity
+	err = Rows{rows}.ScanEntity("", &entity)
+	if err != nil {
+		t.Fatalf("Failed to scan entity: %s", err)
+	}
+	assert.True(t, utcTime.Equal(entity.UtcTime))
+}
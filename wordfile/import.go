@@ -0,0 +1,207 @@
+package wordfile
+
+import (
+	"fmt"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/service"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+type Summary struct {
+	Added     int
+	Changed   int
+	Removed   int
+	Unchanged int
+	// Words in the database but not in the file, which are left alone
+	// unless removal is asked for
+	Kept int
+}
+
+// Imports the sections of a word file as the words of a user. Sections are
+// matched with the user's words by their ID if they have one, and otherwise
+// by the word and its language, so that importing an edited file again
+// updates the words rather than adding them twice.
+type Importer struct {
+	wordStore   core.WordStore
+	wordService *service.WordService
+	user        *entity.User
+	// Deletes the words of the user that are not in the file
+	DeleteMissing bool
+	// Where a line is written for each word added, changed or removed
+	Log io.Writer
+}
+
+func NewImporter(wordStore core.WordStore, languageStore core.LanguageStore, user *entity.User) *Importer {
+	return &Importer{
+		wordStore:   wordStore,
+		wordService: service.NewWordService(wordStore, languageStore),
+		user:        user,
+		Log:         ioutil.Discard,
+	}
+}
+
+// GetOrAddUser gets the user that words are imported as, adding it the first
+// time.
+func GetOrAddUser(userStore core.UserStore, username string) (*entity.User, error) {
+	user, err := userStore.GetByUsername(username)
+	if err == core.ErrNotFound {
+		user = &entity.User{
+			ID:       entity.UserID(entity.NewID()),
+			Username: username,
+		}
+		err = userStore.Update(user)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the %s user: %w", username, err)
+	}
+	return user, nil
+}
+
+// Import imports sections that have been validated with Validate.
+func (importer *Importer) Import(sections []*Section) (*Summary, error) {
+	existing, err := importer.wordStore.List(&core.WordQuery{Spec: core.UserWordSpec(importer.user.Username)})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the words of %s: %w", importer.user.Username, err)
+	}
+	byID := map[string]*entity.Word{}
+	byKey := map[string][]*entity.Word{}
+	for _, word := range existing {
+		byID[word.ID.String] = word
+		byKey[naturalKey(word.Word, word.LanguageCode)] = append(byKey[naturalKey(word.Word, word.LanguageCode)], word)
+	}
+	// Words with an ID given in the file are only matched by it
+	matched := map[string]bool{}
+	for _, section := range sections {
+		if section.ID == "" {
+			continue
+		}
+		if matched[section.ID] {
+			return nil, fmt.Errorf("The ID %s of '%s' is used more than once", section.ID, section.Word)
+		}
+		matched[section.ID] = true
+	}
+
+	sum := new(Summary)
+	for _, section := range sections {
+		word := section.ToWord(importer.user.ID)
+		var old *entity.Word
+		if section.ID != "" {
+			old = byID[section.ID]
+			if old == nil {
+				_, err = importer.wordStore.Get(word.ID)
+				if err == nil {
+					return nil, fmt.Errorf("The ID %s of '%s' is used by a word of another user", section.ID, section.Word)
+				} else if err != core.ErrNotFound {
+					return nil, err
+				}
+			}
+		} else {
+			old = takeMatch(byKey[naturalKey(section.Word, section.Lang)], word, matched)
+		}
+
+		if old == nil {
+			if section.ID == "" {
+				word.ID = entity.WordID(entity.NewID())
+			}
+			err = importer.wordService.Add(word)
+			if err != nil {
+				return nil, fmt.Errorf("Error adding '%s': %w", word.Word, err)
+			}
+			matched[word.ID.String] = true
+			sum.Added++
+			fmt.Fprintf(importer.Log, "added\t%s (%s)\n", word.Word, word.LanguageCode)
+			continue
+		}
+
+		matched[old.ID.String] = true
+		word.ID = old.ID
+		word.ImageID = old.ImageID
+		if sameContent(old, word) {
+			sum.Unchanged++
+			continue
+		}
+		err = importer.wordService.Update(word)
+		if err != nil {
+			return nil, fmt.Errorf("Error updating '%s': %w", word.Word, err)
+		}
+		sum.Changed++
+		fmt.Fprintf(importer.Log, "changed\t%s (%s)\n", word.Word, word.LanguageCode)
+	}
+
+	for _, word := range existing {
+		if matched[word.ID.String] {
+			continue
+		}
+		if !importer.DeleteMissing {
+			sum.Kept++
+			continue
+		}
+		err = importer.wordStore.Delete(word.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error deleting '%s': %w", word.Word, err)
+		}
+		sum.Removed++
+		fmt.Fprintf(importer.Log, "removed\t%s (%s)\n", word.Word, word.LanguageCode)
+	}
+	return sum, nil
+}
+
+func naturalKey(word, languageCode string) string {
+	return languageCode + "\x00" + word
+}
+
+// takeMatch takes the first of the candidates not already matched with
+// another section or named by ID, preferring one with the same content, so
+// that sections for different meanings of the same word keep to their own
+// words.
+func takeMatch(candidates []*entity.Word, word *entity.Word, matched map[string]bool) *entity.Word {
+	var first *entity.Word
+	for _, candidate := range candidates {
+		if matched[candidate.ID.String] {
+			continue
+		}
+		if sameContent(candidate, word) {
+			return candidate
+		}
+		if first == nil {
+			first = candidate
+		}
+	}
+	return first
+}
+
+// sameContent tells whether the words have the same text, language, notes,
+// translations and tags, in any order.
+func sameContent(a, b *entity.Word) bool {
+	if a.Word != b.Word || a.LanguageCode != b.LanguageCode || a.Notes != b.Notes {
+		return false
+	}
+	return sameStrings(a.Tags, b.Tags) && sameStrings(translationStrings(a), translationStrings(b))
+}
+
+func translationStrings(word *entity.Word) []string {
+	strs := make([]string, 0, len(word.Translations))
+	for _, translation := range word.Translations {
+		strs = append(strs, translation.LanguageCode+"\x00"+translation.Translation)
+	}
+	return strs
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package wordfile
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/service"
+	"sort"
+	"strings"
+)
+
+// problemAt returns a problem at where the key is set in the section, or at
+// the start of the section if it is not found there.
+func (section *Section) problemAt(key toml.Key, format string, v ...interface{}) Problem {
+	line, col := section.keyPosition(key)
+	return Problem{
+		Line:    line,
+		Col:     col,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// keyPosition finds the line and column of the key by looking for the
+// key or table header on its own line, which is how word files are
+// written. Keys set otherwise, as in inline tables, are not found.
+func (section *Section) keyPosition(key toml.Key) (int, int) {
+	table := ""
+	for i, line := range strings.Split(section.text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		col := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			table = strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			if table == key.String() {
+				return section.line + i, col
+			}
+			continue
+		}
+		name := strings.TrimSpace(strings.SplitN(trimmed, "=", 2)[0])
+		name = strings.Trim(name, `"'`)
+		if len(key) != 0 && table == key[:len(key)-1].String() && name == key[len(key)-1] && strings.Contains(trimmed, "=") {
+			return section.line + i, col
+		}
+	}
+	return section.line, 1
+}
+
+// Validate checks the sections for everything that would keep them from
+// being imported, returning every problem found in the order of the file.
+func Validate(sections []*Section, languageStore core.LanguageStore) ([]Problem, error) {
+	problems := []Problem{}
+	languages := map[string]bool{}
+	knownLanguage := func(code string) (bool, error) {
+		known, ok := languages[code]
+		if ok {
+			return known, nil
+		}
+		_, err := languageStore.Get(code)
+		if err != nil && err != core.ErrNotFound {
+			return false, err
+		}
+		languages[code] = err == nil
+		return err == nil, nil
+	}
+	// The first line of each ID and of each section content, for reporting
+	// duplicates
+	ids := map[string]int{}
+	contents := map[string]int{}
+
+	for _, section := range sections {
+		if section.problem != nil {
+			problems = append(problems, *section.problem)
+			continue
+		}
+		for _, key := range section.undecoded {
+			problems = append(problems, section.problemAt(key, "unknown key '%s'", key))
+		}
+
+		if strings.TrimSpace(section.Word) == "" {
+			problems = append(problems, section.problemAt(toml.Key{"word"}, "the word is empty"))
+		}
+		if section.Lang == "" {
+			problems = append(problems, section.problemAt(toml.Key{"lang"}, "missing lang"))
+		} else if known, err := knownLanguage(section.Lang); err != nil {
+			return nil, err
+		} else if !known {
+			problems = append(problems, section.problemAt(toml.Key{"lang"}, "unknown language '%s'", section.Lang))
+		}
+
+		codes := make([]string, 0, len(section.Tr))
+		for code := range section.Tr {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			if known, err := knownLanguage(code); err != nil {
+				return nil, err
+			} else if !known {
+				problems = append(problems, section.problemAt(toml.Key{"tr", code}, "unknown language '%s'", code))
+			} else if texts, ok := section.translations(code); !ok {
+				problems = append(problems, section.problemAt(toml.Key{"tr", code}, "the translation to '%s' is neither a string nor an array of strings", code))
+			} else if len(texts) == 0 {
+				problems = append(problems, section.problemAt(toml.Key{"tr", code}, "no translations to '%s'", code))
+			} else {
+				for _, text := range texts {
+					if strings.TrimSpace(text) == "" {
+						problems = append(problems, section.problemAt(toml.Key{"tr", code}, "the translation to '%s' is empty", code))
+					}
+				}
+			}
+		}
+		for _, tag := range section.Tags {
+			if service.ValidateTag(tag) != nil {
+				problems = append(problems, section.problemAt(toml.Key{"tags"}, "invalid tag '%s'", tag))
+			}
+		}
+
+		if section.ID != "" {
+			if first, ok := ids[section.ID]; ok {
+				problems = append(problems, section.problemAt(toml.Key{"id"}, "duplicate id '%s', first used on line %d", section.ID, first))
+			} else {
+				ids[section.ID] = section.line
+			}
+		} else {
+			// Different meanings of the same word are allowed, but not the
+			// same section twice
+			content := section.contentKey()
+			if first, ok := contents[content]; ok {
+				problems = append(problems, section.problemAt(toml.Key{"word"}, "duplicate of the section on line %d", first))
+			} else {
+				contents[content] = section.line
+			}
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+func (section *Section) contentKey() string {
+	tags := append([]string{}, section.Tags...)
+	sort.Strings(tags)
+	translations := translationStrings(section.ToWord(entity.UserID{}))
+	sort.Strings(translations)
+	return strings.Join([]string{
+		section.Word,
+		section.Lang,
+		section.Notes,
+		strings.Join(tags, "\x00"),
+		strings.Join(translations, "\x01"),
+	}, "\x02")
+}
@@ -0,0 +1,219 @@
+// Reads and writes word files, in which each word is a TOML section and the
+// sections are separated by lines of "--".
+package wordfile
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The line separating sections
+const Separator = "--"
+
+type Section struct {
+	// Optional; words without one are identified by the word and its
+	// language
+	ID    string   `toml:"id,omitempty"`
+	Word  string   `toml:"word"`
+	Lang  string   `toml:"lang"`
+	Tags  []string `toml:"tags,omitempty"`
+	Notes string   `toml:"notes,omitempty"`
+	// Translations by language code, each a string or, for several
+	// translations into the same language, an array of strings
+	Tr map[string]interface{} `toml:"tr,omitempty"`
+
+	// The line of the file the section starts on
+	line int
+	text string
+	// Set if the section could not be read, in which case the other fields
+	// are not to be relied on
+	problem   *Problem
+	undecoded []toml.Key
+}
+
+// A problem with a word file, at a line and column counted from 1
+type Problem struct {
+	Line    int
+	Col     int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Col, p.Message)
+}
+
+// Read reads the sections of a word file. Sections that cannot be read are
+// returned with a problem that Validate reports, rather than as an error,
+// so that every problem in the file can be reported at once.
+func Read(r io.Reader) ([]*Section, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sections := []*Section{}
+	lines := strings.SplitAfter(string(content), "\n")
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && strings.TrimRight(lines[i], "\r\n") != Separator {
+			continue
+		}
+		text := strings.Join(lines[start:i], "")
+		if strings.TrimSpace(text) != "" {
+			sections = append(sections, decodeSection(text, start+1))
+		}
+		start = i + 1
+	}
+	return sections, nil
+}
+
+// Decode errors other than syntax errors give the line only in the message
+var decodeErrorLine = regexp.MustCompile(`^toml: line (\d+) \(last key "[^"]*"\): `)
+
+func decodeSection(text string, line int) *Section {
+	section := &Section{
+		line: line,
+		text: text,
+	}
+	md, err := toml.Decode(text, section)
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		section.problem = &Problem{
+			Line:    line + parseErr.Position.Line - 1,
+			Col:     parseErr.Position.Col,
+			Message: parseErr.Message,
+		}
+	} else if err != nil {
+		section.problem = &Problem{
+			Line:    line,
+			Col:     1,
+			Message: strings.TrimPrefix(err.Error(), "toml: "),
+		}
+		if m := decodeErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			section.problem.Line = line + n - 1
+			section.problem.Message = strings.TrimPrefix(err.Error(), m[0])
+		}
+	} else {
+		section.undecoded = md.Undecoded()
+	}
+	return section
+}
+
+// Write writes the words as a word file, ordered by language, word and ID
+// so that the file changes little between writes of the same collection.
+func Write(w io.Writer, words []*entity.Word) error {
+	sorted := append([]*entity.Word{}, words...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.LanguageCode != b.LanguageCode {
+			return a.LanguageCode < b.LanguageCode
+		}
+		if a.Word != b.Word {
+			return a.Word < b.Word
+		}
+		return a.ID.String < b.ID.String
+	})
+	for i, word := range sorted {
+		if i != 0 {
+			_, err := fmt.Fprintf(w, "\n%s\n\n", Separator)
+			if err != nil {
+				return err
+			}
+		}
+		encoder := toml.NewEncoder(w)
+		encoder.Indent = ""
+		err := encoder.Encode(NewSection(word))
+		if err != nil {
+			return fmt.Errorf("Error writing '%s': %w", word.Word, err)
+		}
+	}
+	return nil
+}
+
+func NewSection(word *entity.Word) *Section {
+	section := &Section{
+		ID:    word.ID.String,
+		Word:  word.Word,
+		Lang:  word.LanguageCode,
+		Tags:  append([]string{}, word.Tags...),
+		Notes: word.Notes,
+		Tr:    map[string]interface{}{},
+	}
+	sort.Strings(section.Tags)
+	translations := map[string][]string{}
+	for _, translation := range word.Translations {
+		translations[translation.LanguageCode] = append(translations[translation.LanguageCode], translation.Translation)
+	}
+	for code, texts := range translations {
+		if len(texts) == 1 {
+			section.Tr[code] = texts[0]
+		} else {
+			section.Tr[code] = texts
+		}
+	}
+	return section
+}
+
+// ToWord returns the word of the section, which has no ID unless the
+// section has one.
+func (section *Section) ToWord(userID entity.UserID) *entity.Word {
+	word := &entity.Word{
+		Word:         section.Word,
+		UserID:       userID,
+		LanguageCode: section.Lang,
+		Notes:        section.Notes,
+		Translations: []*entity.WordTranslation{},
+		Tags:         append([]string{}, section.Tags...),
+	}
+	if section.ID != "" {
+		word.ID = entity.WordID(sql.NullString{String: section.ID, Valid: true})
+	}
+	codes := make([]string, 0, len(section.Tr))
+	for code := range section.Tr {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		texts, _ := section.translations(code)
+		for _, text := range texts {
+			word.Translations = append(word.Translations, &entity.WordTranslation{
+				WordID:       word.ID,
+				LanguageCode: code,
+				Translation:  text,
+			})
+		}
+	}
+	return word
+}
+
+// translations returns the translations into the language, or false if
+// they are neither a string nor an array of strings.
+func (section *Section) translations(code string) ([]string, bool) {
+	switch value := section.Tr[code].(type) {
+	case string:
+		return []string{value}, true
+	case []interface{}:
+		texts := make([]string, 0, len(value))
+		for _, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			texts = append(texts, text)
+		}
+		return texts, true
+	case []string:
+		return value, true
+	default:
+		return nil, false
+	}
+}
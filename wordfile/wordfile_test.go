@@ -0,0 +1,456 @@
+package wordfile
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/ivartj/kartoteka/core"
+	entity "github.com/ivartj/kartoteka/core/entity"
+	"github.com/ivartj/kartoteka/repository"
+	"github.com/ivartj/kartoteka/repository/repositorytest"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testContext struct {
+	db            *sql.DB
+	wordStore     core.WordStore
+	languageStore core.LanguageStore
+	user          *entity.User
+}
+
+func newTestContext(t *testing.T, username string) *testContext {
+	db := repositorytest.Open(t, "pl", "en", "no")
+	return &testContext{
+		db:            db,
+		wordStore:     repository.NewWordStore(db),
+		languageStore: repository.NewLanguageStore(db),
+		user:          repositorytest.AddUser(t, db, username),
+	}
+}
+
+func (ctx *testContext) export(t *testing.T) string {
+	words, err := ctx.wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		t.Fatalf("Failed to list words: %s", err)
+	}
+	var b bytes.Buffer
+	err = Write(&b, words)
+	if err != nil {
+		t.Fatalf("Failed to write words: %s", err)
+	}
+	return b.String()
+}
+
+func (ctx *testContext) importFile(t *testing.T, content string, deleteMissing bool) *Summary {
+	sections, err := Read(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to read words: %s", err)
+	}
+	problems, err := Validate(sections, ctx.languageStore)
+	if err != nil {
+		t.Fatalf("Failed to validate words: %s", err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+	importer := NewImporter(ctx.wordStore, ctx.languageStore, ctx.user)
+	importer.DeleteMissing = deleteMissing
+	sum, err := importer.Import(sections)
+	if err != nil {
+		t.Fatalf("Failed to import words: %s", err)
+	}
+	return sum
+}
+
+// words lists the words with what a word file holds of them, in a
+// comparable order
+func (ctx *testContext) words(t *testing.T) []*entity.Word {
+	words, err := ctx.wordStore.List(&core.WordQuery{Spec: core.AnyWordSpec{}})
+	if err != nil {
+		t.Fatalf("Failed to list words: %s", err)
+	}
+	for _, word := range words {
+		word.UserID = entity.UserID{}
+		word.UserUsername = ""
+		sort.Strings(word.Tags)
+		sort.Slice(word.Translations, func(i, j int) bool {
+			a, b := word.Translations[i], word.Translations[j]
+			return a.LanguageCode+"\x00"+a.Translation < b.LanguageCode+"\x00"+b.Translation
+		})
+	}
+	sort.Slice(words, func(i, j int) bool {
+		return words[i].ID.String < words[j].ID.String
+	})
+	return words
+}
+
+func TestRoundTrip(t *testing.T) {
+	source := newTestContext(t, "bob")
+	translation := func(languageCode, text string) *entity.WordTranslation {
+		return &entity.WordTranslation{LanguageCode: languageCode, Translation: text}
+	}
+	for _, word := range []*entity.Word{
+		{Word: "jabłko", LanguageCode: "pl",
+			Tags:         []string{"a1", "food/fruit"},
+			Translations: []*entity.WordTranslation{translation("en", "an apple"), translation("no", "et eple")}},
+		// Different meanings of the same word
+		{Word: "zamek", LanguageCode: "pl",
+			Translations: []*entity.WordTranslation{translation("en", "a castle")}},
+		{Word: "zamek", LanguageCode: "pl",
+			Translations: []*entity.WordTranslation{translation("en", "a lock"), translation("en", "a zip")}},
+		{Word: "et \"hus\"", LanguageCode: "no",
+			Notes: "Intetkjønn.\nFlertall: hus.\t\\ ''' \"\"\"",
+			Tags:  []string{"b1"}},
+		{Word: "dom", LanguageCode: "pl"},
+	} {
+		word.ID = entity.WordID(entity.NewID())
+		word.UserID = source.user.ID
+		err := source.wordStore.Add(word)
+		if err != nil {
+			t.Fatalf("Failed to add a word: %s", err)
+		}
+	}
+	exported := source.export(t)
+
+	target := newTestContext(t, "bulkwords")
+	sum := target.importFile(t, exported, false)
+	assert.Equal(t, 5, sum.Added)
+	assert.Equal(t, source.words(t), target.words(t))
+	assert.Equal(t, exported, target.export(t))
+
+	// Importing it again changes nothing
+	sum = target.importFile(t, exported, true)
+	assert.Equal(t, &Summary{Unchanged: 5}, sum)
+}
+
+func TestImportUpdatesInPlace(t *testing.T) {
+	ctx := newTestContext(t, "bulkwords")
+	sum := ctx.importFile(t, `
+word = "jabłko"
+lang = "pl"
+[tr]
+en = "an apple"
+--
+word = "gruszka"
+lang = "pl"
+--
+word = "śliwka"
+lang = "pl"
+`, false)
+	assert.Equal(t, &Summary{Added: 3}, sum)
+
+	sum = ctx.importFile(t, `
+word = "jabłko"
+lang = "pl"
+tags = [ "a1" ]
+[tr]
+en = "an apple"
+--
+word = "śliwka"
+lang = "pl"
+`, false)
+	assert.Equal(t, &Summary{Changed: 1, Unchanged: 1, Kept: 1}, sum)
+
+	sum = ctx.importFile(t, `
+word = "jabłko"
+lang = "pl"
+tags = [ "a1" ]
+[tr]
+en = "an apple"
+`, true)
+	assert.Equal(t, &Summary{Unchanged: 1, Removed: 2}, sum)
+	words := ctx.words(t)
+	assert.Len(t, words, 1)
+	assert.Equal(t, []string{"a1"}, words[0].Tags)
+}
+
+func TestImportMatchesByID(t *testing.T) {
+	ctx := newTestContext(t, "bulkwords")
+	wordID := entity.NewID()
+	sum := ctx.importFile(t, `
+id = "`+wordID.String+`"
+word = "jabłko"
+lang = "pl"
+`, false)
+	assert.Equal(t, &Summary{Added: 1}, sum)
+	words := ctx.words(t)
+	assert.Len(t, words, 1)
+	assert.Equal(t, wordID.String, words[0].ID.String)
+
+	// A section with an ID is matched by it even if the word has changed,
+	// and one without is matched by word and language
+	sum = ctx.importFile(t, `
+id = "`+wordID.String+`"
+word = "jabłoń"
+lang = "pl"
+--
+word = "jabłko"
+lang = "pl"
+`, false)
+	assert.Equal(t, &Summary{Added: 1, Changed: 1}, sum)
+	sum = ctx.importFile(t, `
+word = "jabłko"
+lang = "pl"
+[tr]
+en = "an apple"
+`, false)
+	assert.Equal(t, &Summary{Changed: 1, Kept: 1}, sum)
+	words = ctx.words(t)
+	assert.Len(t, words, 2)
+	for _, word := range words {
+		if word.ID.String == wordID.String {
+			assert.Equal(t, "jabłoń", word.Word)
+		} else {
+			assert.Equal(t, "jabłko", word.Word)
+		}
+	}
+
+	// The words of other users are neither matched nor taken over
+	other := repositorytest.AddUser(t, ctx.db, "alice")
+	otherWord := &entity.Word{ID: entity.WordID(entity.NewID()), Word: "gruszka", LanguageCode: "pl", UserID: other.ID}
+	err := ctx.wordStore.Add(otherWord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum = ctx.importFile(t, `
+word = "gruszka"
+lang = "pl"
+`, false)
+	assert.Equal(t, &Summary{Added: 1, Kept: 2}, sum)
+	sections, err := Read(strings.NewReader(`
+id = "` + otherWord.ID.String + `"
+word = "gruszka"
+lang = "pl"
+`))
+	if err != nil {
+		t.Fatalf("Failed to read words: %s", err)
+	}
+	_, err = NewImporter(ctx.wordStore, ctx.languageStore, ctx.user).Import(sections)
+	assert.EqualError(t, err, "The ID "+otherWord.ID.String+" of 'gruszka' is used by a word of another user")
+}
+
+// Sections for different meanings of the same word keep to their own words
+func TestImportMatchesMeanings(t *testing.T) {
+	ctx := newTestContext(t, "bulkwords")
+	sum := ctx.importFile(t, `
+word = "zamek"
+lang = "pl"
+[tr]
+en = "a castle"
+--
+word = "zamek"
+lang = "pl"
+[tr]
+en = "a lock"
+`, false)
+	assert.Equal(t, &Summary{Added: 2}, sum)
+	before := ctx.words(t)
+
+	sum = ctx.importFile(t, `
+word = "zamek"
+lang = "pl"
+[tr]
+en = "a lock"
+--
+word = "zamek"
+lang = "pl"
+tags = [ "b1" ]
+[tr]
+en = "a castle"
+`, false)
+	assert.Equal(t, &Summary{Changed: 1, Unchanged: 1}, sum)
+	after := ctx.words(t)
+	assert.Len(t, after, 2)
+	for i := range before {
+		assert.Equal(t, before[i].ID, after[i].ID)
+		assert.Equal(t, before[i].Translations, after[i].Translations)
+		if before[i].Translations[0].Translation == "a castle" {
+			assert.Equal(t, []string{"b1"}, after[i].Tags)
+		} else {
+			assert.Equal(t, []string{}, after[i].Tags)
+		}
+	}
+}
+
+// bulkwords --dry-run imports in a transaction that is rolled back, which
+// leaves the database as it was
+func TestImportDryRun(t *testing.T) {
+	ctx := newTestContext(t, "bulkwords")
+	ctx.importFile(t, `
+word = "jabłko"
+lang = "pl"
+--
+word = "gruszka"
+lang = "pl"
+`, false)
+	before := ctx.export(t)
+
+	tx, err := ctx.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections, err := Read(strings.NewReader(`
+word = "jabłko"
+lang = "pl"
+tags = [ "a1" ]
+--
+word = "śliwka"
+lang = "pl"
+`))
+	if err != nil {
+		t.Fatalf("Failed to read words: %s", err)
+	}
+	var log bytes.Buffer
+	importer := NewImporter(repository.NewWordStore(tx), repository.NewLanguageStore(tx), ctx.user)
+	importer.DeleteMissing = true
+	importer.Log = &log
+	sum, err := importer.Import(sections)
+	if err != nil {
+		t.Fatalf("Failed to import words: %s", err)
+	}
+	assert.Equal(t, &Summary{Added: 1, Changed: 1, Removed: 1}, sum)
+	assert.Equal(t, "changed\tjabłko (pl)\nadded\tśliwka (pl)\nremoved\tgruszka (pl)\n", log.String())
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, before, ctx.export(t))
+}
+
+func TestGetOrAddUser(t *testing.T) {
+	ctx := newTestContext(t, "bob")
+	userStore := repository.NewUserStore(ctx.db)
+
+	user, err := GetOrAddUser(userStore, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, ctx.user.ID, user.ID)
+
+	user, err = GetOrAddUser(userStore, "alice")
+	assert.NoError(t, err)
+	added, err := userStore.GetByUsername("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, added.ID, user.ID)
+}
+
+func TestValidate(t *testing.T) {
+	ctx := newTestContext(t, "bulkwords")
+	sections, err := Read(strings.NewReader(`word = "jabłko"
+lang = "pl"
+
+[tr]
+en = "an apple"
+--
+word = " "
+lang = "xx"
+colour = "red"
+tags = [ "a b" ]
+
+[tr]
+en = ""
+zz = "foo"
+--
+word = "x
+--
+word = "gruszka"
+lang = "pl"
+tags = "a1"
+--
+id = "k1"
+word = "kot"
+lang = "pl"
+--
+id = "k1"
+word = "pies"
+lang = "pl"
+--
+word = "jabłko"
+lang = "pl"
+
+[tr]
+en = "an apple"
+`))
+	if err != nil {
+		t.Fatalf("Failed to read words: %s", err)
+	}
+	problems, err := Validate(sections, ctx.languageStore)
+	if err != nil {
+		t.Fatalf("Failed to validate words: %s", err)
+	}
+	lines := []int{}
+	for _, problem := range problems {
+		lines = append(lines, problem.Line)
+	}
+	assert.Equal(t, []int{7, 8, 9, 10, 13, 14, 16, 20, 26, 30}, lines, "%v", problems)
+	assert.Equal(t, Problem{Line: 9, Col: 1, Message: "unknown key 'colour'"}, problems[2])
+	assert.Equal(t, 10, problems[6].Col)
+}
+
+func TestValidateMessages(t *testing.T) {
+	ctx := newTestContext(t, "bulkwords")
+	sections, err := Read(strings.NewReader(`word = " "
+lang = "xx"
+colour = "red"
+tags = [ "a b" ]
+
+[tr]
+en = ""
+zz = "foo"
+no = 1
+pl = []
+--
+word = "x
+--
+word = "gruszka"
+lang = "pl"
+tags = "a1"
+--
+id = "k1"
+word = "kot"
+lang = "pl"
+--
+id = "k1"
+word = "pies"
+lang = "pl"
+--
+word = "kot"
+lang = "pl"
+--
+word = "kot"
+lang = "pl"
+--
+word = "dom"
+[tr]
+en = [ "a house", " " ]
+`))
+	if err != nil {
+		t.Fatalf("Failed to read words: %s", err)
+	}
+	problems, err := Validate(sections, ctx.languageStore)
+	if err != nil {
+		t.Fatalf("Failed to validate words: %s", err)
+	}
+	// Syntax and type errors are described by the TOML decoder
+	for _, i := range []int{8, 9} {
+		assert.NotEmpty(t, problems[i].Message)
+		problems[i].Message = ""
+	}
+	assert.Equal(t, []Problem{
+		{Line: 1, Col: 1, Message: "the word is empty"},
+		{Line: 2, Col: 1, Message: "unknown language 'xx'"},
+		{Line: 3, Col: 1, Message: "unknown key 'colour'"},
+		{Line: 4, Col: 1, Message: "invalid tag 'a b'"},
+		{Line: 7, Col: 1, Message: "the translation to 'en' is empty"},
+		{Line: 8, Col: 1, Message: "unknown language 'zz'"},
+		{Line: 9, Col: 1, Message: "the translation to 'no' is neither a string nor an array of strings"},
+		{Line: 10, Col: 1, Message: "no translations to 'pl'"},
+		{Line: 12, Col: 10},
+		{Line: 16, Col: 1},
+		{Line: 22, Col: 1, Message: "duplicate id 'k1', first used on line 18"},
+		{Line: 29, Col: 1, Message: "duplicate of the section on line 26"},
+		{Line: 32, Col: 1, Message: "missing lang"},
+		{Line: 34, Col: 1, Message: "the translation to 'en' is empty"},
+	}, problems)
+	assert.Equal(t, "12:10: "+problems[8].Message, problems[8].String())
+}